@@ -4,6 +4,7 @@ go 1.15
 
 require (
 	github.com/BurntSushi/toml v0.3.1
+	github.com/decred/dcrd/dcrec/secp256k1/v4 v4.0.1
 	github.com/eko/gocache v1.2.0
 	github.com/fiatjaf/go-lnurl v1.4.0
 	github.com/fiatjaf/ln-decodepay v1.1.0
@@ -17,6 +18,8 @@ require (
 	github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
 	github.com/tidwall/buntdb v1.2.7
 	github.com/tidwall/gjson v1.10.2
+	golang.org/x/crypto v0.0.0-20200622213623-75b288015ac9
+	golang.org/x/net v0.0.0-20201202161906-c7110b5ffcbb
 	golang.org/x/text v0.3.5
 	gopkg.in/tucnak/telebot.v2 v2.3.5
 	gorm.io/driver/sqlite v1.1.4
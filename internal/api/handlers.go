@@ -0,0 +1,182 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/telegram"
+	decodepay "github.com/fiatjaf/ln-decodepay"
+	log "github.com/sirupsen/logrus"
+)
+
+type balanceResponse struct {
+	Balance int `json:"balance"`
+}
+
+type invoiceRequest struct {
+	Amount int    `json:"amount"`
+	Memo   string `json:"memo"`
+}
+
+type invoiceResponse struct {
+	PaymentHash    string `json:"payment_hash"`
+	PaymentRequest string `json:"payment_request"`
+}
+
+type paymentRequest struct {
+	Invoice string `json:"invoice"`
+}
+
+type paymentResponse struct {
+	PaymentHash string `json:"payment_hash"`
+	Amount      int    `json:"amount"`
+}
+
+type sendRequest struct {
+	To     string `json:"to"`
+	Amount int    `json:"amount"`
+	Memo   string `json:"memo"`
+}
+
+type sendResponse struct {
+	To     string `json:"to"`
+	Amount int    `json:"amount"`
+}
+
+// transactionResponse is a transaction between Telegram users, amounts are in sat
+type transactionResponse struct {
+	ID       uint      `json:"id"`
+	Time     time.Time `json:"time"`
+	Type     string    `json:"type"`
+	Amount   int       `json:"amount"`
+	Incoming bool      `json:"incoming"`
+	From     string    `json:"from"`
+	To       string    `json:"to"`
+	Memo     string    `json:"memo"`
+}
+
+// handleBalance returns the balance of the active wallet in sat
+func (s *Server) handleBalance(writer http.ResponseWriter, request *http.Request) {
+	balance, err := s.bot.GetUserBalance(loadUser(request))
+	if err != nil {
+		writeError(writer, http.StatusBadGateway, "could not load the balance")
+		return
+	}
+	writeResponse(writer, http.StatusOK, balanceResponse{Balance: balance})
+}
+
+// handleTransactions returns the latest transactions, up to ?limit=<n>
+func (s *Server) handleTransactions(writer http.ResponseWriter, request *http.Request) {
+	user := loadUser(request)
+	limit := 20
+	if l, err := strconv.Atoi(request.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = l
+	}
+	if limit > maxTransactions {
+		limit = maxTransactions
+	}
+	transactions, err := s.bot.UserTransactions(user, limit)
+	if err != nil {
+		log.Errorf("[API] Could not load transactions: %s", err)
+		writeError(writer, http.StatusInternalServerError, "could not load the transactions")
+		return
+	}
+	response := make([]transactionResponse, len(transactions))
+	for i, t := range transactions {
+		response[i] = transactionResponse{
+			ID:       t.ID,
+			Time:     t.Time,
+			Type:     t.Type,
+			Amount:   t.Amount,
+			Incoming: t.ToId == user.Telegram.ID && t.FromId != user.Telegram.ID,
+			From:     t.FromUser,
+			To:       t.ToUser,
+			Memo:     t.Memo,
+		}
+	}
+	writeResponse(writer, http.StatusOK, response)
+}
+
+// handleCreateInvoice creates an invoice of the active wallet
+func (s *Server) handleCreateInvoice(writer http.ResponseWriter, request *http.Request) {
+	var body invoiceRequest
+	if !readRequest(writer, request, &body) {
+		return
+	}
+	if body.Amount < 1 {
+		writeError(writer, http.StatusBadRequest, "the amount must be at least 1 sat")
+		return
+	}
+	user := loadUser(request)
+	invoice, err := user.Wallet.Invoice(
+		lnbits.InvoiceParams{
+			Out:     false,
+			Amount:  int64(body.Amount),
+			Memo:    body.Memo,
+			Webhook: internal.Configuration.Lnbits.WebhookServer},
+		s.bot.Client)
+	if err != nil {
+		log.Errorf("[API] Could not create invoice for %s: %s", telegram.GetUserStr(user.Telegram), err)
+		writeError(writer, http.StatusBadGateway, "could not create the invoice")
+		return
+	}
+	writeResponse(writer, http.StatusCreated, invoiceResponse{PaymentHash: invoice.PaymentHash, PaymentRequest: invoice.PaymentRequest})
+}
+
+// handlePayInvoice pays an invoice from the active wallet within the spending limits of the user
+func (s *Server) handlePayInvoice(writer http.ResponseWriter, request *http.Request) {
+	var body paymentRequest
+	if !readRequest(writer, request, &body) {
+		return
+	}
+	bolt11, err := decodepay.Decodepay(body.Invoice)
+	if err != nil {
+		writeError(writer, http.StatusBadRequest, "invalid invoice")
+		return
+	}
+	amount := int(bolt11.MSatoshi / 1000)
+	if amount < 1 {
+		writeError(writer, http.StatusBadRequest, "invoices without an amount are not supported")
+		return
+	}
+	user := loadUser(request)
+	if s.bot.PinRequired(user, amount) {
+		writeError(writer, http.StatusForbidden, "this payment needs your PIN, pay it in Telegram")
+		return
+	}
+	invoice, err := s.bot.PayInvoice(user, body.Invoice)
+	if err != nil {
+		log.Warnf("[API] Payment of %s with key %s failed: %s", telegram.GetUserStr(user.Telegram), loadToken(request).Name, err)
+		writeError(writer, http.StatusPaymentRequired, err.Error())
+		return
+	}
+	log.Infof("[API] %s paid %d sat with key %s", telegram.GetUserStr(user.Telegram), amount, loadToken(request).Name)
+	writeResponse(writer, http.StatusOK, paymentResponse{PaymentHash: invoice.PaymentHash, Amount: amount})
+}
+
+// handleSend sends funds to a Telegram user
+func (s *Server) handleSend(writer http.ResponseWriter, request *http.Request) {
+	var body sendRequest
+	if !readRequest(writer, request, &body) {
+		return
+	}
+	if body.Amount < 1 || len(body.To) == 0 {
+		writeError(writer, http.StatusBadRequest, "to and an amount of at least 1 sat are required")
+		return
+	}
+	user := loadUser(request)
+	if s.bot.PinRequired(user, body.Amount) {
+		writeError(writer, http.StatusForbidden, "this payment needs your PIN, send it in Telegram")
+		return
+	}
+	err := s.bot.SendToUser(user, body.To, body.Amount, body.Memo)
+	if err != nil {
+		writeError(writer, http.StatusPaymentRequired, fmt.Sprintf("could not send: %s", err))
+		return
+	}
+	writeResponse(writer, http.StatusOK, sendResponse{To: body.To, Amount: body.Amount})
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter allows a number of requests per key in a fixed window
+type rateLimiter struct {
+	mutex    sync.Mutex
+	limit    int
+	window   time.Duration
+	counters map[string]*rateCounter
+}
+
+type rateCounter struct {
+	start time.Time
+	count int
+}
+
+func newRateLimiter(limit int, window time.Duration) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, counters: make(map[string]*rateCounter)}
+}
+
+// allow counts a request of key and checks whether it is within the limit. A limit of 0 allows everything.
+func (r *rateLimiter) allow(key string, now time.Time) bool {
+	if r.limit <= 0 {
+		return true
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	counter, ok := r.counters[key]
+	if !ok || now.Sub(counter.start) >= r.window {
+		// expired counters of other keys are dropped so that the map doesn't grow
+		for k, c := range r.counters {
+			if now.Sub(c.start) >= r.window {
+				delete(r.counters, k)
+			}
+		}
+		counter = &rateCounter{start: now}
+		r.counters[key] = counter
+	}
+	counter.count++
+	return counter.count <= r.limit
+}
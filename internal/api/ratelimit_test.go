@@ -0,0 +1,53 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_allow(t *testing.T) {
+	r := newRateLimiter(2, time.Minute)
+	now := time.Now()
+	if !r.allow("a", now) || !r.allow("a", now.Add(time.Second)) {
+		t.Fatalf("allow() rejected requests within the limit")
+	}
+	if r.allow("a", now.Add(2*time.Second)) {
+		t.Errorf("allow() accepted a request over the limit")
+	}
+	// every key has its own limit
+	if !r.allow("b", now.Add(2*time.Second)) {
+		t.Errorf("allow() rejected another key")
+	}
+	// the window starts with the first request
+	if r.allow("a", now.Add(time.Minute-time.Second)) {
+		t.Errorf("allow() accepted a request before the window was over")
+	}
+	if !r.allow("a", now.Add(time.Minute)) {
+		t.Errorf("allow() rejected a request after the window was reset")
+	}
+}
+
+func TestRateLimiter_cleanup(t *testing.T) {
+	r := newRateLimiter(1, time.Minute)
+	now := time.Now()
+	r.allow("a", now)
+	r.allow("b", now.Add(30*time.Second))
+	// a new window drops the expired counter of a but keeps b
+	r.allow("c", now.Add(time.Minute))
+	if _, ok := r.counters["a"]; ok {
+		t.Errorf("the expired counter was kept")
+	}
+	if len(r.counters) != 2 {
+		t.Errorf("%d counters, want 2", len(r.counters))
+	}
+}
+
+func TestRateLimiter_unlimited(t *testing.T) {
+	r := newRateLimiter(0, time.Minute)
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		if !r.allow("a", now) {
+			t.Fatalf("allow() rejected request %d without a limit", i)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/telegram"
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+type Server struct {
+	httpServer *http.Server
+	bot        *telegram.TipBot
+	limiter    *rateLimiter
+}
+
+type contextKey string
+
+const (
+	tokenContextKey contextKey = "token"
+	userContextKey  contextKey = "user"
+	maxTransactions            = 100
+)
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func NewServer(bot *telegram.TipBot) *Server {
+	if internal.Configuration.Bot.APIServerUrl == nil {
+		return nil
+	}
+	srv := &http.Server{
+		Addr: internal.Configuration.Bot.APIServerUrl.Host,
+		// Good practice: enforce timeouts for servers you create!
+		WriteTimeout: 30 * time.Second,
+		ReadTimeout:  15 * time.Second,
+	}
+	apiServer := &Server{
+		bot:        bot,
+		httpServer: srv,
+		limiter:    newRateLimiter(internal.Configuration.Bot.APIRateLimit, time.Minute),
+	}
+	apiServer.httpServer.Handler = apiServer.newRouter()
+	go apiServer.httpServer.ListenAndServe()
+	log.Infof("[API] Server started at %s", internal.Configuration.Bot.APIServerUrl.Host)
+	return apiServer
+}
+
+func (s *Server) newRouter() *mux.Router {
+	router := mux.NewRouter()
+	v1 := router.PathPrefix("/api/v1").Subrouter()
+	v1.HandleFunc("/balance", s.authenticated(telegram.ScopeRead, s.handleBalance)).Methods(http.MethodGet)
+	v1.HandleFunc("/transactions", s.authenticated(telegram.ScopeRead, s.handleTransactions)).Methods(http.MethodGet)
+	v1.HandleFunc("/invoices", s.authenticated(telegram.ScopeReceive, s.handleCreateInvoice)).Methods(http.MethodPost)
+	v1.HandleFunc("/payments", s.authenticated(telegram.ScopePay, s.handlePayInvoice)).Methods(http.MethodPost)
+	v1.HandleFunc("/send", s.authenticated(telegram.ScopeSend, s.handleSend)).Methods(http.MethodPost)
+	return router
+}
+
+// authenticated checks the API key of a request, its scope and its rate limit
+func (s *Server) authenticated(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		key := request.Header.Get("X-Api-Key")
+		if auth := request.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+			key = strings.TrimPrefix(auth, "Bearer ")
+		}
+		token, user, err := s.bot.AuthenticateAPIToken(key)
+		if err != nil {
+			writeError(writer, http.StatusUnauthorized, err.Error())
+			return
+		}
+		if !s.limiter.allow(token.Hash, time.Now()) {
+			writeError(writer, http.StatusTooManyRequests, "rate limit exceeded")
+			return
+		}
+		if !token.HasScope(scope) {
+			writeError(writer, http.StatusForbidden, "the api key has no "+scope+" scope")
+			return
+		}
+		ctx := context.WithValue(request.Context(), tokenContextKey, token)
+		ctx = context.WithValue(ctx, userContextKey, user)
+		next(writer, request.WithContext(ctx))
+	}
+}
+
+func loadUser(request *http.Request) *lnbits.User {
+	return request.Context().Value(userContextKey).(*lnbits.User)
+}
+
+func loadToken(request *http.Request) *telegram.APIToken {
+	return request.Context().Value(tokenContextKey).(*telegram.APIToken)
+}
+
+func writeResponse(writer http.ResponseWriter, status int, response interface{}) {
+	writer.Header().Set("Content-Type", "application/json")
+	writer.WriteHeader(status)
+	if err := json.NewEncoder(writer).Encode(response); err != nil {
+		log.Errorf("[API] Could not write response: %s", err)
+	}
+}
+
+func writeError(writer http.ResponseWriter, status int, message string) {
+	writeResponse(writer, status, errorResponse{Error: message})
+}
+
+// readRequest decodes the JSON body of a request
+func readRequest(writer http.ResponseWriter, request *http.Request, body interface{}) bool {
+	if err := json.NewDecoder(http.MaxBytesReader(writer, request.Body, 1<<16)).Decode(body); err != nil {
+		writeError(writer, http.StatusBadRequest, "invalid request body")
+		return false
+	}
+	return true
+}
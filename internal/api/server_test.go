@@ -0,0 +1,153 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/storage"
+	"github.com/LightningTipBot/LightningTipBot/internal/telegram"
+	"github.com/tidwall/buntdb"
+	tb "gopkg.in/tucnak/telebot.v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+const (
+	testKey     = "ltb_test"
+	testInvoice = "lnbc6540n1pwap9atpp52jwdhxg3pz89e8qh26dxpjfqz5nppak70xlhqmqks4jml0tckxashp5sm6h5lymne3d90kdy3pml9us0pr2kw4zktjgyps3h34hhl0tkv7sxqrrssnp4qdkuuuwgkqyk9ltmu8jjc297j3d5tfrw4pvvacwg7hdwqdwszavlw0gga08t3x85udljaqphq29lzz0me5lpcs6rrcxuee2nezrgyny7hyxktjle6ygvrzxffem2hd7e9qj2c2tpyxlcsg6w9skguxatdyxqpk6ru20"
+)
+
+// newTestServer creates a server with the user 1, who has the key testKey with the given scopes
+func newTestServer(t *testing.T, rateLimit int, scopes ...string) *Server {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&lnbits.User{}); err != nil {
+		t.Fatal(err)
+	}
+	user := &lnbits.User{Name: "1", Telegram: &tb.User{ID: 1, Username: "alice"}, Wallet: &lnbits.Wallet{ID: "wallet-1"}}
+	if err := db.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	bot := &telegram.TipBot{Database: db, Bunt: storage.NewBunt(":memory:")}
+	hash := sha256.Sum256([]byte(testKey))
+	token := &telegram.APIToken{Hash: hex.EncodeToString(hash[:]), UserID: 1, Name: "test", Scopes: scopes}
+	if err := bot.Bunt.Set(token); err != nil {
+		t.Fatal(err)
+	}
+	return &Server{bot: bot, limiter: newRateLimiter(rateLimit, time.Minute)}
+}
+
+func TestServer_authenticated(t *testing.T) {
+	s := newTestServer(t, 0, telegram.ScopeRead)
+	handler := s.authenticated(telegram.ScopeRead, func(writer http.ResponseWriter, request *http.Request) {
+		if loadUser(request).Telegram.ID != 1 || loadToken(request).Name != "test" {
+			t.Errorf("the request does not carry the user and the token of the key")
+		}
+		writer.WriteHeader(http.StatusOK)
+	})
+	for _, test := range []struct {
+		name   string
+		header string
+		value  string
+		scope  string
+		status int
+	}{
+		{"no key", "", "", telegram.ScopeRead, http.StatusUnauthorized},
+		{"malformed key", "X-Api-Key", "test", telegram.ScopeRead, http.StatusUnauthorized},
+		{"unknown key", "X-Api-Key", "ltb_unknown", telegram.ScopeRead, http.StatusUnauthorized},
+		{"missing scope", "X-Api-Key", testKey, telegram.ScopePay, http.StatusForbidden},
+		{"header", "X-Api-Key", testKey, telegram.ScopeRead, http.StatusOK},
+		{"bearer", "Authorization", "Bearer " + testKey, telegram.ScopeRead, http.StatusOK},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodGet, "/api/v1/balance", nil)
+			if len(test.header) > 0 {
+				request.Header.Set(test.header, test.value)
+			}
+			recorder := httptest.NewRecorder()
+			h := handler
+			if test.scope != telegram.ScopeRead {
+				h = s.authenticated(test.scope, handler)
+			}
+			h(recorder, request)
+			if recorder.Code != test.status {
+				t.Errorf("status = %d, want %d", recorder.Code, test.status)
+			}
+		})
+	}
+
+	// a revoked key is rejected
+	hash := sha256.Sum256([]byte(testKey))
+	err := s.bot.Bunt.Update(func(tx *buntdb.Tx) error {
+		_, err := tx.Delete((&telegram.APIToken{Hash: hex.EncodeToString(hash[:])}).Key())
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	request := httptest.NewRequest(http.MethodGet, "/api/v1/balance", nil)
+	request.Header.Set("X-Api-Key", testKey)
+	recorder := httptest.NewRecorder()
+	handler(recorder, request)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("status of a revoked key = %d, want %d", recorder.Code, http.StatusUnauthorized)
+	}
+}
+
+func TestServer_authenticatedRateLimit(t *testing.T) {
+	s := newTestServer(t, 2, telegram.ScopeRead)
+	handler := s.authenticated(telegram.ScopeRead, func(writer http.ResponseWriter, request *http.Request) {
+		writer.WriteHeader(http.StatusOK)
+	})
+	for i, want := range []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests} {
+		request := httptest.NewRequest(http.MethodGet, "/api/v1/balance", nil)
+		request.Header.Set("X-Api-Key", testKey)
+		recorder := httptest.NewRecorder()
+		handler(recorder, request)
+		if recorder.Code != want {
+			t.Errorf("status of request %d = %d, want %d", i+1, recorder.Code, want)
+		}
+	}
+}
+
+func TestServer_handlePayInvoice(t *testing.T) {
+	s := newTestServer(t, 0, telegram.ScopePay)
+	// the invoice is over the PIN threshold of the user
+	if err := s.bot.Bunt.Set(&telegram.UserPin{UserID: 1, Threshold: 100}); err != nil {
+		t.Fatal(err)
+	}
+	router := s.newRouter()
+	for _, test := range []struct {
+		name   string
+		body   string
+		status int
+		error  string
+	}{
+		{"invalid body", `{"invoice":`, http.StatusBadRequest, "invalid request body"},
+		{"invalid invoice", `{"invoice":"lnbc1"}`, http.StatusBadRequest, "invalid invoice"},
+		{"pin required", `{"invoice":"` + testInvoice + `"}`, http.StatusForbidden, "this payment needs your PIN, pay it in Telegram"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest(http.MethodPost, "/api/v1/payments", bytes.NewBufferString(test.body))
+			request.Header.Set("X-Api-Key", testKey)
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+			var response errorResponse
+			if err := json.NewDecoder(recorder.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			if recorder.Code != test.status || response.Error != test.error {
+				t.Errorf("response = %d %q, want %d %q", recorder.Code, response.Error, test.status, test.error)
+			}
+		})
+	}
+}
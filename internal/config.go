@@ -17,11 +17,35 @@ var Configuration = struct {
 }{}
 
 type BotConfiguration struct {
-	HttpProxy      string   `yaml:"http_proxy"`
-	LNURLServer    string   `yaml:"lnurl_server"`
-	LNURLServerUrl *url.URL `yaml:"-"`
-	LNURLHostName  string   `yaml:"lnurl_public_host_name"`
-	LNURLHostUrl   *url.URL `yaml:"-"`
+	HttpProxy        string              `yaml:"http_proxy"`
+	LNURLServer      string              `yaml:"lnurl_server"`
+	LNURLServerUrl   *url.URL            `yaml:"-"`
+	LNURLHostName    string              `yaml:"lnurl_public_host_name"`
+	LNURLHostUrl     *url.URL            `yaml:"-"`
+	PendingClaimDays int                 `yaml:"pending_claim_days" default:"7"`
+	ReclaimDays      int                 `yaml:"reclaim_days"`
+	TipUndoSeconds   int                 `yaml:"tip_undo_seconds"`
+	Limits           LimitsConfiguration `yaml:"limits"`
+	NWC              NWCConfiguration    `yaml:"nwc"`
+	APIServer        string              `yaml:"api_server"`
+	APIServerUrl     *url.URL            `yaml:"-"`
+	// APIRateLimit is the number of requests per minute of an API key
+	APIRateLimit int `yaml:"api_rate_limit" default:"60"`
+}
+
+// NWCConfiguration enables Nostr Wallet Connect if a relay is set
+type NWCConfiguration struct {
+	Relay string `yaml:"relay"`
+	// PrivateKey of the wallet service in hex, a key is generated and stored if it is empty
+	PrivateKey string `yaml:"private_key"`
+}
+
+// LimitsConfiguration holds the maximum spending limits of all users, 0 means unlimited
+type LimitsConfiguration struct {
+	PerTransaction  int `yaml:"per_transaction"`
+	PerDay          int `yaml:"per_day"`
+	PerRecipient    int `yaml:"per_recipient"`
+	CoolingOffHours int `yaml:"cooling_off_hours" default:"24"`
 }
 
 type TelegramConfiguration struct {
@@ -41,6 +65,9 @@ type LnbitsConfiguration struct {
 	LnbitsPublicUrl  string   `yaml:"lnbits_public_url"`
 	WebhookServer    string   `yaml:"webhook_server"`
 	WebhookServerUrl *url.URL `yaml:"-"`
+	// KeyEncryptionKey encrypts the wallet keys in the database, it can also be read from KeyEncryptionKeyFile
+	KeyEncryptionKey     string `yaml:"key_encryption_key"`
+	KeyEncryptionKeyFile string `yaml:"key_encryption_key_file"`
 }
 
 func init() {
@@ -64,6 +91,13 @@ func init() {
 		panic(err)
 	}
 	Configuration.Bot.LNURLHostUrl = hostname
+	if len(Configuration.Bot.APIServer) > 0 {
+		apiUrl, err := url.Parse(Configuration.Bot.APIServer)
+		if err != nil {
+			panic(err)
+		}
+		Configuration.Bot.APIServerUrl = apiUrl
+	}
 	checkLnbitsConfiguration()
 }
 
@@ -1,11 +1,16 @@
 package database
 
 import (
+	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/storage"
 	"github.com/LightningTipBot/LightningTipBot/internal/str"
 	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/buntdb"
 	"gorm.io/gorm"
 )
 
@@ -24,3 +29,126 @@ func MigrateAnonIdHash(db *gorm.DB) error {
 	}
 	return nil
 }
+
+// MigrateEncryptWalletKeys encrypts the wallet keys that are still stored in plaintext.
+// Saving a user encrypts its keys if a key encryption key is set.
+func MigrateEncryptWalletKeys(db *gorm.DB) error {
+	users := []lnbits.User{}
+	plaintext := "(%[1]s <> '' AND %[1]s NOT LIKE @prefix)"
+	tx := db.Where(strings.Join([]string{
+		fmt.Sprintf(plaintext, "wallet_adminkey"),
+		fmt.Sprintf(plaintext, "wallet_inkey"),
+		fmt.Sprintf(plaintext, "default_wallet_adminkey"),
+		fmt.Sprintf(plaintext, "default_wallet_inkey"),
+	}, " OR "), sql.Named("prefix", lnbits.EncryptedKeyPrefix+"%")).Find(&users)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if len(users) > 0 {
+		log.Infof("Encrypting the wallet keys of %d users ...", len(users))
+	}
+	for i := range users {
+		tx = db.Save(&users[i])
+		if tx.Error != nil {
+			errmsg := fmt.Sprintf("[MigrateEncryptWalletKeys] Error: Couldn't migrate user %s", users[i].Name)
+			log.Errorln(errmsg)
+			return tx.Error
+		}
+	}
+	return nil
+}
+
+// MigrateBuntUserRefs replaces the users that objects in BuntDB stored before with references and
+// removes all other wallet keys. The users are loaded from the database when they are used.
+func MigrateBuntUserRefs(db *storage.DB) error {
+	return db.Update(func(tx *buntdb.Tx) error {
+		if _, err := tx.Get(buntUserRefsMigration); err == nil {
+			return nil
+		}
+		updates := make(map[string]string)
+		err := tx.Ascend("", func(key, value string) bool {
+			if !strings.Contains(value, `"Telegram":`) && !strings.Contains(value, `"adminkey":"`) && !strings.Contains(value, `"inkey":"`) {
+				return true
+			}
+			var object interface{}
+			if json.Unmarshal([]byte(value), &object) != nil {
+				return true
+			}
+			object, changed := replaceUsers(object)
+			if !stripWalletKeys(object) && !changed {
+				return true
+			}
+			if b, err := json.Marshal(object); err == nil {
+				updates[key] = string(b)
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		for key, value := range updates {
+			var opts *buntdb.SetOptions
+			if ttl, err := tx.TTL(key); err == nil && ttl > 0 {
+				opts = &buntdb.SetOptions{Expires: true, TTL: ttl}
+			}
+			if _, _, err = tx.Set(key, value, opts); err != nil {
+				return err
+			}
+		}
+		log.Infof("Removed wallet keys from %d objects in BuntDB", len(updates))
+		_, _, err = tx.Set(buntUserRefsMigration, "done", nil)
+		return err
+	})
+}
+
+const buntUserRefsMigration = "migration:bunt-user-refs"
+
+// replaceUsers replaces all users in a decoded JSON object with a reference
+func replaceUsers(object interface{}) (interface{}, bool) {
+	changed := false
+	switch v := object.(type) {
+	case map[string]interface{}:
+		if telegram, ok := v["Telegram"].(map[string]interface{}); ok {
+			if _, ok := v["Wallet"]; ok {
+				id, _ := telegram["id"].(float64)
+				return map[string]interface{}{"telegram_id": int(id)}, true
+			}
+		}
+		for key, value := range v {
+			replaced, ok := replaceUsers(value)
+			if ok {
+				v[key] = replaced
+				changed = true
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			replaced, ok := replaceUsers(value)
+			if ok {
+				v[i] = replaced
+				changed = true
+			}
+		}
+	}
+	return object, changed
+}
+
+// stripWalletKeys empties all wallet keys in a decoded JSON object
+func stripWalletKeys(object interface{}) (stripped bool) {
+	switch v := object.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if s, ok := value.(string); ok && (key == "adminkey" || key == "inkey") && len(s) > 0 {
+				v[key] = ""
+				stripped = true
+				continue
+			}
+			stripped = stripWalletKeys(value) || stripped
+		}
+	case []interface{}:
+		for _, value := range v {
+			stripped = stripWalletKeys(value) || stripped
+		}
+	}
+	return stripped
+}
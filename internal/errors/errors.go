@@ -11,6 +11,10 @@ const (
 	InvalidAmountPerUserError
 	GetBalanceError
 	BalanceToLowError
+	NoParticipantsError
+	UserNoWalletError
+	InvalidSharesError
+	InvalidDeadlineError
 )
 
 func New(code TipBotErrorType, err error) TipBotError {
@@ -0,0 +1,110 @@
+// Package events is an in-process bus for payment events. A handler publishes a
+// payment once after it succeeded and independent subscribers react to it, for
+// example by notifying the users or by delivering webhooks.
+//
+// Subscribers are called synchronously in the order they subscribed. They must
+// not block for long, slow work belongs into a scheduled job. A panicking
+// subscriber does not affect the others.
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	log "github.com/sirupsen/logrus"
+)
+
+// Kind is the kind of a payment
+type Kind string
+
+const (
+	// Tip is a /tip of a reply in a chat
+	Tip Kind = "tip"
+	// FaucetClaim is a claim of a share of an inline faucet
+	FaucetClaim Kind = "faucet"
+	// TipjarContribution is a contribution to an inline tipjar
+	TipjarContribution Kind = "tipjar"
+	// Pay is a Lightning invoice paid from a wallet
+	Pay Kind = "pay"
+	// Deposit is a Lightning invoice of a wallet paid from outside the bot
+	Deposit Kind = "deposit"
+)
+
+// Payment is a successful payment. From or To is nil if it is outside the bot.
+type Payment struct {
+	Kind   Kind
+	From   *lnbits.User
+	To     *lnbits.User
+	Amount int // sat
+	ChatID int64
+	Chat   string
+	// Memo is the message of the sender to the receiver
+	Memo          string
+	PaymentHash   string
+	TransactionID uint
+	// ReferenceID is the faucet or the tipjar of the payment
+	ReferenceID string
+	Time        time.Time
+}
+
+// Handler reacts to a payment
+type Handler func(payment Payment)
+
+type subscriber struct {
+	name    string
+	kinds   []Kind
+	handler Handler
+}
+
+func (s subscriber) wants(kind Kind) bool {
+	if len(s.kinds) == 0 {
+		return true
+	}
+	for _, k := range s.kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+type Bus struct {
+	mu          sync.RWMutex
+	subscribers []subscriber
+}
+
+func NewBus() *Bus {
+	return &Bus{}
+}
+
+// Subscribe calls handler for every published payment of the kinds, or of all kinds if none are given
+func (b *Bus) Subscribe(name string, handler Handler, kinds ...Kind) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subscribers = append(b.subscribers, subscriber{name: name, kinds: kinds, handler: handler})
+}
+
+// Publish passes a payment to its subscribers
+func (b *Bus) Publish(payment Payment) {
+	if payment.Time.IsZero() {
+		payment.Time = time.Now()
+	}
+	b.mu.RLock()
+	subscribers := b.subscribers
+	b.mu.RUnlock()
+	for _, s := range subscribers {
+		if s.wants(payment.Kind) {
+			s.deliver(payment)
+		}
+	}
+}
+
+func (s subscriber) deliver(payment Payment) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Errorf("[events] Subscriber %s failed on %s: %v", s.name, payment.Kind, r)
+		}
+	}()
+	s.handler(payment)
+}
@@ -0,0 +1,28 @@
+package events
+
+import (
+	"testing"
+)
+
+func TestBus_Publish(t *testing.T) {
+	bus := NewBus()
+	var all, tips []Kind
+	bus.Subscribe("failing", func(payment Payment) { panic("boom") })
+	bus.Subscribe("all", func(payment Payment) { all = append(all, payment.Kind) })
+	bus.Subscribe("tips", func(payment Payment) {
+		if payment.Time.IsZero() {
+			t.Errorf("payment without time")
+		}
+		tips = append(tips, payment.Kind)
+	}, Tip)
+
+	bus.Publish(Payment{Kind: Tip, Amount: 21})
+	bus.Publish(Payment{Kind: Deposit, Amount: 1000})
+
+	if len(all) != 2 || all[0] != Tip || all[1] != Deposit {
+		t.Errorf("subscriber of all kinds got %v", all)
+	}
+	if len(tips) != 1 || tips[0] != Tip {
+		t.Errorf("subscriber of tips got %v", tips)
+	}
+}
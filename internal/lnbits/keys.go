@@ -0,0 +1,178 @@
+package lnbits
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// EncryptedKeyPrefix marks wallet keys that are encrypted in the database
+const EncryptedKeyPrefix = "enc:v1:"
+
+const (
+	dataKeySize  = 32
+	nonceSize    = 12
+	gcmTagSize   = 16
+	wrappedSize  = nonceSize + dataKeySize + gcmTagSize
+	masterKeyLen = 32
+)
+
+// masterKey wraps the data keys of all wallet keys. Keys are stored in plaintext if it is nil.
+var masterKey cipher.AEAD
+
+// WalletKey is an API key of a wallet. It is encrypted in the database if a master key is set
+// and never serialized to JSON, so that objects in BuntDB only keep a reference to the wallet.
+type WalletKey string
+
+// LoadMasterKey reads a hex or base64 encoded key of 32 bytes from the configuration or from a key file
+func LoadMasterKey(key, file string) ([]byte, error) {
+	if len(file) > 0 {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		key = string(b)
+	}
+	key = strings.TrimSpace(key)
+	if len(key) == 0 {
+		return nil, nil
+	}
+	decoded, err := hex.DecodeString(key)
+	if err != nil {
+		decoded, err = base64.StdEncoding.DecodeString(key)
+	}
+	if err != nil || len(decoded) != masterKeyLen {
+		return nil, fmt.Errorf("key encryption key must be %d bytes in hex or base64", masterKeyLen)
+	}
+	return decoded, nil
+}
+
+// SetMasterKey enables the encryption of wallet keys. A nil key disables it.
+func SetMasterKey(key []byte) error {
+	if key == nil {
+		masterKey = nil
+		return nil
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return err
+	}
+	masterKey = aead
+	return nil
+}
+
+// KeyEncryptionEnabled returns whether wallet keys are encrypted in the database
+func KeyEncryptionEnabled() bool {
+	return masterKey != nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	return b, err
+}
+
+// encryptKey encrypts a wallet key with a new data key that is wrapped with the master key
+func encryptKey(plaintext string) (string, error) {
+	dataKey, err := randomBytes(dataKeySize)
+	if err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	wrapNonce, err := randomBytes(nonceSize)
+	if err != nil {
+		return "", err
+	}
+	nonce, err := randomBytes(nonceSize)
+	if err != nil {
+		return "", err
+	}
+	out := masterKey.Seal(wrapNonce, wrapNonce, dataKey, nil)
+	out = append(out, nonce...)
+	out = dataAEAD.Seal(out, nonce, []byte(plaintext), nil)
+	return EncryptedKeyPrefix + base64.StdEncoding.EncodeToString(out), nil
+}
+
+// decryptKey unwraps the data key with the master key and decrypts the wallet key
+func decryptKey(encrypted string) (string, error) {
+	if masterKey == nil {
+		return "", fmt.Errorf("wallet key is encrypted but no key encryption key is configured")
+	}
+	b, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(encrypted, EncryptedKeyPrefix))
+	if err != nil {
+		return "", err
+	}
+	if len(b) < wrappedSize+nonceSize {
+		return "", fmt.Errorf("encrypted wallet key is too short")
+	}
+	dataKey, err := masterKey.Open(nil, b[:nonceSize], b[nonceSize:wrappedSize], nil)
+	if err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	nonce := b[wrappedSize : wrappedSize+nonceSize]
+	plaintext, err := dataAEAD.Open(nil, nonce, b[wrappedSize+nonceSize:], nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// MarshalJSON never writes the key
+func (k WalletKey) MarshalJSON() ([]byte, error) {
+	return []byte(`""`), nil
+}
+
+// Value encrypts the key for the database
+func (k WalletKey) Value() (driver.Value, error) {
+	if masterKey == nil || len(k) == 0 {
+		return string(k), nil
+	}
+	return encryptKey(string(k))
+}
+
+// Scan decrypts the key from the database. Keys in plaintext are read as they are.
+func (k *WalletKey) Scan(value interface{}) error {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		*k = ""
+		return nil
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	default:
+		return fmt.Errorf("cannot scan %T into a wallet key", value)
+	}
+	if !strings.HasPrefix(s, EncryptedKeyPrefix) {
+		*k = WalletKey(s)
+		return nil
+	}
+	plaintext, err := decryptKey(s)
+	if err != nil {
+		return err
+	}
+	*k = WalletKey(plaintext)
+	return nil
+}
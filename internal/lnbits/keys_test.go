@@ -0,0 +1,51 @@
+package lnbits
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestWalletKey(t *testing.T) {
+	key, err := LoadMasterKey(strings.Repeat("ab", 32), "")
+	if err != nil {
+		t.Fatalf("LoadMasterKey() error = %v", err)
+	}
+	if err = SetMasterKey(key); err != nil {
+		t.Fatalf("SetMasterKey() error = %v", err)
+	}
+	defer SetMasterKey(nil)
+
+	value, err := WalletKey("adminkey").Value()
+	if err != nil {
+		t.Fatalf("Value() error = %v", err)
+	}
+	encrypted := value.(string)
+	if !strings.HasPrefix(encrypted, EncryptedKeyPrefix) || strings.Contains(encrypted, "adminkey") {
+		t.Fatalf("Value() = %s is not encrypted", encrypted)
+	}
+	var k WalletKey
+	if err = k.Scan(encrypted); err != nil || k != "adminkey" {
+		t.Fatalf("Scan() = %s, %v", k, err)
+	}
+	// keys of rows that were not migrated yet are read in plaintext
+	if err = k.Scan([]byte("inkey")); err != nil || k != "inkey" {
+		t.Errorf("Scan() of plaintext = %s, %v", k, err)
+	}
+	if err = k.Scan(encrypted[:len(encrypted)-4] + "AAA="); err == nil {
+		t.Errorf("Scan() of a modified key did not fail")
+	}
+
+	b, err := json.Marshal(Wallet{ID: "id", Adminkey: "adminkey", Inkey: "inkey"})
+	if err != nil || strings.Contains(string(b), "adminkey\":\"adminkey") || strings.Contains(string(b), "\"inkey\":\"inkey") {
+		t.Errorf("json.Marshal() = %s, %v", b, err)
+	}
+
+	SetMasterKey(nil)
+	if err = k.Scan(encrypted); err == nil {
+		t.Errorf("Scan() without a master key did not fail")
+	}
+	if _, err = LoadMasterKey("short", ""); err == nil {
+		t.Errorf("LoadMasterKey() of a short key did not fail")
+	}
+}
@@ -1,6 +1,8 @@
 package lnbits
 
 import (
+	"net/url"
+
 	"github.com/imroc/req"
 )
 
@@ -87,7 +89,7 @@ func (w Wallet) Invoice(params InvoiceParams, c *Client) (lntx BitInvoice, err e
 	invoiceHeader := req.Header{
 		"Content-Type": "application/json",
 		"Accept":       "application/json",
-		"X-Api-Key":    w.Inkey,
+		"X-Api-Key":    string(w.Inkey),
 	}
 	resp, err := req.Post(c.url+"/api/v1/payments", invoiceHeader, req.BodyJSON(&params))
 	if err != nil {
@@ -105,13 +107,37 @@ func (w Wallet) Invoice(params InvoiceParams, c *Client) (lntx BitInvoice, err e
 	return
 }
 
+// Payment returns the status of a payment or an invoice of this wallet.
+func (w Wallet) Payment(paymentHash string, c *Client) (status PaymentStatus, err error) {
+	// custom header with invoice key
+	invoiceHeader := req.Header{
+		"Content-Type": "application/json",
+		"Accept":       "application/json",
+		"X-Api-Key":    string(w.Inkey),
+	}
+	resp, err := req.Get(c.url+"/api/v1/payments/"+url.PathEscape(paymentHash), invoiceHeader)
+	if err != nil {
+		return
+	}
+
+	if resp.Response().StatusCode >= 300 {
+		var reqErr Error
+		resp.ToJSON(&reqErr)
+		err = reqErr
+		return
+	}
+
+	err = resp.ToJSON(&status)
+	return
+}
+
 // Info returns wallet information
 func (c Client) Info(w Wallet) (wtx Wallet, err error) {
 	// custom header with invoice key
 	invoiceHeader := req.Header{
 		"Content-Type": "application/json",
 		"Accept":       "application/json",
-		"X-Api-Key":    w.Inkey,
+		"X-Api-Key":    string(w.Inkey),
 	}
 	resp, err := req.Get(c.url+"/api/v1/wallet", invoiceHeader, nil)
 	if err != nil {
@@ -153,7 +179,7 @@ func (w Wallet) Pay(params PaymentParams, c *Client) (wtx BitInvoice, err error)
 	adminHeader := req.Header{
 		"Content-Type": "application/json",
 		"Accept":       "application/json",
-		"X-Api-Key":    w.Adminkey,
+		"X-Api-Key":    string(w.Adminkey),
 	}
 	resp, err := req.Post(c.url+"/api/v1/payments", adminHeader, req.BodyJSON(&params))
 	if err != nil {
@@ -170,3 +196,51 @@ func (w Wallet) Pay(params PaymentParams, c *Client) (wtx BitInvoice, err error)
 	err = resp.ToJSON(&wtx)
 	return
 }
+
+// RenameWallet renames a wallet.
+func (c Client) RenameWallet(w Wallet, name string) (wtx Wallet, err error) {
+	// custom header with admin key
+	adminHeader := req.Header{
+		"Content-Type": "application/json",
+		"Accept":       "application/json",
+		"X-Api-Key":    string(w.Adminkey),
+	}
+	resp, err := req.Put(c.url+"/api/v1/wallet/"+url.PathEscape(name), adminHeader, nil)
+	if err != nil {
+		return
+	}
+
+	if resp.Response().StatusCode >= 300 {
+		var reqErr Error
+		resp.ToJSON(&reqErr)
+		err = reqErr
+		return
+	}
+
+	err = resp.ToJSON(&wtx)
+	return
+}
+
+// ResetWalletKeys replaces the admin key and the invoice key of a wallet. The old keys stop working.
+func (c Client) ResetWalletKeys(w Wallet) (wtx Wallet, err error) {
+	// custom header with admin key
+	adminHeader := req.Header{
+		"Content-Type": "application/json",
+		"Accept":       "application/json",
+		"X-Api-Key":    string(w.Adminkey),
+	}
+	resp, err := req.Put(c.url+"/api/v1/wallet/reset", adminHeader, nil)
+	if err != nil {
+		return
+	}
+
+	if resp.Response().StatusCode >= 300 {
+		var reqErr Error
+		resp.ToJSON(&reqErr)
+		err = reqErr
+		return
+	}
+
+	err = resp.ToJSON(&wtx)
+	return
+}
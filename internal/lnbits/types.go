@@ -15,16 +15,18 @@ type Client struct {
 }
 
 type User struct {
-	ID          string       `json:"id"`
-	Name        string       `json:"name" gorm:"primaryKey"`
-	Initialized bool         `json:"initialized"`
-	Telegram    *tb.User     `gorm:"embedded;embeddedPrefix:telegram_"`
-	Wallet      *Wallet      `gorm:"embedded;embeddedPrefix:wallet_"`
-	StateKey    UserStateKey `json:"stateKey"`
-	StateData   string       `json:"stateData"`
-	CreatedAt   time.Time    `json:"created"`
-	UpdatedAt   time.Time    `json:"updated"`
-	AnonID      string       `jsin:"anonid"`
+	ID            string       `json:"id"`
+	Name          string       `json:"name" gorm:"primaryKey"`
+	Initialized   bool         `json:"initialized"`
+	Telegram      *tb.User     `gorm:"embedded;embeddedPrefix:telegram_"`
+	Wallet        *Wallet      `gorm:"embedded;embeddedPrefix:wallet_"`
+	DefaultWallet *Wallet      `gorm:"embedded;embeddedPrefix:default_wallet_"`
+	StateKey      UserStateKey `json:"stateKey"`
+	StateData     string       `json:"stateData"`
+	CreatedAt     time.Time    `json:"created"`
+	UpdatedAt     time.Time    `json:"updated"`
+	AnonID        string       `jsin:"anonid"`
+	TimeZone      string       `json:"timezone"`
 }
 
 const (
@@ -34,10 +36,30 @@ const (
 	UserStateConfirmLNURLPay
 	UserEnterAmount
 	UserHasEnteredAmount
+	UserEnterPin
 )
 
 type UserStateKey int
 
+// LightningAddressWallet returns the wallet that is credited by payments to the Lightning address
+func (u *User) LightningAddressWallet() *Wallet {
+	if u.DefaultWallet != nil && len(u.DefaultWallet.ID) > 0 {
+		return u.DefaultWallet
+	}
+	return u.Wallet
+}
+
+// Ref returns a reference to the user for objects that are stored in BuntDB
+func (u *User) Ref() UserRef {
+	return UserRef{TelegramID: u.Telegram.ID}
+}
+
+// UserRef references a user in objects that are stored in BuntDB. The user with its wallet
+// keys is loaded from the database when the object is used.
+type UserRef struct {
+	TelegramID int `json:"telegram_id"`
+}
+
 func (u *User) ResetState() {
 	u.StateData = ""
 	u.StateKey = 0
@@ -81,14 +103,29 @@ func (err Error) Error() string {
 }
 
 type Wallet struct {
-	ID       string `json:"id" gorm:"id"`
-	Adminkey string `json:"adminkey"`
-	Inkey    string `json:"inkey"`
-	Balance  int64  `json:"balance"`
-	Name     string `json:"name"`
-	User     string `json:"user"`
+	ID       string    `json:"id" gorm:"id"`
+	Adminkey WalletKey `json:"adminkey"`
+	Inkey    WalletKey `json:"inkey"`
+	Balance  int64     `json:"balance"`
+	Name     string    `json:"name"`
+	User     string    `json:"user"`
 }
 type BitInvoice struct {
 	PaymentHash    string `json:"payment_hash"`
 	PaymentRequest string `json:"payment_request"`
 }
+
+// PaymentStatus is the status of a payment or an invoice, amounts are in msat
+type PaymentStatus struct {
+	Paid     bool   `json:"paid"`
+	Preimage string `json:"preimage"`
+	Details  struct {
+		Amount      int64  `json:"amount"`
+		Fee         int64  `json:"fee"`
+		Memo        string `json:"memo"`
+		Time        int64  `json:"time"`
+		Bolt11      string `json:"bolt11"`
+		PaymentHash string `json:"payment_hash"`
+		Pending     bool   `json:"pending"`
+	} `json:"details"`
+}
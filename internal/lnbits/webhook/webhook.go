@@ -2,10 +2,9 @@ package webhook
 
 import (
 	"encoding/json"
-	"fmt"
 	"github.com/LightningTipBot/LightningTipBot/internal"
+	"github.com/LightningTipBot/LightningTipBot/internal/events"
 	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
-	"github.com/LightningTipBot/LightningTipBot/internal/str"
 	"github.com/LightningTipBot/LightningTipBot/internal/telegram"
 	"time"
 
@@ -18,8 +17,6 @@ import (
 
 	"github.com/gorilla/mux"
 	tb "gopkg.in/tucnak/telebot.v2"
-
-	"github.com/LightningTipBot/LightningTipBot/internal/i18n"
 )
 
 const (
@@ -28,6 +25,7 @@ const (
 
 type Server struct {
 	httpServer *http.Server
+	tipbot     *telegram.TipBot
 	bot        *tb.Bot
 	c          *lnbits.Client
 	database   *gorm.DB
@@ -59,6 +57,7 @@ func NewServer(bot *telegram.TipBot) *Server {
 		ReadTimeout:  15 * time.Second,
 	}
 	apiServer := &Server{
+		tipbot:     bot,
 		c:          bot.Client,
 		database:   bot.Database,
 		bot:        bot.Telegram,
@@ -73,7 +72,16 @@ func NewServer(bot *telegram.TipBot) *Server {
 
 func (w *Server) GetUserByWalletId(walletId string) (*lnbits.User, error) {
 	user := &lnbits.User{}
-	tx := w.database.Where("wallet_id = ?", walletId).First(user)
+	tx := w.database.Where("wallet_id = ? OR default_wallet_id = ?", walletId, walletId).First(user)
+	if tx.Error == nil {
+		return user, nil
+	}
+	// the other wallets of a user are resolved through their owner
+	owner := &telegram.WalletOwner{WalletID: walletId}
+	if err := w.buntdb.Get(owner); err != nil {
+		return user, tx.Error
+	}
+	tx = w.database.Where("id = ?", owner.UserID).First(user)
 	if tx.Error != nil {
 		return user, tx.Error
 	}
@@ -100,24 +108,14 @@ func (w Server) receive(writer http.ResponseWriter, request *http.Request) {
 		writer.WriteHeader(400)
 		return
 	}
-	log.Infoln(fmt.Sprintf("[WebHook] User %s (%d) received invoice of %d sat.", user.Telegram.Username, user.Telegram.ID, depositEvent.Amount/1000))
-	_, err = w.bot.Send(user.Telegram, fmt.Sprintf(i18n.Translate(user.Telegram.LanguageCode, "invoiceReceivedMessage"), depositEvent.Amount/1000))
-	if err != nil {
-		log.Errorln(err)
-	}
-
-	// if this invoice is saved in bunt.db, we load it and display the comment from an LNURL invoice
+	payment := events.Payment{Kind: events.Deposit, To: user, Amount: depositEvent.Amount / 1000, PaymentHash: depositEvent.PaymentHash}
+	// if this invoice is saved in bunt.db, we load it and pass on the comment from an LNURL invoice
 	tx := &lnurl.Invoice{PaymentHash: depositEvent.PaymentHash}
-	err = w.buntdb.Get(tx)
-	if err != nil {
-		log.Errorln(err)
-	} else {
-		if len(tx.Comment) > 0 {
-			_, err = w.bot.Send(user.Telegram, fmt.Sprintf(`✉️ %s`, str.MarkdownEscape(tx.Comment)))
-			if err != nil {
-				log.Errorln(err)
-			}
-		}
+	if err = w.buntdb.Get(tx); err == nil {
+		payment.Memo = tx.Comment
 	}
+	w.tipbot.Events.Publish(payment)
+	// if this invoice is the fee of a chat join request, the applicant is admitted
+	w.tipbot.JoinRequestInvoicePaid(depositEvent.PaymentHash, depositEvent.WalletID)
 	writer.WriteHeader(200)
 }
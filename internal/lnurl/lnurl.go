@@ -18,14 +18,14 @@ import (
 )
 
 type Invoice struct {
-	PaymentRequest string       `json:"payment_request"`
-	PaymentHash    string       `json:"payment_hash"`
-	Amount         int64        `json:"amount"`
-	Comment        string       `json:"comment"`
-	ToUser         *lnbits.User `json:"to_user"`
-	CreatedAt      time.Time    `json:"created_at"`
-	Paid           bool         `json:"paid"`
-	PaidAt         time.Time    `json:"paid_at"`
+	PaymentRequest string         `json:"payment_request"`
+	PaymentHash    string         `json:"payment_hash"`
+	Amount         int64          `json:"amount"`
+	Comment        string         `json:"comment"`
+	ToUser         lnbits.UserRef `json:"to_user"`
+	CreatedAt      time.Time      `json:"created_at"`
+	Paid           bool           `json:"paid"`
+	PaidAt         time.Time      `json:"paid_at"`
 }
 
 func (msg Invoice) Key() string {
@@ -160,7 +160,7 @@ func (w Server) serveLNURLpSecond(username string, amount int64, comment string)
 	if err != nil {
 		return nil, err
 	}
-	invoice, err := user.Wallet.Invoice(
+	invoice, err := user.LightningAddressWallet().Invoice(
 		lnbits.InvoiceParams{
 			Amount:          amount / 1000,
 			Out:             false,
@@ -179,7 +179,7 @@ func (w Server) serveLNURLpSecond(username string, amount int64, comment string)
 	// save invoice struct for later use
 	runtime.IgnoreError(w.buntdb.Set(
 		Invoice{
-			ToUser:         user,
+			ToUser:         user.Ref(),
 			Amount:         amount,
 			Comment:        comment,
 			PaymentRequest: invoice.PaymentRequest,
@@ -0,0 +1,171 @@
+package nostr
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Event is a signed Nostr event, see NIP-01
+type Event struct {
+	ID        string     `json:"id"`
+	PubKey    string     `json:"pubkey"`
+	CreatedAt int64      `json:"created_at"`
+	Kind      int        `json:"kind"`
+	Tags      [][]string `json:"tags"`
+	Content   string     `json:"content"`
+	Sig       string     `json:"sig"`
+}
+
+// Filter selects the events of a subscription
+type Filter struct {
+	IDs     []string            `json:"ids,omitempty"`
+	Authors []string            `json:"authors,omitempty"`
+	Kinds   []int               `json:"kinds,omitempty"`
+	Tags    map[string][]string `json:"-"`
+	Since   int64               `json:"since,omitempty"`
+}
+
+// MarshalJSON writes the tag filters as "#<tag>" fields
+func (f Filter) MarshalJSON() ([]byte, error) {
+	type filter Filter
+	b, err := json.Marshal(filter(f))
+	if err != nil || len(f.Tags) == 0 {
+		return b, err
+	}
+	fields := make(map[string]interface{})
+	if err = json.Unmarshal(b, &fields); err != nil {
+		return nil, err
+	}
+	for tag, values := range f.Tags {
+		fields["#"+tag] = values
+	}
+	return json.Marshal(fields)
+}
+
+// Matches checks whether an event is selected by the filter
+func (f Filter) Matches(e *Event) bool {
+	if len(f.IDs) > 0 && !contains(f.IDs, e.ID) {
+		return false
+	}
+	if len(f.Authors) > 0 && !contains(f.Authors, e.PubKey) {
+		return false
+	}
+	if len(f.Kinds) > 0 {
+		found := false
+		for _, kind := range f.Kinds {
+			found = found || kind == e.Kind
+		}
+		if !found {
+			return false
+		}
+	}
+	for tag, values := range f.Tags {
+		found := false
+		for _, value := range values {
+			found = found || contains(e.TagValues(tag), value)
+		}
+		if !found {
+			return false
+		}
+	}
+	return f.Since == 0 || e.CreatedAt >= f.Since
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// NewEvent returns an unsigned event that was created now
+func NewEvent(kind int, content string, tags ...[]string) *Event {
+	if tags == nil {
+		tags = make([][]string, 0)
+	}
+	return &Event{CreatedAt: time.Now().Unix(), Kind: kind, Tags: tags, Content: content}
+}
+
+// TagValues returns the first values of all tags with a name
+func (e *Event) TagValues(name string) []string {
+	var values []string
+	for _, tag := range e.Tags {
+		if len(tag) > 1 && tag[0] == name {
+			values = append(values, tag[1])
+		}
+	}
+	return values
+}
+
+// serialize returns the canonical JSON of the event that its ID is computed from
+func (e *Event) serialize() ([]byte, error) {
+	tags := e.Tags
+	if tags == nil {
+		tags = make([][]string, 0)
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	// NIP-01 doesn't escape HTML characters
+	enc.SetEscapeHTML(false)
+	err := enc.Encode([]interface{}{0, e.PubKey, e.CreatedAt, e.Kind, tags, e.Content})
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func (e *Event) hash() ([]byte, error) {
+	b, err := e.serialize()
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.Sum256(b)
+	return h[:], nil
+}
+
+// Sign sets the public key, the ID and the signature of the event
+func (e *Event) Sign(sk string) error {
+	pk, err := GetPublicKey(sk)
+	if err != nil {
+		return err
+	}
+	e.PubKey = pk
+	h, err := e.hash()
+	if err != nil {
+		return err
+	}
+	aux := make([]byte, 32)
+	if _, err = rand.Read(aux); err != nil {
+		return err
+	}
+	sig, err := signSchnorr(sk, h, aux)
+	if err != nil {
+		return err
+	}
+	e.ID = hex.EncodeToString(h)
+	e.Sig = hex.EncodeToString(sig)
+	return nil
+}
+
+// Verify checks the ID and the signature of the event
+func (e *Event) Verify() error {
+	h, err := e.hash()
+	if err != nil {
+		return err
+	}
+	if hex.EncodeToString(h) != e.ID {
+		return fmt.Errorf("invalid event id")
+	}
+	sig, err := hex.DecodeString(e.Sig)
+	if err != nil || !verifySchnorr(e.PubKey, h, sig) {
+		return fmt.Errorf("invalid event signature")
+	}
+	return nil
+}
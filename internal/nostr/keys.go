@@ -0,0 +1,56 @@
+package nostr
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// GeneratePrivateKey returns a new private key in hex
+func GeneratePrivateKey() (string, error) {
+	key, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(key.Serialize()), nil
+}
+
+// GetPublicKey returns the x-only public key of a private key in hex
+func GetPublicKey(sk string) (string, error) {
+	key, err := parsePrivateKey(sk)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(serializePublicKey(key.PubKey())), nil
+}
+
+func parsePrivateKey(sk string) (*secp256k1.PrivateKey, error) {
+	b, err := hex.DecodeString(sk)
+	if err != nil || len(b) != 32 {
+		return nil, fmt.Errorf("invalid private key")
+	}
+	var d secp256k1.ModNScalar
+	if overflow := d.SetByteSlice(b); overflow || d.IsZero() {
+		return nil, fmt.Errorf("invalid private key")
+	}
+	return secp256k1.NewPrivateKey(&d), nil
+}
+
+// parsePublicKey returns the point of an x-only public key, the one with the even y coordinate
+func parsePublicKey(pk string) (*secp256k1.PublicKey, error) {
+	b, err := hex.DecodeString(pk)
+	if err != nil || len(b) != 32 {
+		return nil, fmt.Errorf("invalid public key")
+	}
+	key, err := secp256k1.ParsePubKey(append([]byte{secp256k1.PubKeyFormatCompressedEven}, b...))
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key")
+	}
+	return key, nil
+}
+
+// serializePublicKey returns the x-only encoding of a public key
+func serializePublicKey(key *secp256k1.PublicKey) []byte {
+	return key.SerializeCompressed()[1:]
+}
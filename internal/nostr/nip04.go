@@ -0,0 +1,78 @@
+package nostr
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+// sharedSecret is the x coordinate of the ECDH point of a private and a public key, see NIP-04
+func sharedSecret(sk, pk string) ([]byte, error) {
+	key, err := parsePrivateKey(sk)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := parsePublicKey(pk)
+	if err != nil {
+		return nil, err
+	}
+	return secp256k1.GenerateSharedSecret(key, pub), nil
+}
+
+// Encrypt encrypts a direct message from the owner of sk to pk with NIP-04
+func Encrypt(sk, pk, plaintext string) (string, error) {
+	key, err := sharedSecret(sk, pk)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err = rand.Read(iv); err != nil {
+		return "", err
+	}
+	padding := aes.BlockSize - len(plaintext)%aes.BlockSize
+	padded := append([]byte(plaintext), bytes.Repeat([]byte{byte(padding)}, padding)...)
+	ciphertext := make([]byte, len(padded))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, padded)
+	return base64.StdEncoding.EncodeToString(ciphertext) + "?iv=" + base64.StdEncoding.EncodeToString(iv), nil
+}
+
+// Decrypt decrypts a direct message from pk to the owner of sk with NIP-04
+func Decrypt(sk, pk, content string) (string, error) {
+	parts := strings.Split(content, "?iv=")
+	if len(parts) != 2 {
+		return "", fmt.Errorf("invalid encrypted content")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(parts[0])
+	if err != nil {
+		return "", err
+	}
+	iv, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil || len(iv) != aes.BlockSize || len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return "", fmt.Errorf("invalid encrypted content")
+	}
+	key, err := sharedSecret(sk, pk)
+	if err != nil {
+		return "", err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return "", err
+	}
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plaintext, ciphertext)
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize || padding > len(plaintext) {
+		return "", fmt.Errorf("invalid padding")
+	}
+	return string(plaintext[:len(plaintext)-padding]), nil
+}
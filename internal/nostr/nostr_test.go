@@ -0,0 +1,88 @@
+package nostr
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestSchnorr(t *testing.T) {
+	// test vector 0 of BIP340
+	sk := "0000000000000000000000000000000000000000000000000000000000000003"
+	pk, err := GetPublicKey(sk)
+	if err != nil || pk != "f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9" {
+		t.Fatalf("GetPublicKey() = %s, %v", pk, err)
+	}
+	msg := make([]byte, 32)
+	sig, err := signSchnorr(sk, msg, make([]byte, 32))
+	want := "e907831f80848d1069a5371b402410364bdf1c5f8307b0084c55f1ce2dca821525f66a4a85ea8b71e482a74f382d2ce5ebeee8fdb2172f477df4900d310536c0"
+	if err != nil || hex.EncodeToString(sig) != want {
+		t.Fatalf("signSchnorr() = %x, %v", sig, err)
+	}
+	if !verifySchnorr(pk, msg, sig) {
+		t.Errorf("verifySchnorr() of a valid signature failed")
+	}
+	msg[0] = 1
+	if verifySchnorr(pk, msg, sig) {
+		t.Errorf("verifySchnorr() of another message succeeded")
+	}
+
+	// test vector 1 of BIP340
+	sk = "b7e151628aed2a6abf7158809cf4f3c762e7160f38b4da56a784d9045190cfef"
+	pk, _ = GetPublicKey(sk)
+	msg, _ = hex.DecodeString("243f6a8885a308d313198a2e03707344a4093822299f31d0082efa98ec4e6c89")
+	aux := make([]byte, 32)
+	aux[31] = 1
+	sig, err = signSchnorr(sk, msg, aux)
+	want = "6896bd60eeae296db48a229ff71dfe071bde413e6d43f917dc8dcf8c78de33418906d11ac976abccb20b091292bff4ea897efcb639ea871cfa95f6de339e4b0a"
+	if err != nil || pk != "dff1d77f2a671c5f36183726db2341be58feae1da2deced843240f7b502ba659" || hex.EncodeToString(sig) != want {
+		t.Fatalf("signSchnorr() = %x, %v", sig, err)
+	}
+	if !verifySchnorr(pk, msg, sig) {
+		t.Errorf("verifySchnorr() of a valid signature failed")
+	}
+}
+
+func TestEvent(t *testing.T) {
+	sk, _ := GeneratePrivateKey()
+	e := NewEvent(1, "<hello> & \"world\"", []string{"p", "abc"})
+	if err := e.Sign(sk); err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+	if err := e.Verify(); err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	e.Content = "changed"
+	if err := e.Verify(); err == nil {
+		t.Errorf("Verify() of a changed event succeeded")
+	}
+	f := Filter{Kinds: []int{1}, Tags: map[string][]string{"p": {"abc"}}}
+	if b, _ := json.Marshal(f); !strings.Contains(string(b), `"#p":["abc"]`) {
+		t.Errorf("json.Marshal(filter) = %s", b)
+	}
+	if !f.Matches(e) || (Filter{Authors: []string{"abc"}}).Matches(e) {
+		t.Errorf("Matches() of %+v is wrong", e)
+	}
+}
+
+func TestNip04(t *testing.T) {
+	alice, _ := GeneratePrivateKey()
+	bob, _ := GeneratePrivateKey()
+	alicePk, _ := GetPublicKey(alice)
+	bobPk, _ := GetPublicKey(bob)
+	content, err := Encrypt(alice, bobPk, `{"method":"get_balance"}`)
+	if err != nil {
+		t.Fatalf("Encrypt() error = %v", err)
+	}
+	plaintext, err := Decrypt(bob, alicePk, content)
+	if err != nil || plaintext != `{"method":"get_balance"}` {
+		t.Errorf("Decrypt() = %s, %v", plaintext, err)
+	}
+	if _, err = Decrypt(bob, bobPk, content); err == nil {
+		plaintext, _ = Decrypt(bob, bobPk, content)
+		if plaintext == `{"method":"get_balance"}` {
+			t.Errorf("Decrypt() with the wrong key succeeded")
+		}
+	}
+}
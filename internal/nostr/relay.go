@@ -0,0 +1,186 @@
+package nostr
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/websocket"
+)
+
+// Relay publishes and subscribes to events
+type Relay interface {
+	// Publish sends an event and waits until the relay accepted it
+	Publish(ctx context.Context, event *Event) error
+	// Subscribe returns the events that match the filters until ctx is done.
+	// The channel is closed when the subscription ends or the connection is lost.
+	Subscribe(ctx context.Context, filters ...Filter) (<-chan *Event, error)
+	Close() error
+}
+
+// WebsocketRelay is a connection to a relay, see NIP-01
+type WebsocketRelay struct {
+	url           string
+	conn          *websocket.Conn
+	writeMutex    sync.Mutex
+	mutex         sync.Mutex
+	subscriptions map[string]chan *Event
+	published     map[string]chan error
+	closed        chan struct{}
+}
+
+// ConnectRelay connects to a relay URL like wss://relay.example.com
+func ConnectRelay(url string) (*WebsocketRelay, error) {
+	conn, err := websocket.Dial(url, "", "http://localhost/")
+	if err != nil {
+		return nil, err
+	}
+	r := &WebsocketRelay{
+		url:           url,
+		conn:          conn,
+		subscriptions: make(map[string]chan *Event),
+		published:     make(map[string]chan error),
+		closed:        make(chan struct{}),
+	}
+	go r.read()
+	return r, nil
+}
+
+func (r *WebsocketRelay) send(message ...interface{}) error {
+	r.writeMutex.Lock()
+	defer r.writeMutex.Unlock()
+	return websocket.JSON.Send(r.conn, message)
+}
+
+// read dispatches the messages of the relay until the connection is lost
+func (r *WebsocketRelay) read() {
+	defer func() {
+		r.mutex.Lock()
+		for id, events := range r.subscriptions {
+			close(events)
+			delete(r.subscriptions, id)
+		}
+		r.mutex.Unlock()
+		close(r.closed)
+	}()
+	for {
+		var message []json.RawMessage
+		err := websocket.JSON.Receive(r.conn, &message)
+		if err != nil {
+			log.Warnf("[nostr] Connection to %s lost: %s", r.url, err)
+			return
+		}
+		var label string
+		if len(message) < 2 || json.Unmarshal(message[0], &label) != nil {
+			continue
+		}
+		switch label {
+		case "EVENT":
+			var id string
+			event := &Event{}
+			if len(message) < 3 || json.Unmarshal(message[1], &id) != nil || json.Unmarshal(message[2], event) != nil {
+				continue
+			}
+			// the subscription can't be closed while the event is delivered
+			r.mutex.Lock()
+			if events, ok := r.subscriptions[id]; ok {
+				select {
+				case events <- event:
+				default:
+					log.Warnf("[nostr] Dropped event %s of subscription %s", event.ID, id)
+				}
+			}
+			r.mutex.Unlock()
+		case "OK":
+			var id, reason string
+			var accepted bool
+			if len(message) < 3 || json.Unmarshal(message[1], &id) != nil || json.Unmarshal(message[2], &accepted) != nil {
+				continue
+			}
+			if len(message) > 3 {
+				_ = json.Unmarshal(message[3], &reason)
+			}
+			r.mutex.Lock()
+			result, ok := r.published[id]
+			delete(r.published, id)
+			r.mutex.Unlock()
+			if ok {
+				if accepted {
+					result <- nil
+				} else {
+					result <- fmt.Errorf("event rejected: %s", reason)
+				}
+			}
+		case "NOTICE":
+			var notice string
+			_ = json.Unmarshal(message[1], &notice)
+			log.Infof("[nostr] Notice from %s: %s", r.url, notice)
+		}
+	}
+}
+
+func (r *WebsocketRelay) Publish(ctx context.Context, event *Event) error {
+	result := make(chan error, 1)
+	r.mutex.Lock()
+	r.published[event.ID] = result
+	r.mutex.Unlock()
+	defer func() {
+		r.mutex.Lock()
+		delete(r.published, event.ID)
+		r.mutex.Unlock()
+	}()
+	if err := r.send("EVENT", event); err != nil {
+		return err
+	}
+	select {
+	case err := <-result:
+		return err
+	case <-r.closed:
+		return fmt.Errorf("connection to %s lost", r.url)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *WebsocketRelay) Subscribe(ctx context.Context, filters ...Filter) (<-chan *Event, error) {
+	b := make([]byte, 8)
+	rand.Read(b)
+	id := hex.EncodeToString(b)
+	events := make(chan *Event, 100)
+	r.mutex.Lock()
+	r.subscriptions[id] = events
+	r.mutex.Unlock()
+	message := []interface{}{"REQ", id}
+	for _, filter := range filters {
+		message = append(message, filter)
+	}
+	if err := r.send(message...); err != nil {
+		r.mutex.Lock()
+		delete(r.subscriptions, id)
+		r.mutex.Unlock()
+		return nil, err
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-r.closed:
+			return
+		}
+		_ = r.send("CLOSE", id)
+		r.mutex.Lock()
+		if _, ok := r.subscriptions[id]; ok {
+			close(events)
+			delete(r.subscriptions, id)
+		}
+		r.mutex.Unlock()
+	}()
+	return events, nil
+}
+
+func (r *WebsocketRelay) Close() error {
+	return r.conn.Close()
+}
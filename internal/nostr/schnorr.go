@@ -0,0 +1,115 @@
+// Copyright (c) 2013-2022 The btcsuite developers
+// Use of this source code is governed by an ISC
+// license that can be found at
+// https://github.com/btcsuite/btcd/blob/master/LICENSE.
+
+package nostr
+
+// The BIP340 signatures are adapted from the schnorr package of btcec/v2
+// (github.com/btcsuite/btcd/btcec/v2/schnorr), which builds on the same
+// secp256k1 package. btcec/v2 itself can't be required next to the btcd
+// version of lnd because both provide chaincfg/chainhash.
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+)
+
+func taggedHash(tag string, data ...[]byte) *[32]byte {
+	tagHash := sha256.Sum256([]byte(tag))
+	h := sha256.New()
+	h.Write(tagHash[:])
+	h.Write(tagHash[:])
+	for _, d := range data {
+		h.Write(d)
+	}
+	var hash [32]byte
+	copy(hash[:], h.Sum(nil))
+	return &hash
+}
+
+// signSchnorr signs a 32 byte message with BIP340 and the auxiliary randomness aux
+func signSchnorr(sk string, msg, aux []byte) ([]byte, error) {
+	if len(msg) != 32 || len(aux) != 32 {
+		return nil, fmt.Errorf("invalid message")
+	}
+	key, err := parsePrivateKey(sk)
+	if err != nil {
+		return nil, err
+	}
+	// negate d if P.y is odd
+	d := key.Key
+	pubBytes := key.PubKey().SerializeCompressed()
+	if pubBytes[0] == secp256k1.PubKeyFormatCompressedOdd {
+		d.Negate()
+	}
+	// t = bytes(d) xor tagged_hash("BIP0340/aux", a)
+	dBytes := d.Bytes()
+	t := taggedHash("BIP0340/aux", aux)
+	for i := range t {
+		t[i] ^= dBytes[i]
+	}
+	// k' = int(tagged_hash("BIP0340/nonce", t || bytes(P) || m)) mod n, fail if k' = 0
+	var k secp256k1.ModNScalar
+	k.SetBytes(taggedHash("BIP0340/nonce", t[:], pubBytes[1:], msg))
+	if k.IsZero() {
+		return nil, fmt.Errorf("invalid nonce")
+	}
+	// R = k'⋅G, negate k if R.y is odd
+	var R secp256k1.JacobianPoint
+	secp256k1.ScalarBaseMultNonConst(&k, &R)
+	R.ToAffine()
+	if R.Y.IsOdd() {
+		k.Negate()
+	}
+	// e = int(tagged_hash("BIP0340/challenge", bytes(R) || bytes(P) || m)) mod n
+	var e secp256k1.ModNScalar
+	e.SetBytes(taggedHash("BIP0340/challenge", R.X.Bytes()[:], pubBytes[1:], msg))
+	// sig = bytes(R) || bytes((k + e⋅d) mod n)
+	s := new(secp256k1.ModNScalar).Mul2(&e, &d).Add(&k)
+	k.Zero()
+	d.Zero()
+	sBytes := s.Bytes()
+	sig := append(R.X.Bytes()[:], sBytes[:]...)
+	// never hand out a signature that does not verify
+	if !verifySchnorr(hex.EncodeToString(pubBytes[1:]), msg, sig) {
+		return nil, fmt.Errorf("invalid signature")
+	}
+	return sig, nil
+}
+
+// verifySchnorr verifies a BIP340 signature of a 32 byte message
+func verifySchnorr(pk string, msg, sig []byte) bool {
+	pub, err := parsePublicKey(pk)
+	if err != nil || len(msg) != 32 || len(sig) != 64 {
+		return false
+	}
+	// fail if r >= p or s >= n
+	var r secp256k1.FieldVal
+	if overflow := r.SetByteSlice(sig[:32]); overflow {
+		return false
+	}
+	var s secp256k1.ModNScalar
+	if overflow := s.SetByteSlice(sig[32:]); overflow {
+		return false
+	}
+	// e = int(tagged_hash("BIP0340/challenge", bytes(r) || bytes(P) || m)) mod n
+	var e secp256k1.ModNScalar
+	e.SetBytes(taggedHash("BIP0340/challenge", sig[:32], serializePublicKey(pub), msg))
+	// R = s⋅G - e⋅P
+	e.Negate()
+	var P, R, sG, eP secp256k1.JacobianPoint
+	pub.AsJacobian(&P)
+	secp256k1.ScalarBaseMultNonConst(&s, &sG)
+	secp256k1.ScalarMultNonConst(&e, &P, &eP)
+	secp256k1.AddNonConst(&sG, &eP, &R)
+	// fail if R is infinite or R.y is odd, succeed if R.x = r
+	if (R.X.IsZero() && R.Y.IsZero()) || R.Z.IsZero() {
+		return false
+	}
+	R.ToAffine()
+	return !R.Y.IsOdd() && r.Equals(&R.X)
+}
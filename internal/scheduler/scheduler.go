@@ -0,0 +1,299 @@
+// Package scheduler runs jobs at a given time. Jobs are stored in BuntDB so that
+// they survive restarts.
+//
+// A job is executed at least once: it is only removed after its handler returned
+// without an error, handlers must therefore be idempotent. Failed jobs are retried
+// with an exponential backoff and kept as dead jobs after MaxAttempts. Recurring
+// jobs are rescheduled after every run instead.
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
+	"github.com/LightningTipBot/LightningTipBot/internal/storage"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/buntdb"
+)
+
+const (
+	jobKeyBase     = "job:"
+	deadJobKeyBase = "job-dead:"
+	runAtIndex     = "job_run_at"
+)
+
+// Handler executes a job. A returned error schedules a retry.
+type Handler func(job *Job) error
+
+// Job is a unit of work of a registered type. The payload is decoded by the handler.
+type Job struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Payload   json.RawMessage `json:"payload"`
+	RunAt     int64           `json:"run_at"` // unix time in milliseconds, indexed
+	Interval  time.Duration   `json:"interval,omitempty"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error,omitempty"`
+	CreatedAt time.Time       `json:"created"`
+}
+
+func (job Job) Key() string {
+	return jobKeyBase + job.ID
+}
+
+// Decode unmarshals the payload of the job into v
+func (job Job) Decode(v interface{}) error {
+	return json.Unmarshal(job.Payload, v)
+}
+
+type Scheduler struct {
+	db           *storage.DB
+	PollInterval time.Duration
+	MaxAttempts  int
+	Backoff      time.Duration // delay of the first retry, doubled for every further attempt
+	MaxBackoff   time.Duration
+	BatchSize    int // maximum number of jobs executed per poll
+	Workers      int // maximum number of jobs executed at the same time
+	mu           sync.RWMutex
+	handlers     map[string]Handler
+	wake         chan struct{}
+	stop         chan struct{}
+	counter      uint64
+}
+
+// New creates a scheduler that stores its jobs in db
+func New(db *storage.DB) *Scheduler {
+	err := db.CreateIndex(runAtIndex, jobKeyBase+"*", buntdb.IndexJSON("run_at"))
+	if err != nil && err != buntdb.ErrIndexExists {
+		panic(err)
+	}
+	return &Scheduler{
+		db:           db,
+		PollInterval: time.Second,
+		MaxAttempts:  5,
+		Backoff:      10 * time.Second,
+		MaxBackoff:   time.Hour,
+		BatchSize:    100,
+		Workers:      10,
+		handlers:     make(map[string]Handler),
+		wake:         make(chan struct{}, 1),
+		stop:         make(chan struct{}),
+	}
+}
+
+// Register sets the handler of a job type. All handlers must be registered before Start.
+func (s *Scheduler) Register(jobType string, handler Handler) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.handlers[jobType] = handler
+}
+
+// Schedule stores a job of the given type that runs at runAt
+func (s *Scheduler) Schedule(jobType string, runAt time.Time, payload interface{}) (*Job, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	job := &Job{
+		ID:        fmt.Sprintf("%s-%d-%d", jobType, time.Now().UnixNano(), atomic.AddUint64(&s.counter, 1)),
+		Type:      jobType,
+		Payload:   data,
+		RunAt:     unixMilli(runAt),
+		CreatedAt: time.Now(),
+	}
+	err = s.db.Set(job)
+	if err != nil {
+		return nil, err
+	}
+	if !runAt.After(time.Now()) {
+		// do not wait for the next poll
+		select {
+		case s.wake <- struct{}{}:
+		default:
+		}
+	}
+	return job, nil
+}
+
+// Every runs the job type in the given interval, starting now. The next run of an
+// existing recurring job is kept, so that restarts don't run it more often.
+func (s *Scheduler) Every(jobType string, interval time.Duration) error {
+	job := &Job{ID: jobType}
+	if s.db.Get(job) == nil && job.Interval == interval {
+		return nil
+	}
+	job.Type = jobType
+	job.Interval = interval
+	job.RunAt = unixMilli(time.Now())
+	job.CreatedAt = time.Now()
+	return s.db.Set(job)
+}
+
+// Start executes due jobs in the background until Stop is called
+func (s *Scheduler) Start() {
+	log.Infof("[Scheduler] Started with %d pending and %d dead jobs", s.count(jobKeyBase+"*"), s.count(deadJobKeyBase+"*"))
+	go s.run()
+}
+
+func (s *Scheduler) Stop() {
+	close(s.stop)
+}
+
+func (s *Scheduler) run() {
+	ticker := time.NewTicker(s.PollInterval)
+	defer ticker.Stop()
+	for {
+		s.RunDue(time.Now())
+		select {
+		case <-ticker.C:
+		case <-s.wake:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// RunDue executes the jobs that are due at now and waits until they are done
+func (s *Scheduler) RunDue(now time.Time) {
+	jobs := s.due(now)
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, s.Workers)
+	for _, job := range jobs {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(job *Job) {
+			defer wg.Done()
+			defer func() { <-workers }()
+			s.execute(job, now)
+		}(job)
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) due(now time.Time) []*Job {
+	jobs := make([]*Job, 0)
+	pivot := fmt.Sprintf(`{"run_at":%d}`, unixMilli(now)+1)
+	err := s.db.View(func(tx *buntdb.Tx) error {
+		return tx.AscendLessThan(runAtIndex, pivot, func(key, value string) bool {
+			job := &Job{}
+			if err := json.Unmarshal([]byte(value), job); err != nil {
+				log.Errorf("[Scheduler] Could not decode job %s: %s", key, err)
+				return true
+			}
+			jobs = append(jobs, job)
+			return len(jobs) < s.BatchSize
+		})
+	})
+	if err != nil {
+		log.Errorf("[Scheduler] Could not load due jobs: %s", err)
+	}
+	return jobs
+}
+
+func (s *Scheduler) execute(job *Job, now time.Time) {
+	s.mu.RLock()
+	handler, ok := s.handlers[job.Type]
+	s.mu.RUnlock()
+	var err error
+	if ok {
+		err = safeCall(handler, job)
+	} else {
+		err = fmt.Errorf("no handler for job type %s", job.Type)
+	}
+	if job.Interval > 0 && (err == nil || job.Attempts+1 >= s.MaxAttempts) {
+		if err != nil {
+			log.Errorf("[Scheduler] Job %s failed %d times: %s", job.ID, job.Attempts+1, err)
+		}
+		// recurring jobs are never buried
+		job.Attempts = 0
+		job.LastError = ""
+		job.RunAt = unixMilli(now.Add(job.Interval))
+		if err := s.db.Set(job); err != nil {
+			log.Errorf("[Scheduler] Could not save job %s: %s", job.ID, err)
+		}
+		return
+	}
+	if err == nil {
+		log.Debugf("[Scheduler] Job %s done", job.ID)
+		err := s.db.Update(func(tx *buntdb.Tx) error {
+			_, err := tx.Delete(job.Key())
+			return err
+		})
+		if err != nil && err != buntdb.ErrNotFound {
+			log.Errorf("[Scheduler] Could not delete job %s: %s", job.ID, err)
+		}
+		return
+	}
+	job.Attempts++
+	job.LastError = err.Error()
+	if !ok || job.Attempts >= s.MaxAttempts {
+		log.Errorf("[Scheduler] Job %s failed %d times: %s", job.ID, job.Attempts, err)
+		s.bury(job)
+		return
+	}
+	retryAt := now.Add(s.backoff(job.Attempts))
+	job.RunAt = unixMilli(retryAt)
+	log.Warnf("[Scheduler] Job %s failed, retry %d at %s: %s", job.ID, job.Attempts, retryAt, err)
+	if err := s.db.Set(job); err != nil {
+		log.Errorf("[Scheduler] Could not save job %s: %s", job.ID, err)
+	}
+}
+
+// backoff returns the delay before the given attempt
+func (s *Scheduler) backoff(attempts int) time.Duration {
+	backoff := s.Backoff
+	for i := 1; i < attempts && backoff < s.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > s.MaxBackoff {
+		return s.MaxBackoff
+	}
+	return backoff
+}
+
+// bury moves a job to the dead jobs, where it can be inspected
+func (s *Scheduler) bury(job *Job) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		return
+	}
+	err = s.db.Update(func(tx *buntdb.Tx) error {
+		if _, err := tx.Delete(job.Key()); err != nil {
+			return err
+		}
+		_, _, err := tx.Set(deadJobKeyBase+job.ID, string(data), nil)
+		return err
+	})
+	if err != nil {
+		log.Errorf("[Scheduler] Could not bury job %s: %s", job.ID, err)
+	}
+}
+
+func (s *Scheduler) count(pattern string) int {
+	n := 0
+	runtime.IgnoreError(s.db.View(func(tx *buntdb.Tx) error {
+		return tx.AscendKeys(pattern, func(key, value string) bool {
+			n++
+			return true
+		})
+	}))
+	return n
+}
+
+// unixMilli is t in the resolution of the run_at index, which is compared as float64
+func unixMilli(t time.Time) int64 {
+	return t.UnixNano() / int64(time.Millisecond)
+}
+
+func safeCall(handler Handler, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(job)
+}
@@ -0,0 +1,151 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/storage"
+)
+
+func TestScheduler_RunDue(t *testing.T) {
+	db := storage.NewBunt(":memory:")
+	s := New(db)
+	var done []string
+	s.Register("test", func(job *Job) error {
+		var name string
+		if err := job.Decode(&name); err != nil {
+			return err
+		}
+		done = append(done, name)
+		return nil
+	})
+	now := time.Now()
+	for _, name := range []string{"now", "later"} {
+		runAt := now
+		if name == "later" {
+			runAt = now.Add(time.Minute)
+		}
+		if _, err := s.Schedule("test", runAt, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s.RunDue(now)
+	if len(done) != 1 || done[0] != "now" {
+		t.Fatalf("RunDue() executed %v, want [now]", done)
+	}
+	if n := s.count(jobKeyBase + "*"); n != 1 {
+		t.Errorf("%d jobs pending, want 1", n)
+	}
+	// jobs survive a restart
+	s = New(db)
+	s.Register("test", func(job *Job) error {
+		done = append(done, "restarted")
+		return nil
+	})
+	s.RunDue(now.Add(time.Minute))
+	if len(done) != 2 || done[1] != "restarted" {
+		t.Errorf("RunDue() executed %v after restart", done)
+	}
+}
+
+func TestScheduler_retry(t *testing.T) {
+	s := New(storage.NewBunt(":memory:"))
+	s.MaxAttempts = 3
+	attempts := 0
+	s.Register("fail", func(job *Job) error {
+		attempts++
+		return fmt.Errorf("attempt %d", attempts)
+	})
+	now := time.Now()
+	if _, err := s.Schedule("fail", now, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	s.RunDue(now)
+	// the retry waits for the backoff
+	s.RunDue(now.Add(s.Backoff - time.Second))
+	if attempts != 1 {
+		t.Fatalf("%d attempts before the backoff, want 1", attempts)
+	}
+	s.RunDue(now.Add(s.Backoff))
+	s.RunDue(now.Add(s.Backoff + s.backoff(2)))
+	if attempts != 3 {
+		t.Fatalf("%d attempts, want 3", attempts)
+	}
+	if n := s.count(jobKeyBase + "*"); n != 0 {
+		t.Errorf("%d jobs pending after the last attempt, want 0", n)
+	}
+	if n := s.count(deadJobKeyBase + "*"); n != 1 {
+		t.Errorf("%d dead jobs, want 1", n)
+	}
+}
+
+func TestScheduler_EveryRetry(t *testing.T) {
+	s := New(storage.NewBunt(":memory:"))
+	s.MaxAttempts = 2
+	attempts := 0
+	s.Register("hourly", func(job *Job) error {
+		attempts++
+		return fmt.Errorf("attempt %d", attempts)
+	})
+	if err := s.Every("hourly", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	s.RunDue(now)
+	s.RunDue(now.Add(s.Backoff))
+	if attempts != 2 {
+		t.Fatalf("%d attempts, want 2", attempts)
+	}
+	// a failing recurring job is not buried but runs again after the interval
+	if n := s.count(deadJobKeyBase + "*"); n != 0 {
+		t.Errorf("%d dead jobs, want 0", n)
+	}
+	s.RunDue(now.Add(s.Backoff + time.Hour - time.Second))
+	if attempts != 2 {
+		t.Fatalf("%d attempts before the interval, want 2", attempts)
+	}
+	s.RunDue(now.Add(s.Backoff + time.Hour))
+	if attempts != 3 {
+		t.Errorf("%d attempts after the interval, want 3", attempts)
+	}
+}
+
+func TestScheduler_backoff(t *testing.T) {
+	s := &Scheduler{Backoff: 10 * time.Second, MaxBackoff: time.Minute}
+	for attempts, want := range []time.Duration{10 * time.Second, 10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute} {
+		if got := s.backoff(attempts); got != want {
+			t.Errorf("backoff(%d) = %s, want %s", attempts, got, want)
+		}
+	}
+}
+
+func TestScheduler_Every(t *testing.T) {
+	db := storage.NewBunt(":memory:")
+	s := New(db)
+	runs := 0
+	s.Register("daily", func(job *Job) error {
+		runs++
+		return nil
+	})
+	if err := s.Every("daily", 24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	s.RunDue(now)
+	s.RunDue(now.Add(time.Hour))
+	if runs != 1 {
+		t.Fatalf("%d runs on the first day, want 1", runs)
+	}
+	// a restart doesn't run the job again
+	if err := New(db).Every("daily", 24*time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	s.RunDue(now.Add(2 * time.Hour))
+	s.RunDue(now.Add(24 * time.Hour))
+	if runs != 2 {
+		t.Errorf("%d runs after a day, want 2", runs)
+	}
+}
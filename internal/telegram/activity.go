@@ -0,0 +1,100 @@
+package telegram
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	// maxActiveUsersPerChat is the number of distinct users we remember per chat
+	maxActiveUsersPerChat = 200
+	// maxActivityAge is the time after which an activity entry is forgotten
+	maxActivityAge = 24 * time.Hour
+)
+
+type chatActivity struct {
+	User     *tb.User
+	LastSeen time.Time
+}
+
+// ActivityTracker keeps a lightweight in-memory record of the users that
+// recently sent messages in a group chat. It is fed by trackActivityInterceptor.
+type ActivityTracker struct {
+	mu    sync.Mutex
+	chats map[int64][]chatActivity
+	now   func() time.Time
+}
+
+func NewActivityTracker() *ActivityTracker {
+	return &ActivityTracker{
+		chats: make(map[int64][]chatActivity),
+		now:   time.Now,
+	}
+}
+
+// Track records that user has been active in chat. Entries are kept ordered by
+// their last activity, the most recent user comes first.
+func (a *ActivityTracker) Track(chatID int64, user *tb.User) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	entries := a.chats[chatID]
+	updated := make([]chatActivity, 0, len(entries)+1)
+	updated = append(updated, chatActivity{User: user, LastSeen: now})
+	for _, e := range entries {
+		if e.User.ID == user.ID || now.Sub(e.LastSeen) > maxActivityAge {
+			continue
+		}
+		if len(updated) >= maxActiveUsersPerChat {
+			break
+		}
+		updated = append(updated, e)
+	}
+	a.chats[chatID] = updated
+}
+
+// Recent returns up to n distinct users that were active in chat within the
+// given window, most recent first. Users whose ID is in exclude are skipped.
+func (a *ActivityTracker) Recent(chatID int64, n int, window time.Duration, exclude ...int) []*tb.User {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	now := a.now()
+	users := make([]*tb.User, 0, n)
+	for _, e := range a.chats[chatID] {
+		if len(users) >= n || now.Sub(e.LastSeen) > window {
+			break
+		}
+		if containsID(exclude, e.User.ID) {
+			continue
+		}
+		users = append(users, e.User)
+	}
+	return users
+}
+
+func containsID(ids []int, id int) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+// trackActivityInterceptor records group chat activity for commands like /rain.
+// It never stops the interceptor chain.
+func (bot TipBot) trackActivityInterceptor(ctx context.Context, i interface{}) (context.Context, error) {
+	switch i.(type) {
+	case *tb.Message:
+		m := i.(*tb.Message)
+		if m.Private() || m.Sender == nil || m.Sender.IsBot {
+			return ctx, nil
+		}
+		bot.Activity.Track(m.Chat.ID, m.Sender)
+		return ctx, nil
+	}
+	return ctx, invalidTypeError
+}
@@ -0,0 +1,63 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+func TestActivityTracker_Recent(t *testing.T) {
+	now := time.Date(2021, 10, 1, 12, 0, 0, 0, time.UTC)
+	tracker := NewActivityTracker()
+	tracker.now = func() time.Time { return now }
+
+	track := func(chatID int64, user *tb.User, ago time.Duration) {
+		tracker.now = func() time.Time { return now.Add(-ago) }
+		tracker.Track(chatID, user)
+		tracker.now = func() time.Time { return now }
+	}
+	track(1, tipper1, 90*time.Minute)
+	track(1, tipper2, 30*time.Minute)
+	track(1, tipper3, 20*time.Minute)
+	track(1, tipper2, 10*time.Minute)
+	track(1, tipper4, 5*time.Minute)
+	track(2, tipper5, time.Minute)
+
+	ids := func(users []*tb.User) []int {
+		r := make([]int, len(users))
+		for i, u := range users {
+			r[i] = u.ID
+		}
+		return r
+	}
+	tests := []struct {
+		name    string
+		n       int
+		window  time.Duration
+		exclude []int
+		want    []int
+	}{
+		{name: "distinct, most recent first", n: 10, window: time.Hour, want: []int{4, 2, 3}},
+		{name: "limit", n: 2, window: time.Hour, want: []int{4, 2}},
+		{name: "window", n: 10, window: 15 * time.Minute, want: []int{4, 2}},
+		{name: "exclude", n: 2, window: 2 * time.Hour, exclude: []int{4}, want: []int{2, 3}},
+		{name: "all", n: 10, window: 2 * time.Hour, want: []int{4, 2, 3, 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ids(tracker.Recent(1, tt.n, tt.window, tt.exclude...))
+			if len(got) != len(tt.want) {
+				t.Fatalf("Recent() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("Recent() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+	if got := tracker.Recent(3, 10, time.Hour); len(got) != 0 {
+		t.Errorf("Recent() of unknown chat = %v, want none", got)
+	}
+}
@@ -0,0 +1,269 @@
+package telegram
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal"
+	"github.com/LightningTipBot/LightningTipBot/internal/i18n"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
+	"github.com/LightningTipBot/LightningTipBot/internal/str"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/buntdb"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	apiTokenKeyBase  = "apikey-"
+	apiTokenPrefix   = "ltb_"
+	apiTokenMaxCount = 10
+)
+
+// API scopes allow a token to use endpoints of the API
+const (
+	ScopeRead    = "read"
+	ScopeReceive = "receive"
+	ScopePay     = "pay"
+	ScopeSend    = "send"
+)
+
+var apiScopes = []string{ScopeRead, ScopeReceive, ScopePay, ScopeSend}
+
+// APIToken is an API key of a user. Only the hash of the key is stored.
+type APIToken struct {
+	Hash      string    `json:"hash"`
+	UserID    int       `json:"user_id"`
+	Name      string    `json:"name"`
+	Scopes    []string  `json:"scopes"`
+	Hint      string    `json:"hint"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (t *APIToken) Key() string {
+	return apiTokenKeyBase + t.Hash
+}
+
+// HasScope checks whether the token may use endpoints of a scope
+func (t *APIToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func hashAPIToken(token string) string {
+	h := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(h[:])
+}
+
+// AuthenticateAPIToken returns the stored token of an API key and its user
+func (bot *TipBot) AuthenticateAPIToken(token string) (*APIToken, *lnbits.User, error) {
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		return nil, nil, fmt.Errorf("invalid api key")
+	}
+	apiToken := &APIToken{Hash: hashAPIToken(token)}
+	if err := bot.Bunt.Get(apiToken); err != nil {
+		return nil, nil, fmt.Errorf("invalid api key")
+	}
+	user, err := GetLnbitsUser(&tb.User{ID: apiToken.UserID}, *bot)
+	if err != nil || user.Wallet == nil {
+		return nil, nil, fmt.Errorf("the wallet of the api key does not exist")
+	}
+	return apiToken, user, nil
+}
+
+// getAPITokens returns the tokens of a user in the order they were created
+func (bot *TipBot) getAPITokens(user *lnbits.User) []*APIToken {
+	tokens := make([]*APIToken, 0)
+	runtime.IgnoreError(bot.Bunt.View(func(tx *buntdb.Tx) error {
+		return tx.AscendKeys(apiTokenKeyBase+"*", func(key, value string) bool {
+			token := &APIToken{}
+			if json.Unmarshal([]byte(value), token) == nil && token.UserID == user.Telegram.ID {
+				tokens = append(tokens, token)
+			}
+			return true
+		})
+	}))
+	sort.SliceStable(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.Before(tokens[j].CreatedAt)
+	})
+	return tokens
+}
+
+// findAPIToken returns the token with the name or the number in the /apikey list
+func findAPIToken(tokens []*APIToken, nameOrNumber string) *APIToken {
+	if i, err := strconv.Atoi(nameOrNumber); err == nil && i > 0 && i <= len(tokens) {
+		return tokens[i-1]
+	}
+	for _, token := range tokens {
+		if strings.EqualFold(token.Name, nameOrNumber) {
+			return token
+		}
+	}
+	return nil
+}
+
+// parseScopes reads comma separated scopes
+func parseScopes(input string) ([]string, bool) {
+	scopes := strings.Split(strings.ToLower(input), ",")
+	for _, scope := range scopes {
+		if !(&APIToken{Scopes: apiScopes}).HasScope(scope) {
+			return nil, false
+		}
+	}
+	return scopes, true
+}
+
+// SendToUser sends funds to a Telegram user without a confirmation, for example from the API
+func (bot *TipBot) SendToUser(from *lnbits.User, toUsername string, amount int, memo string) error {
+	to, err := GetUserByTelegramUsername(strings.TrimPrefix(toUsername, "@"), *bot)
+	if err != nil {
+		return fmt.Errorf("user %s not found", toUsername)
+	}
+	if to.Telegram.ID == from.Telegram.ID {
+		return fmt.Errorf("you can't send to yourself")
+	}
+	fromUserStr, toUserStr := GetUserStr(from.Telegram), GetUserStr(to.Telegram)
+	t := NewTransaction(bot, from, to, amount, TransactionType("api send"))
+	t.Memo = fmt.Sprintf("Send from %s to %s (%d sat).", fromUserStr, toUserStr, amount)
+	success, err := t.Send()
+	if !success {
+		return fmt.Errorf("transaction failed: %v", err)
+	}
+	log.Infof("[api] Transaction sent from %s to %s (%d sat).", fromUserStr, toUserStr, amount)
+	bot.trySendMessage(to.Telegram, fmt.Sprintf(i18n.Translate(to.Telegram.LanguageCode, "sendReceivedMessage"), GetUserStrMd(from.Telegram), amount))
+	if len(memo) > 0 {
+		bot.trySendMessage(to.Telegram, fmt.Sprintf("✉️ %s", str.MarkdownEscape(memo)))
+	}
+	return nil
+}
+
+// UserTransactions returns the latest transactions of a user between Telegram users
+func (bot *TipBot) UserTransactions(user *lnbits.User, limit int) ([]Transaction, error) {
+	var transactions []Transaction
+	tx := bot.logger.
+		Where("(from_id = ? OR to_id = ?) AND success = ?", user.Telegram.ID, user.Telegram.ID, true).
+		Order("time desc").Limit(limit).Find(&transactions)
+	return transactions, tx.Error
+}
+
+// apikeyHandler invoked on "/apikey [create <name> [<scopes>]|list|revoke <name>]"
+func (bot *TipBot) apikeyHandler(ctx context.Context, m *tb.Message) {
+	bot.anyTextHandler(ctx, m)
+	user := LoadUser(ctx)
+	if user.Wallet == nil {
+		return
+	}
+	if !m.Private() {
+		NewMessage(m, WithDuration(0, bot))
+	}
+	if len(internal.Configuration.Bot.APIServer) == 0 {
+		bot.trySendMessage(m.Sender, Translate(ctx, "apikeyDisabledMessage"))
+		return
+	}
+	tokens := bot.getAPITokens(user)
+	action, err := getArgumentFromCommand(m.Text, 1)
+	if err != nil || strings.ToLower(action) == "list" {
+		bot.trySendMessage(m.Sender, bot.makeAPITokensMessage(ctx, user, tokens))
+		return
+	}
+	name, _ := getArgumentFromCommand(m.Text, 2)
+	switch strings.ToLower(action) {
+	case "create":
+		scopes := []string{ScopeRead}
+		if scopesStr, err := getArgumentFromCommand(m.Text, 3); err == nil {
+			var ok bool
+			if scopes, ok = parseScopes(scopesStr); !ok {
+				break
+			}
+		}
+		// keys that can spend from the wallet need the PIN
+		token := &APIToken{Scopes: scopes}
+		if (token.HasScope(ScopePay) || token.HasScope(ScopeSend)) && bot.requirePinForCommand(ctx, user, pinAlways, m) {
+			return
+		}
+		bot.createAPIToken(ctx, user, tokens, name, scopes)
+		return
+	case "revoke":
+		bot.revokeAPIToken(ctx, user, tokens, name)
+		return
+	}
+	bot.trySendMessage(m.Sender, Translate(ctx, "apikeyHelpText"))
+}
+
+// createAPIToken creates an API key and sends it to the user once
+func (bot *TipBot) createAPIToken(ctx context.Context, user *lnbits.User, tokens []*APIToken, name string, scopes []string) {
+	if !walletNameRegex.MatchString(name) || findAPIToken(tokens, name) != nil {
+		bot.trySendMessage(user.Telegram, Translate(ctx, "apikeyInvalidNameMessage"))
+		return
+	}
+	if len(tokens) >= apiTokenMaxCount {
+		bot.trySendMessage(user.Telegram, fmt.Sprintf(Translate(ctx, "apikeyTooManyMessage"), apiTokenMaxCount))
+		return
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		log.Errorf("[/apikey] Could not create key for %s: %s", GetUserStr(user.Telegram), err)
+		bot.trySendMessage(user.Telegram, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	key := apiTokenPrefix + hex.EncodeToString(b)
+	token := &APIToken{
+		Hash:      hashAPIToken(key),
+		UserID:    user.Telegram.ID,
+		Name:      name,
+		Scopes:    scopes,
+		Hint:      key[len(key)-4:],
+		CreatedAt: time.Now(),
+	}
+	err := bot.Bunt.Set(token)
+	if err != nil {
+		log.Errorf("[/apikey] Could not save key of %s: %s", GetUserStr(user.Telegram), err)
+		bot.trySendMessage(user.Telegram, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	log.Infof("[/apikey] %s created key %s with scopes %s", GetUserStr(user.Telegram), name, strings.Join(scopes, ","))
+	bot.trySendMessage(user.Telegram, fmt.Sprintf(Translate(ctx, "apikeyCreatedMessage"), str.MarkdownEscape(name), strings.Join(scopes, ", "), key))
+}
+
+// revokeAPIToken deletes an API key, requests with it fail immediately
+func (bot *TipBot) revokeAPIToken(ctx context.Context, user *lnbits.User, tokens []*APIToken, name string) {
+	token := findAPIToken(tokens, name)
+	if token == nil {
+		bot.trySendMessage(user.Telegram, fmt.Sprintf(Translate(ctx, "apikeyUnknownMessage"), str.MarkdownEscape(name)))
+		return
+	}
+	err := bot.Bunt.Update(func(tx *buntdb.Tx) error {
+		_, err := tx.Delete(token.Key())
+		return err
+	})
+	if err != nil {
+		log.Errorf("[/apikey] Could not revoke key of %s: %s", GetUserStr(user.Telegram), err)
+		bot.trySendMessage(user.Telegram, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	log.Infof("[/apikey] %s revoked key %s", GetUserStr(user.Telegram), token.Name)
+	bot.trySendMessage(user.Telegram, fmt.Sprintf(Translate(ctx, "apikeyRevokedMessage"), str.MarkdownEscape(token.Name)))
+}
+
+func (bot *TipBot) makeAPITokensMessage(ctx context.Context, user *lnbits.User, tokens []*APIToken) string {
+	if len(tokens) == 0 {
+		return Translate(ctx, "apikeyNoneMessage") + Translate(ctx, "apikeyUsageMessage")
+	}
+	lines := make([]string, len(tokens))
+	for i, token := range tokens {
+		lines[i] = fmt.Sprintf(Translate(ctx, "apikeyEntryMessage"), i+1, str.MarkdownEscape(token.Name), token.Hint, strings.Join(token.Scopes, ", "), formatUserTime(user, token.CreatedAt))
+	}
+	return fmt.Sprintf(Translate(ctx, "apikeyMessage"), strings.Join(lines, "\n")) + Translate(ctx, "apikeyUsageMessage")
+}
@@ -0,0 +1,37 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/storage"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+func TestParseScopes(t *testing.T) {
+	if scopes, ok := parseScopes("Read,send"); !ok || len(scopes) != 2 || scopes[0] != ScopeRead || scopes[1] != ScopeSend {
+		t.Errorf("parseScopes(Read,send) = %v, %t", scopes, ok)
+	}
+	if _, ok := parseScopes("read,admin"); ok {
+		t.Errorf("parseScopes(read,admin) accepted an unknown scope")
+	}
+}
+
+func TestTipBot_AuthenticateAPIToken(t *testing.T) {
+	bot := &TipBot{Bunt: storage.NewBunt(":memory:")}
+	key := apiTokenPrefix + "secret"
+	token := &APIToken{Hash: hashAPIToken(key), UserID: 1, Name: "script", CreatedAt: time.Now()}
+	if err := bot.Bunt.Set(token); err != nil {
+		t.Fatal(err)
+	}
+	// only the hash of the key is stored
+	if stored := bot.getAPITokens(&lnbits.User{Telegram: &tb.User{ID: 1}}); len(stored) != 1 || stored[0].Hash == key {
+		t.Fatalf("getAPITokens() = %+v", stored)
+	}
+	for _, invalid := range []string{"", "secret", apiTokenPrefix + "other", token.Hash} {
+		if _, _, err := bot.AuthenticateAPIToken(invalid); err == nil {
+			t.Errorf("AuthenticateAPIToken(%q) succeeded", invalid)
+		}
+	}
+}
@@ -37,6 +37,10 @@ func (bot TipBot) balanceHandler(ctx context.Context, m *tb.Message) {
 	}
 
 	log.Infof("[/balance] %s's balance: %d sat\n", usrStr, balance)
-	bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "balanceMessage"), balance))
+	balanceMessage := fmt.Sprintf(Translate(ctx, "balanceMessage"), balance)
+	if locked := bot.getVaultBalance(user); locked > 0 {
+		balanceMessage += fmt.Sprintf(Translate(ctx, "balanceVaultMessage"), locked)
+	}
+	bot.trySendMessage(m.Sender, balanceMessage)
 	return
 }
@@ -0,0 +1,273 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/i18n"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
+	"github.com/LightningTipBot/LightningTipBot/internal/storage/transaction"
+	"github.com/LightningTipBot/LightningTipBot/internal/str"
+	log "github.com/sirupsen/logrus"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+var (
+	batchSendConfirmationMenu = &tb.ReplyMarkup{ResizeReplyKeyboard: true}
+	btnCancelBatchSend        = batchSendConfirmationMenu.Data("🚫 Cancel", "cancel_batch_send")
+	btnBatchSend              = batchSendConfirmationMenu.Data("✅ Send", "confirm_batch_send")
+)
+
+type BatchRecipient struct {
+	TelegramId   int    `json:"telegram_id"`
+	TelegramUser string `json:"telegram_user"`
+}
+
+// BatchSendData holds a payment of the same amount to several users,
+// invoked by "/send 100 @alice @bob" or "/tip 100 @alice @bob"
+type BatchSendData struct {
+	*transaction.Base
+	From         lnbits.UserRef   `json:"from"`
+	To           []BatchRecipient `json:"to"`
+	Type         string           `json:"type"`
+	Amount       int              `json:"amount"`
+	Memo         string           `json:"memo"`
+	Message      string           `json:"message"`
+	LanguageCode string           `json:"languagecode"`
+}
+
+// getUsernamesFromCommand returns the @usernames that follow the amount in a
+// command like "/send 100 @alice @bob [<memo>]" and the index of the word at
+// which the memo starts.
+func getUsernamesFromCommand(text string) (usernames []string, memoStart int) {
+	arguments := strings.Split(text, " ")
+	memoStart = 2
+	if len(arguments) <= memoStart {
+		return nil, memoStart
+	}
+	for _, argument := range arguments[2:] {
+		if !strings.HasPrefix(argument, "@") || len(argument) < 2 {
+			break
+		}
+		memoStart++
+		username := strings.TrimPrefix(argument, "@")
+		duplicate := false
+		for _, u := range usernames {
+			if strings.EqualFold(u, username) {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			usernames = append(usernames, username)
+		}
+	}
+	return usernames, memoStart
+}
+
+func (bot TipBot) makeBatchSendKeyboard(ctx context.Context, id string) *tb.ReplyMarkup {
+	sendButton := batchSendConfirmationMenu.Data(Translate(ctx, "sendButtonMessage"), "confirm_batch_send")
+	cancelButton := batchSendConfirmationMenu.Data(Translate(ctx, "cancelButtonMessage"), "cancel_batch_send")
+	sendButton.Data = id
+	cancelButton.Data = id
+	batchSendConfirmationMenu.Inline(
+		batchSendConfirmationMenu.Row(
+			sendButton,
+			cancelButton),
+	)
+	return batchSendConfirmationMenu
+}
+
+// batchSendHandler is invoked by /send and /tip if the command names one or more @users
+func (bot *TipBot) batchSendHandler(ctx context.Context, m *tb.Message, transactionType string) {
+	user := LoadUser(ctx)
+	if user.Wallet == nil {
+		return
+	}
+	amount, err := decodeAmountFromCommand(m.Text)
+	if err != nil || amount < 1 {
+		NewMessage(m, WithDuration(0, bot))
+		bot.trySendMessage(m.Sender, helpSendUsage(ctx, Translate(ctx, "sendValidAmountMessage")))
+		return
+	}
+	usernames, memoStart := getUsernamesFromCommand(m.Text)
+	memo := GetMemoFromCommand(m.Text, memoStart)
+
+	// resolve all recipients, users without wallets are skipped
+	recipients := make([]BatchRecipient, 0, len(usernames))
+	recipientStrs := make([]string, 0, len(usernames))
+	skipped := make([]string, 0)
+	for _, username := range usernames {
+		toUserDb, err := GetUserByTelegramUsername(username, *bot)
+		if err != nil || toUserDb.Telegram.ID == m.Sender.ID {
+			skipped = append(skipped, str.MarkdownEscape("@"+username))
+			continue
+		}
+		recipients = append(recipients, BatchRecipient{TelegramId: toUserDb.Telegram.ID, TelegramUser: username})
+		recipientStrs = append(recipientStrs, str.MarkdownEscape("@"+username))
+	}
+	if len(recipients) == 0 {
+		NewMessage(m, WithDuration(0, bot))
+		bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "sendUserHasNoWalletMessage"), strings.Join(skipped, ", ")))
+		return
+	}
+
+	// check the balance for the whole batch
+	total := amount * len(recipients)
+	balance, err := bot.GetUserBalance(user)
+	if err != nil {
+		NewMessage(m, WithDuration(0, bot))
+		log.Errorf("[batchSendHandler] Could not get balance of %s: %s", GetUserStr(user.Telegram), err)
+		bot.trySendMessage(m.Sender, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	if balance < total {
+		NewMessage(m, WithDuration(0, bot))
+		bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "insufficientFundsMessage"), balance, total))
+		return
+	}
+
+	confirmText := fmt.Sprintf(Translate(ctx, "confirmBatchSendMessage"), amount, strings.Join(recipientStrs, ", "), total)
+	if len(skipped) > 0 {
+		confirmText = confirmText + fmt.Sprintf(Translate(ctx, "batchSendSkippedMessage"), strings.Join(skipped, ", "))
+	}
+	if len(memo) > 0 {
+		confirmText = confirmText + fmt.Sprintf(Translate(ctx, "confirmSendAppendMemo"), str.MarkdownEscape(memo))
+	}
+	id := fmt.Sprintf("batch-%d-%d-%s", m.Sender.ID, total, RandStringRunes(5))
+	batchSendData := BatchSendData{
+		Base:         transaction.New(transaction.ID(id)),
+		From:         user.Ref(),
+		To:           recipients,
+		Type:         transactionType,
+		Amount:       amount,
+		Memo:         memo,
+		Message:      confirmText,
+		LanguageCode: ctx.Value("publicLanguageCode").(string),
+	}
+	runtime.IgnoreError(batchSendData.Set(batchSendData, bot.Bunt))
+
+	if m.Private() {
+		bot.trySendMessage(m.Chat, confirmText, bot.makeBatchSendKeyboard(ctx, id))
+	} else {
+		bot.tryReplyMessage(m, confirmText, bot.makeBatchSendKeyboard(ctx, id))
+	}
+}
+
+// confirmBatchSendHandler invoked when user clicked send on batch confirmation
+func (bot *TipBot) confirmBatchSendHandler(ctx context.Context, c *tb.Callback) {
+	tx := &BatchSendData{Base: transaction.New(transaction.ID(c.Data))}
+	sn, err := tx.Get(tx, bot.Bunt)
+	if err != nil {
+		log.Errorf("[confirmBatchSendHandler] %s", err)
+		return
+	}
+	batchSendData := sn.(*BatchSendData)
+	// only the correct user can press
+	if batchSendData.From.TelegramID != c.Sender.ID {
+		return
+	}
+	// immediatelly set intransaction to block duplicate calls
+	err = batchSendData.Lock(batchSendData, bot.Bunt)
+	if err != nil {
+		log.Errorf("[confirmBatchSendHandler] %s", err)
+		bot.tryDeleteMessage(c.Message)
+		return
+	}
+	defer batchSendData.Release(batchSendData, bot.Bunt)
+	if !batchSendData.Active {
+		log.Errorf("[confirmBatchSendHandler] batch send not active anymore")
+		return
+	}
+
+	from := LoadUser(ctx)
+	if from.Wallet == nil {
+		return
+	}
+	fromUserStr := GetUserStr(from.Telegram)
+	fromUserStrMd := GetUserStrMd(from.Telegram)
+	total := batchSendData.Amount * len(batchSendData.To)
+	// large batches wait for the PIN
+	if bot.requirePinForCallback(ctx, from, total, "batch", c) {
+		return
+	}
+	balance, err := bot.GetUserBalance(from)
+	if err != nil || balance < total {
+		bot.tryEditMessage(c.Message, fmt.Sprintf(i18n.Translate(batchSendData.LanguageCode, "insufficientFundsMessage"), balance, total), &tb.ReplyMarkup{})
+		batchSendData.Inactivate(batchSendData, bot.Bunt)
+		return
+	}
+	// the batch can only be sent once, failed payments have to be repeated manually
+	batchSendData.Inactivate(batchSendData, bot.Bunt)
+
+	opts := []TransactionOption{TransactionType(batchSendData.Type), TransactionBatch(batchSendData.ID), TransactionConfirmed()}
+	if !c.Message.Private() {
+		opts = append(opts, TransactionChat(c.Message.Chat))
+	}
+	results := make([]string, 0, len(batchSendData.To))
+	nSent := 0
+	for _, recipient := range batchSendData.To {
+		to, err := GetLnbitsUser(&tb.User{ID: recipient.TelegramId, Username: recipient.TelegramUser}, *bot)
+		if err != nil {
+			log.Errorln(err.Error())
+			results = append(results, fmt.Sprintf("🚫 %s: %s", str.MarkdownEscape("@"+recipient.TelegramUser), i18n.Translate(batchSendData.LanguageCode, "sendErrorMessage")))
+			continue
+		}
+		toUserStr := GetUserStr(to.Telegram)
+		toUserStrMd := GetUserStrMd(to.Telegram)
+		t := NewTransaction(bot, from, to, batchSendData.Amount, opts...)
+		t.Memo = fmt.Sprintf("Batch %s from %s to %s (%d sat).", batchSendData.Type, fromUserStr, toUserStr, batchSendData.Amount)
+		success, err := t.Send()
+		if !success {
+			log.Warnf("[confirmBatchSendHandler] Transaction from %s to %s failed: %s", fromUserStr, toUserStr, err)
+			results = append(results, fmt.Sprintf("🚫 %s: %s", toUserStrMd, str.MarkdownEscape(fmt.Sprint(err))))
+			continue
+		}
+		nSent++
+		results = append(results, fmt.Sprintf("✅ %s", toUserStrMd))
+
+		// notify the recipient
+		receivedMessage := "sendReceivedMessage"
+		if batchSendData.Type == "tip" {
+			receivedMessage = "tipReceivedMessage"
+		}
+		bot.trySendMessage(to.Telegram, fmt.Sprintf(i18n.Translate(to.Telegram.LanguageCode, receivedMessage), fromUserStrMd, batchSendData.Amount))
+		if len(batchSendData.Memo) > 0 {
+			bot.trySendMessage(to.Telegram, fmt.Sprintf("✉️ %s", str.MarkdownEscape(batchSendData.Memo)))
+		}
+	}
+	log.Infof("[batchSend] %s sent %d sat to %d/%d users (batch %s).", fromUserStr, batchSendData.Amount*nSent, nSent, len(batchSendData.To), batchSendData.ID)
+
+	resultMessage := fmt.Sprintf(
+		i18n.Translate(batchSendData.LanguageCode, "batchSendResultMessage"),
+		fromUserStrMd,
+		batchSendData.Amount*nSent,
+		nSent,
+		len(batchSendData.To),
+		strings.Join(results, "\n"),
+	)
+	bot.tryEditMessage(c.Message, resultMessage, &tb.ReplyMarkup{})
+	if !c.Message.Private() {
+		bot.trySendMessage(c.Sender, resultMessage)
+	}
+}
+
+// cancelBatchSendHandler invoked when user clicked cancel on batch confirmation
+func (bot *TipBot) cancelBatchSendHandler(ctx context.Context, c *tb.Callback) {
+	tx := &BatchSendData{Base: transaction.New(transaction.ID(c.Data))}
+	sn, err := tx.Get(tx, bot.Bunt)
+	if err != nil {
+		log.Errorf("[cancelBatchSendHandler] %s", err)
+		return
+	}
+	batchSendData := sn.(*BatchSendData)
+	// only the correct user can press
+	if batchSendData.From.TelegramID != c.Sender.ID {
+		return
+	}
+	bot.tryEditMessage(c.Message, i18n.Translate(batchSendData.LanguageCode, "sendCancelledMessage"), &tb.ReplyMarkup{})
+	batchSendData.InTransaction = false
+	batchSendData.Inactivate(batchSendData, bot.Bunt)
+}
@@ -0,0 +1,31 @@
+package telegram
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_getUsernamesFromCommand(t *testing.T) {
+	tests := []struct {
+		name          string
+		text          string
+		wantUsernames []string
+		wantMemoStart int
+	}{
+		{name: "single mention", text: "/tip 100 @alice", wantUsernames: []string{"alice"}, wantMemoStart: 3},
+		{name: "several mentions", text: "/send 100 @alice @bob @carol", wantUsernames: []string{"alice", "bob", "carol"}, wantMemoStart: 5},
+		{name: "duplicate mentions", text: "/send 100 @alice @bob @Alice", wantUsernames: []string{"alice", "bob"}, wantMemoStart: 5},
+		{name: "memo", text: "/tip 21 @alice @bob thanks for @carol", wantUsernames: []string{"alice", "bob"}, wantMemoStart: 4},
+		{name: "lone @", text: "/tip 21 @ @alice", wantUsernames: nil, wantMemoStart: 2},
+		{name: "no usernames", text: "/tip 21 thanks", wantUsernames: nil, wantMemoStart: 2},
+		{name: "reply", text: "/tip 21", wantUsernames: nil, wantMemoStart: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usernames, memoStart := getUsernamesFromCommand(tt.text)
+			if !reflect.DeepEqual(usernames, tt.wantUsernames) || memoStart != tt.wantMemoStart {
+				t.Errorf("getUsernamesFromCommand() = %v, %d, want %v, %d", usernames, memoStart, tt.wantUsernames, tt.wantMemoStart)
+			}
+		})
+	}
+}
@@ -7,7 +7,10 @@ import (
 	"time"
 
 	"github.com/LightningTipBot/LightningTipBot/internal"
+	"github.com/LightningTipBot/LightningTipBot/internal/events"
 	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
+	"github.com/LightningTipBot/LightningTipBot/internal/scheduler"
 	"github.com/LightningTipBot/LightningTipBot/internal/storage"
 	gocache "github.com/patrickmn/go-cache"
 	log "github.com/sirupsen/logrus"
@@ -17,11 +20,14 @@ import (
 )
 
 type TipBot struct {
-	Database *gorm.DB
-	Bunt     *storage.DB
-	logger   *gorm.DB
-	Telegram *telebot.Bot
-	Client   *lnbits.Client
+	Database  *gorm.DB
+	Bunt      *storage.DB
+	logger    *gorm.DB
+	Telegram  *telebot.Bot
+	Client    *lnbits.Client
+	Activity  *ActivityTracker
+	Scheduler *scheduler.Scheduler
+	Events    *events.Bus
 	Cache
 }
 type Cache struct {
@@ -39,13 +45,17 @@ func NewBot() TipBot {
 	gocacheStore := store.NewGoCache(gocacheClient, nil)
 	// create sqlite databases
 	db, txLogger := AutoMigration()
+	bunt := createBunt()
 	return TipBot{
-		Database: db,
-		Client:   lnbits.NewClient(internal.Configuration.Lnbits.AdminKey, internal.Configuration.Lnbits.Url),
-		logger:   txLogger,
-		Bunt:     createBunt(),
-		Telegram: newTelegramBot(),
-		Cache:    Cache{GoCacheStore: gocacheStore},
+		Database:  db,
+		Client:    lnbits.NewClient(internal.Configuration.Lnbits.AdminKey, internal.Configuration.Lnbits.Url),
+		logger:    txLogger,
+		Bunt:      bunt,
+		Telegram:  newTelegramBot(),
+		Activity:  NewActivityTracker(),
+		Scheduler: scheduler.New(bunt),
+		Events:    events.NewBus(),
+		Cache:     Cache{GoCacheStore: gocacheStore},
 	}
 }
 
@@ -84,5 +94,29 @@ func (bot TipBot) Start() {
 		log.Errorf("Could not initialize bot wallet: %s", err.Error())
 	}
 	bot.registerTelegramHandlers()
+	bot.subscribePaymentEvents()
+	bot.Scheduler.Register(deleteMessageJob, bot.deleteMessageJobHandler)
+	bot.Scheduler.Register(expireVoucherJob, bot.expireVoucherJobHandler)
+	bot.Scheduler.Register(expireBountyJob, bot.expireBountyJobHandler)
+	bot.Scheduler.Register(expirePendingClaimJob, bot.expirePendingClaimJobHandler)
+	bot.Scheduler.Register(reclaimJob, bot.reclaimJobHandler)
+	bot.Scheduler.Register(expireTipUndoJob, bot.expireTipUndoJobHandler)
+	bot.Scheduler.Register(unlockVaultJob, bot.unlockVaultJobHandler)
+	bot.Scheduler.Register(deliverWebhookJob, bot.deliverWebhookJobHandler)
+	bot.Scheduler.Register(sendDigestsJob, bot.sendDigestsJobHandler)
+	bot.Scheduler.Register(expireTipjarsJob, bot.expireTipjarsJobHandler)
+	bot.Scheduler.Register(paySubscriptionsJob, bot.paySubscriptionsJobHandler)
+	bot.Scheduler.Register(executeScheduledSendsJob, bot.executeScheduledSendsJobHandler)
+	runtime.IgnoreError(bot.Scheduler.Every(reclaimJob, reclaimInterval))
+	runtime.IgnoreError(bot.Scheduler.Every(sendDigestsJob, sendDigestsInterval))
+	runtime.IgnoreError(bot.Scheduler.Every(expireTipjarsJob, expireTipjarsInterval))
+	runtime.IgnoreError(bot.Scheduler.Every(paySubscriptionsJob, paySubscriptionsInterval))
+	runtime.IgnoreError(bot.Scheduler.Every(executeScheduledSendsJob, executeScheduledSendsInterval))
+	bot.Scheduler.Start()
+	// chat join requests are not supported by telebot, see JoinRequestPoller
+	if poller, ok := bot.Telegram.Poller.(*tb.LongPoller); ok {
+		bot.Telegram.Poller = NewJoinRequestPoller(poller, bot.joinRequestHandler)
+	}
+	go bot.runNWC()
 	bot.Telegram.Start()
 }
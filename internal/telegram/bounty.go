@@ -0,0 +1,409 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal"
+	"github.com/LightningTipBot/LightningTipBot/internal/i18n"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
+	"github.com/LightningTipBot/LightningTipBot/internal/scheduler"
+	"github.com/LightningTipBot/LightningTipBot/internal/storage/transaction"
+	"github.com/LightningTipBot/LightningTipBot/internal/str"
+	log "github.com/sirupsen/logrus"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	// bountyExpiry is the time after which bounties without a winner are refunded
+	bountyExpiry    = 7 * 24 * time.Hour
+	expireBountyJob = "expire-bounty"
+)
+
+var (
+	bountyMenu        = &tb.ReplyMarkup{ResizeReplyKeyboard: false}
+	btnCancelBounty   = bountyMenu.Data("🚫", "cancel_bounty")
+	btnAwardBounty    = bountyMenu.Data("🏆", "award_bounty")
+	bountyMaxClaims   = 10
+	bountyMaxClaimLen = 100
+)
+
+type BountyClaim struct {
+	User      *tb.User `json:"user"`
+	MessageID int      `json:"message_id"`
+	Text      string   `json:"text"`
+}
+
+// Bounty holds the escrowed amount of a /bounty until the creator picks a winner.
+// Its ID is derived from the bounty message so that replies can be matched to it.
+type Bounty struct {
+	*transaction.Base
+	From         lnbits.UserRef   `json:"bounty_from"`
+	Amount       int              `json:"bounty_amount"`
+	Description  string           `json:"bounty_description"`
+	Claims       []*BountyClaim   `json:"bounty_claims"`
+	Message      string           `json:"bounty_message"`
+	EditMessage  tb.StoredMessage `json:"bounty_editmessage"`
+	ExpiresAt    time.Time        `json:"bounty_expires"`
+	LanguageCode string           `json:"languagecode"`
+}
+
+func bountyID(chatID int64, messageID int) string {
+	return fmt.Sprintf("bounty-%d-%d", chatID, messageID)
+}
+
+func helpBountyUsage(ctx context.Context, errormsg string) string {
+	return fmt.Sprintf(Translate(ctx, "bountyHelpText"), errormsg)
+}
+
+// makeMessage renders the bounty with all claims submitted so far
+func (bounty *Bounty) makeMessage(from *lnbits.User) string {
+	message := fmt.Sprintf(
+		i18n.Translate(bounty.LanguageCode, "bountyMessage"),
+		GetUserStrMd(from.Telegram),
+		bounty.Amount,
+		str.MarkdownEscape(bounty.Description),
+	)
+	if len(bounty.Claims) > 0 {
+		claims := make([]string, len(bounty.Claims))
+		for i, claim := range bounty.Claims {
+			claims[i] = fmt.Sprintf("%d. %s: %s", i+1, GetUserStrMd(claim.User), str.MarkdownEscape(claim.Text))
+		}
+		message = message + fmt.Sprintf(i18n.Translate(bounty.LanguageCode, "bountyClaimsMessage"), strings.Join(claims, "\n"))
+	}
+	return message
+}
+
+func (bot TipBot) makeBountyKeyboard(bounty *Bounty) *tb.ReplyMarkup {
+	rows := make([]tb.Row, 0, len(bounty.Claims)+1)
+	for i, claim := range bounty.Claims {
+		awardButton := bountyMenu.Data(fmt.Sprintf("🏆 %d. %s", i+1, GetUserStr(claim.User)), "award_bounty", bounty.ID, strconv.Itoa(i))
+		rows = append(rows, bountyMenu.Row(awardButton))
+	}
+	cancelButton := bountyMenu.Data(i18n.Translate(bounty.LanguageCode, "cancelButtonMessage"), "cancel_bounty", bounty.ID)
+	rows = append(rows, bountyMenu.Row(cancelButton))
+	bountyMenu.Inline(rows...)
+	return bountyMenu
+}
+
+// bountyHandler invoked on "/bounty <amount> <description>". The amount is held by the
+// bot until the creator awards it to one of the users that replied with a claim.
+func (bot *TipBot) bountyHandler(ctx context.Context, m *tb.Message) {
+	// delete the bounty command after a few seconds, this is default behaviour
+	defer NewMessage(m, WithDuration(time.Second*time.Duration(internal.Configuration.Telegram.MessageDisposeDuration), bot))
+	bot.anyTextHandler(ctx, m)
+	from := LoadUser(ctx)
+	if from.Wallet == nil {
+		return
+	}
+	if m.Private() {
+		bot.trySendMessage(m.Sender, helpBountyUsage(ctx, Translate(ctx, "bountyHelpInGroup")))
+		return
+	}
+	amount, err := decodeAmountFromCommand(m.Text)
+	if err != nil || amount < 1 {
+		bot.trySendMessage(m.Sender, helpBountyUsage(ctx, Translate(ctx, "bountyInvalidAmountMessage")))
+		return
+	}
+	description := GetMemoFromCommand(m.Text, 2)
+	if len(description) == 0 {
+		bot.trySendMessage(m.Sender, helpBountyUsage(ctx, Translate(ctx, "bountyNoDescriptionMessage")))
+		return
+	}
+	fromUserStr := GetUserStr(from.Telegram)
+	balance, err := bot.GetUserBalance(from)
+	if err != nil {
+		log.Errorf("[/bounty] Error fetching %s's balance: %s", fromUserStr, err)
+		bot.trySendMessage(m.Sender, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	if balance < amount {
+		bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "insufficientFundsMessage"), balance, amount))
+		return
+	}
+
+	// large bounties wait for the PIN
+	if bot.requirePinForCommand(ctx, from, amount, m) {
+		return
+	}
+	// post the bounty first, its message identifies the bounty
+	bounty := &Bounty{
+		From:         from.Ref(),
+		Amount:       amount,
+		Description:  description,
+		LanguageCode: ctx.Value("publicLanguageCode").(string),
+	}
+	bounty.Message = bounty.makeMessage(from)
+	msg := bot.trySendMessage(m.Chat, bounty.Message)
+	if msg == nil {
+		return
+	}
+	bounty.Base = transaction.New(transaction.ID(bountyID(msg.Chat.ID, msg.ID)))
+	bounty.EditMessage = storedMessage(msg)
+	bounty.ExpiresAt = time.Now().Add(bountyExpiry)
+
+	escrow, err := bot.GetBotUser()
+	if err != nil {
+		log.Errorf("[/bounty] Could not load bot wallet: %s", err)
+		bot.tryEditMessage(msg, Translate(ctx, "bountyErrorMessage"))
+		return
+	}
+	// the refund is scheduled before the amount is moved into escrow, so that it is never stuck there
+	if err = bounty.Set(bounty, bot.Bunt); err == nil {
+		_, err = bot.Scheduler.Schedule(expireBountyJob, bounty.ExpiresAt, bounty.ID)
+	}
+	if err != nil {
+		log.Errorf("[/bounty] Could not schedule expiry of %s: %s", bounty.ID, err)
+		bot.tryEditMessage(msg, Translate(ctx, "bountyErrorMessage"))
+		return
+	}
+	t := NewTransaction(bot, from, escrow, amount, TransactionType("bounty"), TransactionChat(m.Chat), TransactionConfirmed())
+	t.Memo = fmt.Sprintf("Bounty from %s (%d sat).", fromUserStr, amount)
+	success, err := t.Send()
+	if !success {
+		// the scheduled refund finds the bounty inactive and does nothing
+		runtime.IgnoreError(bounty.Inactivate(bounty, bot.Bunt))
+		log.Warnf("[/bounty] Transaction from %s failed: %s", fromUserStr, err)
+		bot.tryEditMessage(msg, Translate(ctx, "bountyErrorMessage"))
+		return
+	}
+	log.Infof("[/bounty] %s created bounty %s: %d sat", fromUserStr, bounty.ID, amount)
+	bot.tryEditMessage(msg, bounty.Message, bot.makeBountyKeyboard(bounty))
+}
+
+// bountyClaimInterceptor records replies to a bounty message as claims.
+// It never stops the interceptor chain and doesn't wait for bounties that are locked.
+func (bot TipBot) bountyClaimInterceptor(ctx context.Context, i interface{}) (context.Context, error) {
+	switch i.(type) {
+	case *tb.Message:
+		m := i.(*tb.Message)
+		if m.Private() || !m.IsReply() || m.Sender == nil || m.Sender.IsBot ||
+			m.ReplyTo.Sender == nil || m.ReplyTo.Sender.ID != bot.Telegram.Me.ID {
+			return ctx, nil
+		}
+		// most replies to the bot are not claims
+		if bot.Bunt.Get(&Bounty{Base: transaction.New(transaction.ID(bountyID(m.Chat.ID, m.ReplyTo.ID)))}) != nil {
+			return ctx, nil
+		}
+		go bot.claimBounty(m)
+		return ctx, nil
+	}
+	return ctx, invalidTypeError
+}
+
+func (bot TipBot) claimBounty(m *tb.Message) {
+	tx := &Bounty{Base: transaction.New(transaction.ID(bountyID(m.Chat.ID, m.ReplyTo.ID)))}
+	sn, err := tx.Get(tx, bot.Bunt)
+	if err != nil {
+		log.Errorf("[bounty] %s", err)
+		return
+	}
+	bounty := sn.(*Bounty)
+	if !bounty.Active || bounty.From.TelegramID == m.Sender.ID || len(bounty.Claims) >= bountyMaxClaims {
+		return
+	}
+	err = bounty.Lock(bounty, bot.Bunt)
+	if err != nil {
+		log.Errorf("[bounty] LockBounty %s error: %s", bounty.ID, err)
+		return
+	}
+	defer bounty.Release(bounty, bot.Bunt)
+	from, err := bot.loadUser(bounty.From)
+	if err != nil {
+		log.Errorf("[bounty] %s", err)
+		return
+	}
+	for _, claim := range bounty.Claims {
+		if claim.User.ID == m.Sender.ID {
+			return
+		}
+	}
+	text := m.Text
+	if runes := []rune(text); len(runes) > bountyMaxClaimLen {
+		text = string(runes[:bountyMaxClaimLen]) + "..."
+	}
+	bounty.Claims = append(bounty.Claims, &BountyClaim{User: m.Sender, MessageID: m.ID, Text: text})
+	log.Infof("[bounty] %s submitted a claim for bounty %s", GetUserStr(m.Sender), bounty.ID)
+	bounty.Message = bounty.makeMessage(from)
+	bot.tryEditMessage(bounty.EditMessage, bounty.Message, bot.makeBountyKeyboard(bounty))
+	bot.trySendMessage(from.Telegram, fmt.Sprintf(i18n.Translate(from.Telegram.LanguageCode, "bountyClaimReceivedMessage"), GetUserStrMd(m.Sender), str.MarkdownEscape(m.Chat.Title)))
+}
+
+// awardBountyHandler is invoked when the creator picks a winner. The button data is "<bounty id>|<claim index>".
+func (bot *TipBot) awardBountyHandler(ctx context.Context, c *tb.Callback) {
+	data := strings.Split(c.Data, "|")
+	if len(data) != 2 {
+		return
+	}
+	index, err := strconv.Atoi(data[1])
+	if err != nil {
+		return
+	}
+	tx := &Bounty{Base: transaction.New(transaction.ID(data[0]))}
+	sn, err := tx.Get(tx, bot.Bunt)
+	if err != nil {
+		log.Errorf("[awardBountyHandler] %s", err)
+		return
+	}
+	bounty := sn.(*Bounty)
+	// only the creator can award the bounty
+	if bounty.From.TelegramID != c.Sender.ID || index < 0 || index >= len(bounty.Claims) {
+		return
+	}
+	err = bounty.Lock(bounty, bot.Bunt)
+	if err != nil {
+		log.Errorf("[awardBountyHandler] %s", err)
+		return
+	}
+	defer bounty.Release(bounty, bot.Bunt)
+	if !bounty.Active {
+		log.Errorf("[awardBountyHandler] bounty %s not active anymore", bounty.ID)
+		return
+	}
+
+	from, err := bot.loadUser(bounty.From)
+	if err != nil {
+		log.Errorf("[awardBountyHandler] %s", err)
+		return
+	}
+	winner := bounty.Claims[index].User
+	winnerStr := GetUserStr(winner)
+	to, exists := bot.UserExists(winner)
+	if !exists {
+		log.Infof("[bounty] User %s has no wallet.", winnerStr)
+		to, err = bot.CreateWalletForTelegramUser(winner)
+		if err != nil {
+			log.Errorf("[bounty] Error: Could not create wallet for %s", winnerStr)
+			bot.trySendMessage(c.Sender, TranslateUser(ctx, "errorTryLaterMessage"))
+			return
+		}
+	}
+	escrow, err := bot.GetBotUser()
+	if err != nil {
+		log.Errorf("[bounty] Could not load bot wallet: %s", err)
+		bot.trySendMessage(c.Sender, TranslateUser(ctx, "errorTryLaterMessage"))
+		return
+	}
+	t := NewTransaction(bot, escrow, to, bounty.Amount, TransactionType("bounty payout"), TransactionChat(c.Message.Chat))
+	t.Memo = fmt.Sprintf("Bounty from %s to %s (%d sat).", GetUserStr(from.Telegram), winnerStr, bounty.Amount)
+	success, err := t.Send()
+	if !success {
+		log.Errorf("[bounty] Payout of bounty %s failed: %s", bounty.ID, err)
+		bot.trySendMessage(c.Sender, TranslateUser(ctx, "errorTryLaterMessage"))
+		return
+	}
+	log.Infof("[bounty] bounty %s: %d sat awarded to %s", bounty.ID, bounty.Amount, winnerStr)
+	bounty.Active = false
+
+	bounty.Message = fmt.Sprintf(
+		i18n.Translate(bounty.LanguageCode, "bountyAwardedMessage"),
+		GetUserStrMd(from.Telegram),
+		bounty.Amount,
+		GetUserStrMd(winner),
+		str.MarkdownEscape(bounty.Description),
+	)
+	if !to.Initialized {
+		bounty.Message += "\n\n" + fmt.Sprintf(i18n.Translate(bounty.LanguageCode, "bountyCreateWalletMessage"), GetUserStrMd(bot.Telegram.Me))
+	}
+	bot.tryEditMessage(c.Message, bounty.Message, &tb.ReplyMarkup{})
+	bot.trySendMessage(winner, fmt.Sprintf(i18n.Translate(winner.LanguageCode, "bountyWonMessage"), GetUserStrMd(from.Telegram), bounty.Amount))
+}
+
+// cancelBountyHandler refunds the escrowed amount to the creator
+func (bot *TipBot) cancelBountyHandler(ctx context.Context, c *tb.Callback) {
+	tx := &Bounty{Base: transaction.New(transaction.ID(c.Data))}
+	sn, err := tx.Get(tx, bot.Bunt)
+	if err != nil {
+		log.Errorf("[cancelBountyHandler] %s", err)
+		return
+	}
+	bounty := sn.(*Bounty)
+	// only the creator can cancel the bounty
+	if bounty.From.TelegramID != c.Sender.ID {
+		return
+	}
+	err = bounty.Lock(bounty, bot.Bunt)
+	if err != nil {
+		log.Errorf("[cancelBountyHandler] %s", err)
+		return
+	}
+	defer bounty.Release(bounty, bot.Bunt)
+	if !bounty.Active {
+		log.Errorf("[cancelBountyHandler] bounty %s not active anymore", bounty.ID)
+		return
+	}
+
+	from, err := bot.loadUser(bounty.From)
+	if err != nil {
+		log.Errorf("[cancelBountyHandler] %s", err)
+		return
+	}
+	if !bot.refundBounty(bounty, from) {
+		bot.trySendMessage(c.Sender, TranslateUser(ctx, "errorTryLaterMessage"))
+		return
+	}
+	log.Infof("[bounty] bounty %s cancelled, %d sat refunded", bounty.ID, bounty.Amount)
+	bot.tryEditMessage(c.Message, fmt.Sprintf(i18n.Translate(bounty.LanguageCode, "bountyCancelledMessage"), bounty.Amount), &tb.ReplyMarkup{})
+}
+
+// refundBounty sends the escrow of a locked bounty back to the creator. The bounty is inactivated
+// before the payment so that it can never be paid twice, and reactivated if the payment fails.
+func (bot *TipBot) refundBounty(bounty *Bounty, from *lnbits.User) bool {
+	escrow, err := bot.GetBotUser()
+	if err != nil {
+		log.Errorf("[bounty] Could not load bot wallet: %s", err)
+		return false
+	}
+	if bounty.Inactivate(bounty, bot.Bunt) != nil {
+		return false
+	}
+	t := NewTransaction(bot, escrow, from, bounty.Amount, TransactionType("bounty refund"))
+	t.Memo = fmt.Sprintf("Bounty refund to %s (%d sat).", GetUserStr(from.Telegram), bounty.Amount)
+	success, err := t.Send()
+	if !success {
+		log.Errorf("[bounty] Refund of bounty %s failed: %s", bounty.ID, err)
+		bounty.Active = true
+		return false
+	}
+	return true
+}
+
+// expireBountyJobHandler refunds a bounty that was not awarded in time
+func (bot *TipBot) expireBountyJobHandler(job *scheduler.Job) error {
+	var id string
+	if err := job.Decode(&id); err != nil {
+		log.Errorf("[expireBountyJobHandler] %s", err)
+		return nil
+	}
+	tx := &Bounty{Base: transaction.New(transaction.ID(id))}
+	sn, err := tx.Get(tx, bot.Bunt)
+	if err != nil {
+		return err
+	}
+	bounty := sn.(*Bounty)
+	err = bounty.Lock(bounty, bot.Bunt)
+	if err != nil {
+		return err
+	}
+	defer bounty.Release(bounty, bot.Bunt)
+	if !bounty.Active {
+		// awarded or cancelled
+		return nil
+	}
+	from, err := bot.loadUser(bounty.From)
+	if err != nil {
+		return err
+	}
+	if !bot.refundBounty(bounty, from) {
+		return fmt.Errorf("refund of %s failed", bounty.ID)
+	}
+	log.Infof("[bounty] bounty %s of %d sat expired and was refunded to %s", bounty.ID, bounty.Amount, GetUserStr(from.Telegram))
+	bounty.Message = fmt.Sprintf(i18n.Translate(bounty.LanguageCode, "bountyExpiredMessage"), GetUserStrMd(from.Telegram), bounty.Amount)
+	bot.tryEditMessage(bounty.EditMessage, bounty.Message, &tb.ReplyMarkup{})
+	bot.trySendMessage(from.Telegram, fmt.Sprintf(i18n.Translate(from.Telegram.LanguageCode, "bountyExpiredMessage"), GetUserStrMd(from.Telegram), bounty.Amount))
+	return nil
+}
@@ -33,6 +33,11 @@ func createBunt() *storage.DB {
 	if err != nil {
 		panic(err)
 	}
+	// stored objects only keep a reference to users
+	err = database.MigrateBuntUserRefs(bunt)
+	if err != nil {
+		panic(err)
+	}
 	return bunt
 }
 
@@ -53,6 +58,15 @@ func ColumnMigrationTasks(db *gorm.DB) error {
 }
 
 func AutoMigration() (db *gorm.DB, txLogger *gorm.DB) {
+	// the key encryption key has to be set before any user is read from the database
+	key, err := lnbits.LoadMasterKey(internal.Configuration.Lnbits.KeyEncryptionKey, internal.Configuration.Lnbits.KeyEncryptionKeyFile)
+	if err != nil {
+		panic(err)
+	}
+	err = lnbits.SetMasterKey(key)
+	if err != nil {
+		panic(err)
+	}
 	orm, err := gorm.Open(sqlite.Open(internal.Configuration.Database.DbPath), &gorm.Config{DisableForeignKeyConstraintWhenMigrating: true, FullSaveAssociations: true})
 	if err != nil {
 		panic("Initialize orm failed.")
@@ -61,10 +75,16 @@ func AutoMigration() (db *gorm.DB, txLogger *gorm.DB) {
 	if err != nil {
 		panic(err)
 	}
-	err = orm.AutoMigrate(&lnbits.User{})
+	err = orm.AutoMigrate(&lnbits.User{}, &Subscription{})
 	if err != nil {
 		panic(err)
 	}
+	if lnbits.KeyEncryptionEnabled() {
+		err = database.MigrateEncryptWalletKeys(orm)
+		if err != nil {
+			panic(err)
+		}
+	}
 
 	txLogger, err = gorm.Open(sqlite.Open(internal.Configuration.Database.TransactionsPath), &gorm.Config{DisableForeignKeyConstraintWhenMigrating: true, FullSaveAssociations: true})
 	if err != nil {
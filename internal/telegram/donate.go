@@ -10,7 +10,6 @@ import (
 
 	"github.com/LightningTipBot/LightningTipBot/internal/str"
 
-	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
 	log "github.com/sirupsen/logrus"
 	tb "gopkg.in/tucnak/telebot.v2"
 )
@@ -47,6 +46,10 @@ func (bot TipBot) donationHandler(ctx context.Context, m *tb.Message) {
 		return
 	}
 
+	// large donations wait for the PIN
+	if bot.requirePinForCommand(ctx, user, amount, m) {
+		return
+	}
 	// command is valid
 	msg := bot.trySendMessage(user.Telegram, Translate(ctx, "donationProgressMessage"))
 	// get invoice
@@ -66,11 +69,15 @@ func (bot TipBot) donationHandler(ctx context.Context, m *tb.Message) {
 	// send donation invoice
 	// user := LoadUser(ctx)
 	// bot.trySendMessage(user.Telegram, string(body))
-	_, err = user.Wallet.Pay(lnbits.PaymentParams{Out: true, Bolt11: string(body)}, bot.Client)
+	_, err = bot.PayInvoice(user, string(body))
 	if err != nil {
 		userStr := GetUserStr(user.Telegram)
 		errmsg := fmt.Sprintf("[/donate] Donation failed for user %s: %s", userStr, err)
 		log.Errorln(errmsg)
+		if _, ok := err.(spendingLimitError); ok {
+			bot.tryEditMessage(msg, err.Error())
+			return
+		}
 		bot.tryEditMessage(msg, Translate(ctx, "donationErrorMessage"))
 		return
 	}
@@ -0,0 +1,498 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/events"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
+	"github.com/LightningTipBot/LightningTipBot/internal/scheduler"
+	"github.com/LightningTipBot/LightningTipBot/internal/str"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/buntdb"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// event types of outgoing webhooks
+const (
+	EventTipReceived   = "tip.received"
+	EventTipSent       = "tip.sent"
+	EventInvoicePaid   = "invoice.paid"
+	EventFaucetClaimed = "faucet.claimed"
+	EventTipjarFunded  = "tipjar.funded"
+)
+
+const (
+	eventWebhookKeyBase   = "evwebhook-"
+	webhookDeliveryBase   = "evdelivery-"
+	deliverWebhookJob     = "deliver-webhook"
+	webhookMaxCount       = 5
+	webhookDeliveryTTL    = 7 * 24 * time.Hour
+	webhookTimeout        = 10 * time.Second
+	webhookLogSize        = 10
+	webhookSignatureField = "X-LightningTipBot-Signature"
+)
+
+var webhookEvents = []string{EventTipReceived, EventTipSent, EventInvoicePaid, EventFaucetClaimed, EventTipjarFunded}
+
+// EventWebhook is an HTTPS callback of a user or of a group that receives signed events
+type EventWebhook struct {
+	ID      string `json:"id"`
+	OwnerID int    `json:"owner_id"`
+	// ChatID is the group whose events are sent, 0 for the events of the owner
+	ChatID    int64     `json:"chat_id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret"`
+	Events    []string  `json:"events"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (w *EventWebhook) Key() string {
+	return eventWebhookKeyBase + w.ID
+}
+
+func (w *EventWebhook) subscribes(eventType string) bool {
+	for _, e := range w.Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookScope is the prefix of the IDs of the webhooks of a user or a group
+func webhookScope(userID int, chatID int64) string {
+	if chatID != 0 {
+		return fmt.Sprintf("c%d-", chatID)
+	}
+	return fmt.Sprintf("u%d-", userID)
+}
+
+// WebhookEventData describes a payment, amounts are in sat
+type WebhookEventData struct {
+	Amount        int    `json:"amount"`
+	FromID        int    `json:"from_id,omitempty"`
+	From          string `json:"from,omitempty"`
+	ToID          int    `json:"to_id,omitempty"`
+	To            string `json:"to,omitempty"`
+	ChatID        int64  `json:"chat_id,omitempty"`
+	Chat          string `json:"chat,omitempty"`
+	Memo          string `json:"memo,omitempty"`
+	PaymentHash   string `json:"payment_hash,omitempty"`
+	TransactionID uint   `json:"transaction_id,omitempty"`
+	// ReferenceID is the faucet or the tipjar of the event
+	ReferenceID string `json:"reference_id,omitempty"`
+}
+
+// WebhookEvent is the JSON body of a webhook request
+type WebhookEvent struct {
+	ID        string           `json:"id"`
+	Type      string           `json:"type"`
+	CreatedAt time.Time        `json:"created_at"`
+	Data      WebhookEventData `json:"data"`
+}
+
+// WebhookDelivery is the delivery of an event to a webhook, kept as the delivery log
+type WebhookDelivery struct {
+	WebhookID   string    `json:"webhook_id"`
+	EventID     string    `json:"event_id"`
+	EventType   string    `json:"event_type"`
+	Body        string    `json:"body"`
+	Attempts    int       `json:"attempts"`
+	Status      int       `json:"status"`
+	LastError   string    `json:"last_error,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	DeliveredAt time.Time `json:"delivered_at"`
+}
+
+func (d *WebhookDelivery) Key() string {
+	return fmt.Sprintf("%s%s-%s", webhookDeliveryBase, d.WebhookID, d.EventID)
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// signWebhook returns the signature header of a body, the receiver computes the
+// HMAC-SHA256 of "<timestamp>.<body>" with the secret of the webhook
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp, hex.EncodeToString(mac.Sum(nil)))
+}
+
+// privateNetworks can't be reached by webhooks
+var privateNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16", "172.16.0.0/12", "192.168.0.0/16", "::1/128", "fc00::/7", "fe80::/10"} {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+func isPrivateIP(ip net.IP) bool {
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return ip.IsUnspecified() || ip.IsMulticast()
+}
+
+// webhookClient refuses to connect to private addresses, also after redirects and DNS changes
+var webhookClient = &http.Client{
+	Timeout: webhookTimeout,
+	Transport: &http.Transport{
+		Proxy: nil,
+		DialContext: (&net.Dialer{
+			Timeout: webhookTimeout,
+			Control: func(network, address string, c syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || isPrivateIP(ip) {
+					return fmt.Errorf("webhook address %s is not allowed", host)
+				}
+				return nil
+			},
+		}).DialContext,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// validWebhookURL checks that a webhook is an HTTPS URL
+func validWebhookURL(input string) bool {
+	u, err := url.Parse(input)
+	return err == nil && u.Scheme == "https" && len(u.Hostname()) > 0 && u.User == nil
+}
+
+// getEventWebhooks returns the webhooks of a user or a group in the order they were created
+func (bot *TipBot) getEventWebhooks(userID int, chatID int64) []*EventWebhook {
+	webhooks := make([]*EventWebhook, 0)
+	runtime.IgnoreError(bot.Bunt.View(func(tx *buntdb.Tx) error {
+		return tx.AscendKeys(eventWebhookKeyBase+webhookScope(userID, chatID)+"*", func(key, value string) bool {
+			webhook := &EventWebhook{}
+			if json.Unmarshal([]byte(value), webhook) == nil {
+				webhooks = append(webhooks, webhook)
+			}
+			return true
+		})
+	}))
+	sort.SliceStable(webhooks, func(i, j int) bool {
+		return webhooks[i].CreatedAt.Before(webhooks[j].CreatedAt)
+	})
+	return webhooks
+}
+
+// paymentEventData describes a payment in a webhook event
+func paymentEventData(payment events.Payment) WebhookEventData {
+	data := WebhookEventData{
+		Amount:        payment.Amount,
+		ChatID:        payment.ChatID,
+		Chat:          payment.Chat,
+		Memo:          payment.Memo,
+		PaymentHash:   payment.PaymentHash,
+		TransactionID: payment.TransactionID,
+		ReferenceID:   payment.ReferenceID,
+	}
+	if payment.From != nil && payment.From.Telegram != nil {
+		data.FromID, data.From = payment.From.Telegram.ID, GetUserStr(payment.From.Telegram)
+	}
+	if payment.To != nil && payment.To.Telegram != nil {
+		data.ToID, data.To = payment.To.Telegram.ID, GetUserStr(payment.To.Telegram)
+	}
+	return data
+}
+
+// emitPaymentWebhooks turns a payment into the webhook events of the users and the chat involved
+func (bot *TipBot) emitPaymentWebhooks(payment events.Payment) {
+	data := paymentEventData(payment)
+	switch payment.Kind {
+	case events.Tip:
+		bot.emitWebhookEvent(EventTipSent, data, payment.From.Telegram.ID, payment.ChatID)
+		bot.emitWebhookEvent(EventTipReceived, data, payment.To.Telegram.ID, payment.ChatID)
+	case events.FaucetClaim:
+		bot.emitWebhookEvent(EventFaucetClaimed, data, payment.From.Telegram.ID, payment.ChatID)
+	case events.TipjarContribution:
+		bot.emitWebhookEvent(EventTipjarFunded, data, payment.To.Telegram.ID, payment.ChatID)
+	case events.Deposit:
+		bot.emitWebhookEvent(EventInvoicePaid, data, payment.To.Telegram.ID, 0)
+	}
+}
+
+// emitWebhookEvent delivers an event to the webhooks of a user and of a group, chatID 0 skips the group
+func (bot *TipBot) emitWebhookEvent(eventType string, data WebhookEventData, userID int, chatID int64) {
+	webhooks := bot.getEventWebhooks(userID, 0)
+	if chatID != 0 {
+		webhooks = append(webhooks, bot.getEventWebhooks(0, chatID)...)
+	}
+	if len(webhooks) == 0 {
+		return
+	}
+	event := WebhookEvent{ID: "evt_" + randomHex(12), Type: eventType, CreatedAt: time.Now(), Data: data}
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Errorf("[webhook] Could not encode event %s: %s", eventType, err)
+		return
+	}
+	for _, webhook := range webhooks {
+		if !webhook.subscribes(eventType) {
+			continue
+		}
+		delivery := &WebhookDelivery{WebhookID: webhook.ID, EventID: event.ID, EventType: eventType, Body: string(body), CreatedAt: event.CreatedAt}
+		if err = bot.setWebhookDelivery(delivery); err != nil {
+			log.Errorf("[webhook] Could not save delivery %s: %s", delivery.Key(), err)
+			continue
+		}
+		if _, err = bot.Scheduler.Schedule(deliverWebhookJob, time.Now(), delivery.Key()); err != nil {
+			log.Errorf("[webhook] Could not schedule delivery %s: %s", delivery.Key(), err)
+		}
+	}
+}
+
+func (bot *TipBot) setWebhookDelivery(delivery *WebhookDelivery) error {
+	b, err := json.Marshal(delivery)
+	if err != nil {
+		return err
+	}
+	return bot.Bunt.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(delivery.Key(), string(b), &buntdb.SetOptions{Expires: true, TTL: webhookDeliveryTTL})
+		return err
+	})
+}
+
+// deliverWebhookJobHandler sends an event to a webhook. A failed delivery is retried by the scheduler.
+func (bot *TipBot) deliverWebhookJobHandler(job *scheduler.Job) error {
+	var key string
+	if err := job.Decode(&key); err != nil {
+		log.Errorf("[deliverWebhookJobHandler] %s", err)
+		return nil
+	}
+	var delivery WebhookDelivery
+	err := bot.Bunt.View(func(tx *buntdb.Tx) error {
+		value, err := tx.Get(key)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal([]byte(value), &delivery)
+	})
+	if err != nil || !delivery.DeliveredAt.IsZero() {
+		// expired or already delivered
+		return nil
+	}
+	webhook := &EventWebhook{ID: delivery.WebhookID}
+	if bot.Bunt.Get(webhook) != nil {
+		// the webhook was removed
+		return nil
+	}
+	delivery.Attempts++
+	delivery.Status, err = postWebhook(webhook, delivery.EventID, delivery.EventType, []byte(delivery.Body))
+	delivery.LastError = ""
+	if err != nil {
+		delivery.LastError = err.Error()
+	} else {
+		delivery.DeliveredAt = time.Now()
+	}
+	runtime.IgnoreError(bot.setWebhookDelivery(&delivery))
+	if err != nil {
+		return fmt.Errorf("delivery of %s to %s failed: %v", delivery.EventID, webhook.ID, err)
+	}
+	return nil
+}
+
+// postWebhook sends a signed event and returns the HTTP status
+func postWebhook(webhook *EventWebhook, eventID, eventType string, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), webhookTimeout)
+	defer cancel()
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "LightningTipBot-Webhook")
+	request.Header.Set("X-LightningTipBot-Event", eventType)
+	request.Header.Set("X-LightningTipBot-Delivery", eventID)
+	request.Header.Set(webhookSignatureField, signWebhook(webhook.Secret, time.Now().Unix(), body))
+	response, err := webhookClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return response.StatusCode, fmt.Errorf("status %d", response.StatusCode)
+	}
+	return response.StatusCode, nil
+}
+
+// getWebhookDeliveries returns the latest deliveries of a webhook
+func (bot *TipBot) getWebhookDeliveries(webhook *EventWebhook) []*WebhookDelivery {
+	deliveries := make([]*WebhookDelivery, 0)
+	runtime.IgnoreError(bot.Bunt.View(func(tx *buntdb.Tx) error {
+		return tx.AscendKeys(fmt.Sprintf("%s%s-*", webhookDeliveryBase, webhook.ID), func(key, value string) bool {
+			delivery := &WebhookDelivery{}
+			if json.Unmarshal([]byte(value), delivery) == nil {
+				deliveries = append(deliveries, delivery)
+			}
+			return true
+		})
+	}))
+	sort.SliceStable(deliveries, func(i, j int) bool {
+		return deliveries[i].CreatedAt.After(deliveries[j].CreatedAt)
+	})
+	if len(deliveries) > webhookLogSize {
+		deliveries = deliveries[:webhookLogSize]
+	}
+	return deliveries
+}
+
+// webhookHandler invoked on "/webhook [add <url> [<events>]|remove <number>|log <number>]".
+// In groups, admins manage the webhooks of the group.
+func (bot *TipBot) webhookHandler(ctx context.Context, m *tb.Message) {
+	bot.anyTextHandler(ctx, m)
+	user := LoadUser(ctx)
+	if user.Wallet == nil {
+		return
+	}
+	var chatID int64
+	if !m.Private() {
+		// the command can contain the URL of the webhook
+		NewMessage(m, WithDuration(0, bot))
+		member, err := bot.Telegram.ChatMemberOf(m.Chat, m.Sender)
+		if err != nil || (member.Role != tb.Creator && member.Role != tb.Administrator) {
+			bot.trySendMessage(m.Sender, Translate(ctx, "webhookNotAdminMessage"))
+			return
+		}
+		chatID = m.Chat.ID
+	}
+	webhooks := bot.getEventWebhooks(user.Telegram.ID, chatID)
+	action, err := getArgumentFromCommand(m.Text, 1)
+	if err != nil {
+		bot.trySendMessage(m.Sender, bot.makeWebhooksMessage(ctx, m.Chat, webhooks))
+		return
+	}
+	argument, _ := getArgumentFromCommand(m.Text, 2)
+	switch strings.ToLower(action) {
+	case "add":
+		events := webhookEvents
+		if eventsStr, err := getArgumentFromCommand(m.Text, 3); err == nil {
+			events = strings.Split(strings.ToLower(eventsStr), ",")
+		}
+		bot.addEventWebhook(ctx, user, chatID, webhooks, argument, events)
+		return
+	case "remove", "log":
+		i, err := strconv.Atoi(argument)
+		if err != nil || i < 1 || i > len(webhooks) {
+			bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "webhookUnknownMessage"), str.MarkdownEscape(argument)))
+			return
+		}
+		if strings.ToLower(action) == "log" {
+			bot.trySendMessage(m.Sender, bot.makeWebhookLogMessage(ctx, user, webhooks[i-1]))
+			return
+		}
+		bot.removeEventWebhook(ctx, user, webhooks[i-1])
+		return
+	}
+	bot.trySendMessage(m.Sender, Translate(ctx, "webhookHelpText"))
+}
+
+func (bot *TipBot) addEventWebhook(ctx context.Context, user *lnbits.User, chatID int64, webhooks []*EventWebhook, webhookURL string, events []string) {
+	if !validWebhookURL(webhookURL) {
+		bot.trySendMessage(user.Telegram, Translate(ctx, "webhookInvalidURLMessage"))
+		return
+	}
+	for _, event := range events {
+		if !(&EventWebhook{Events: webhookEvents}).subscribes(event) {
+			bot.trySendMessage(user.Telegram, Translate(ctx, "webhookHelpText"))
+			return
+		}
+	}
+	if len(webhooks) >= webhookMaxCount {
+		bot.trySendMessage(user.Telegram, fmt.Sprintf(Translate(ctx, "webhookTooManyMessage"), webhookMaxCount))
+		return
+	}
+	webhook := &EventWebhook{
+		ID:        webhookScope(user.Telegram.ID, chatID) + randomHex(6),
+		OwnerID:   user.Telegram.ID,
+		ChatID:    chatID,
+		URL:       webhookURL,
+		Secret:    "whsec_" + randomHex(24),
+		Events:    events,
+		CreatedAt: time.Now(),
+	}
+	err := bot.Bunt.Set(webhook)
+	if err != nil {
+		log.Errorf("[/webhook] Could not save webhook of %s: %s", GetUserStr(user.Telegram), err)
+		bot.trySendMessage(user.Telegram, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	log.Infof("[/webhook] %s added webhook %s for %s", GetUserStr(user.Telegram), webhook.ID, strings.Join(events, ","))
+	bot.trySendMessage(user.Telegram, fmt.Sprintf(Translate(ctx, "webhookAddedMessage"), str.MarkdownEscape(webhookURL), strings.Join(events, ", "), webhook.Secret, webhookSignatureField))
+}
+
+func (bot *TipBot) removeEventWebhook(ctx context.Context, user *lnbits.User, webhook *EventWebhook) {
+	err := bot.Bunt.Update(func(tx *buntdb.Tx) error {
+		_, err := tx.Delete(webhook.Key())
+		return err
+	})
+	if err != nil {
+		log.Errorf("[/webhook] Could not remove webhook of %s: %s", GetUserStr(user.Telegram), err)
+		bot.trySendMessage(user.Telegram, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	log.Infof("[/webhook] %s removed webhook %s", GetUserStr(user.Telegram), webhook.ID)
+	bot.trySendMessage(user.Telegram, fmt.Sprintf(Translate(ctx, "webhookRemovedMessage"), str.MarkdownEscape(webhook.URL)))
+}
+
+func (bot *TipBot) makeWebhooksMessage(ctx context.Context, chat *tb.Chat, webhooks []*EventWebhook) string {
+	title := Translate(ctx, "webhookYourEventsMessage")
+	if chat.Type != tb.ChatPrivate {
+		title = str.MarkdownEscape(chat.Title)
+	}
+	if len(webhooks) == 0 {
+		return fmt.Sprintf(Translate(ctx, "webhookNoneMessage"), title) + Translate(ctx, "webhookUsageMessage")
+	}
+	lines := make([]string, len(webhooks))
+	for i, webhook := range webhooks {
+		lines[i] = fmt.Sprintf(Translate(ctx, "webhookEntryMessage"), i+1, str.MarkdownEscape(webhook.URL), strings.Join(webhook.Events, ", "))
+	}
+	return fmt.Sprintf(Translate(ctx, "webhooksMessage"), title, strings.Join(lines, "\n")) + Translate(ctx, "webhookUsageMessage")
+}
+
+func (bot *TipBot) makeWebhookLogMessage(ctx context.Context, user *lnbits.User, webhook *EventWebhook) string {
+	deliveries := bot.getWebhookDeliveries(webhook)
+	if len(deliveries) == 0 {
+		return fmt.Sprintf(Translate(ctx, "webhookLogEmptyMessage"), str.MarkdownEscape(webhook.URL))
+	}
+	lines := make([]string, len(deliveries))
+	for i, delivery := range deliveries {
+		status := "✅"
+		if delivery.DeliveredAt.IsZero() {
+			status = "⏳ " + str.MarkdownEscape(delivery.LastError)
+		}
+		lines[i] = fmt.Sprintf(Translate(ctx, "webhookLogEntryMessage"), formatUserTime(user, delivery.CreatedAt), delivery.EventType, delivery.Attempts, status)
+	}
+	return fmt.Sprintf(Translate(ctx, "webhookLogMessage"), str.MarkdownEscape(webhook.URL), strings.Join(lines, "\n"))
+}
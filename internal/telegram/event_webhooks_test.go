@@ -0,0 +1,65 @@
+package telegram
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/scheduler"
+	"github.com/LightningTipBot/LightningTipBot/internal/storage"
+)
+
+func TestSignWebhook(t *testing.T) {
+	// echo -n '1600000000.{}' | openssl dgst -sha256 -hmac secret
+	want := "t=1600000000,v1=1e56a11da123b137c26fa37b7c222060bdf22988aa9b3248c31244f8b2ef4a28"
+	if got := signWebhook("secret", 1600000000, []byte("{}")); got != want {
+		t.Errorf("signWebhook() = %s", got)
+	}
+	if signWebhook("secret", 1, []byte("{}")) == signWebhook("other", 1, []byte("{}")) {
+		t.Errorf("signWebhook() does not depend on the secret")
+	}
+}
+
+func TestValidWebhookURL(t *testing.T) {
+	for url, valid := range map[string]bool{
+		"https://example.com/hook":      true,
+		"http://example.com/hook":       false,
+		"https://user:pw@example.com/x": false,
+		"example.com":                   false,
+	} {
+		if validWebhookURL(url) != valid {
+			t.Errorf("validWebhookURL(%s) = %t", url, !valid)
+		}
+	}
+	for ip, private := range map[string]bool{"127.0.0.1": true, "10.1.2.3": true, "169.254.169.254": true, "::1": true, "1.1.1.1": false} {
+		if isPrivateIP(net.ParseIP(ip)) != private {
+			t.Errorf("isPrivateIP(%s) = %t", ip, !private)
+		}
+	}
+}
+
+func TestTipBot_EmitWebhookEvent(t *testing.T) {
+	bunt := storage.NewBunt(":memory:")
+	bot := &TipBot{Bunt: bunt, Scheduler: scheduler.New(bunt)}
+	webhooks := []*EventWebhook{
+		{ID: webhookScope(1, 0) + "a", OwnerID: 1, URL: "https://example.com/a", Events: []string{EventTipReceived}, CreatedAt: time.Now()},
+		{ID: webhookScope(2, 0) + "b", OwnerID: 2, URL: "https://example.com/b", Events: webhookEvents, CreatedAt: time.Now()},
+		{ID: webhookScope(2, -100) + "c", OwnerID: 2, ChatID: -100, URL: "https://example.com/c", Events: []string{EventTipSent}, CreatedAt: time.Now()},
+	}
+	for _, webhook := range webhooks {
+		if err := bot.Bunt.Set(webhook); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bot.emitWebhookEvent(EventTipSent, WebhookEventData{Amount: 21}, 1, -100)
+	if deliveries := bot.getWebhookDeliveries(webhooks[0]); len(deliveries) != 0 {
+		t.Errorf("webhook without the event got %d deliveries", len(deliveries))
+	}
+	if deliveries := bot.getWebhookDeliveries(webhooks[1]); len(deliveries) != 0 {
+		t.Errorf("webhook of another user got %d deliveries", len(deliveries))
+	}
+	deliveries := bot.getWebhookDeliveries(webhooks[2])
+	if len(deliveries) != 1 || deliveries[0].EventType != EventTipSent || !deliveries[0].DeliveredAt.IsZero() {
+		t.Fatalf("getWebhookDeliveries() = %+v", deliveries)
+	}
+}
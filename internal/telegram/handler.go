@@ -160,6 +160,191 @@ func (bot TipBot) getHandler() []Handler {
 				Type:   MessageInterceptor,
 				Before: []intercept.Func{bot.requireUserInterceptor}},
 		},
+		{
+			Endpoints: []interface{}{"/subscribe"},
+			Handler:   bot.subscribeHandler,
+			Interceptor: &Interceptor{
+				Type: MessageInterceptor,
+				Before: []intercept.Func{
+					bot.logMessageInterceptor,
+					bot.loadUserInterceptor}},
+		},
+		{
+			Endpoints: []interface{}{"/subscriptions"},
+			Handler:   bot.subscriptionsHandler,
+			Interceptor: &Interceptor{
+				Type: MessageInterceptor,
+				Before: []intercept.Func{
+					bot.logMessageInterceptor,
+					bot.loadUserInterceptor}},
+		},
+		{
+			Endpoints: []interface{}{"/scheduled"},
+			Handler:   bot.scheduledHandler,
+			Interceptor: &Interceptor{
+				Type: MessageInterceptor,
+				Before: []intercept.Func{
+					bot.logMessageInterceptor,
+					bot.loadUserInterceptor}},
+		},
+		{
+			Endpoints: []interface{}{"/timezone"},
+			Handler:   bot.timezoneHandler,
+			Interceptor: &Interceptor{
+				Type: MessageInterceptor,
+				Before: []intercept.Func{
+					bot.logMessageInterceptor,
+					bot.loadUserInterceptor}},
+		},
+		{
+			Endpoints: []interface{}{"/voucher"},
+			Handler:   bot.voucherHandler,
+			Interceptor: &Interceptor{
+				Type: MessageInterceptor,
+				Before: []intercept.Func{
+					bot.logMessageInterceptor,
+					bot.loadUserInterceptor}},
+		},
+		{
+			Endpoints: []interface{}{"/redeem"},
+			Handler:   bot.redeemHandler,
+			Interceptor: &Interceptor{
+				Type: MessageInterceptor,
+				Before: []intercept.Func{
+					bot.logMessageInterceptor,
+					bot.loadUserInterceptor}},
+		},
+		{
+			Endpoints: []interface{}{"/wallets"},
+			Handler:   bot.walletsHandler,
+			Interceptor: &Interceptor{
+				Type: MessageInterceptor,
+				Before: []intercept.Func{
+					bot.logMessageInterceptor,
+					bot.loadUserInterceptor}},
+		},
+		{
+			Endpoints: []interface{}{"/move"},
+			Handler:   bot.moveHandler,
+			Interceptor: &Interceptor{
+				Type: MessageInterceptor,
+				Before: []intercept.Func{
+					bot.logMessageInterceptor,
+					bot.loadUserInterceptor}},
+		},
+		{
+			Endpoints: []interface{}{"/vault"},
+			Handler:   bot.vaultHandler,
+			Interceptor: &Interceptor{
+				Type: MessageInterceptor,
+				Before: []intercept.Func{
+					bot.logMessageInterceptor,
+					bot.loadUserInterceptor}},
+		},
+		{
+			Endpoints: []interface{}{"/limits"},
+			Handler:   bot.limitsHandler,
+			Interceptor: &Interceptor{
+				Type: MessageInterceptor,
+				Before: []intercept.Func{
+					bot.logMessageInterceptor,
+					bot.loadUserInterceptor}},
+		},
+		{
+			Endpoints: []interface{}{"/pin"},
+			Handler:   bot.pinHandler,
+			Interceptor: &Interceptor{
+				Type: MessageInterceptor,
+				Before: []intercept.Func{
+					bot.logMessageInterceptor,
+					bot.loadUserInterceptor}},
+		},
+		{
+			Endpoints: []interface{}{"/nwc"},
+			Handler:   bot.nwcHandler,
+			Interceptor: &Interceptor{
+				Type: MessageInterceptor,
+				Before: []intercept.Func{
+					bot.logMessageInterceptor,
+					bot.loadUserInterceptor,
+				}},
+		},
+		{
+			Endpoints: []interface{}{"/apikey"},
+			Handler:   bot.apikeyHandler,
+			Interceptor: &Interceptor{
+				Type: MessageInterceptor,
+				Before: []intercept.Func{
+					bot.logMessageInterceptor,
+					bot.loadUserInterceptor,
+				}},
+		},
+		{
+			Endpoints: []interface{}{"/webhook"},
+			Handler:   bot.webhookHandler,
+			Interceptor: &Interceptor{
+				Type: MessageInterceptor,
+				Before: []intercept.Func{
+					bot.logMessageInterceptor,
+					bot.loadUserInterceptor,
+				}},
+		},
+		{
+			Endpoints: []interface{}{"/notifications"},
+			Handler:   bot.notificationsHandler,
+			Interceptor: &Interceptor{
+				Type: MessageInterceptor,
+				Before: []intercept.Func{
+					bot.logMessageInterceptor,
+					bot.loadUserInterceptor,
+				}},
+		},
+		{
+			Endpoints: []interface{}{"/joinfee"},
+			Handler:   bot.joinFeeHandler,
+			Interceptor: &Interceptor{
+				Type: MessageInterceptor,
+				Before: []intercept.Func{
+					bot.logMessageInterceptor,
+					bot.requireUserInterceptor}},
+		},
+		{
+			Endpoints: []interface{}{"/paywall"},
+			Handler:   bot.paywallHandler,
+			Interceptor: &Interceptor{
+				Type: MessageInterceptor,
+				Before: []intercept.Func{
+					bot.logMessageInterceptor,
+					bot.loadUserInterceptor}},
+		},
+		{
+			Endpoints: []interface{}{"/bounty"},
+			Handler:   bot.bountyHandler,
+			Interceptor: &Interceptor{
+				Type: MessageInterceptor,
+				Before: []intercept.Func{
+					bot.logMessageInterceptor,
+					bot.loadUserInterceptor}},
+		},
+		{
+			Endpoints: []interface{}{"/splitbill"},
+			Handler:   bot.splitbillHandler,
+			Interceptor: &Interceptor{
+				Type: MessageInterceptor,
+				Before: []intercept.Func{
+					bot.logMessageInterceptor,
+					bot.requireUserInterceptor}},
+		},
+		{
+			Endpoints: []interface{}{"/rain"},
+			Handler:   bot.rainHandler,
+			Interceptor: &Interceptor{
+				Type: MessageInterceptor,
+				Before: []intercept.Func{
+					bot.logMessageInterceptor,
+					bot.loadUserInterceptor,
+				}},
+		},
 		{
 			Endpoints: []interface{}{"/help"},
 			Handler:   bot.helpHandler,
@@ -224,6 +409,7 @@ func (bot TipBot) getHandler() []Handler {
 			Interceptor: &Interceptor{
 				Type: MessageInterceptor,
 				Before: []intercept.Func{
+					bot.trackActivityInterceptor,
 					bot.requirePrivateChatInterceptor,
 					bot.logMessageInterceptor,
 					bot.loadUserInterceptor}},
@@ -234,6 +420,8 @@ func (bot TipBot) getHandler() []Handler {
 			Interceptor: &Interceptor{
 				Type: MessageInterceptor,
 				Before: []intercept.Func{
+					bot.trackActivityInterceptor, // Remember active users in groups for /rain
+					bot.bountyClaimInterceptor,   // Replies to a /bounty are claims
 					bot.requirePrivateChatInterceptor,
 					bot.logMessageInterceptor, // Log message only if private chat
 					bot.loadUserInterceptor,
@@ -281,6 +469,20 @@ func (bot TipBot) getHandler() []Handler {
 				Type:   CallbackInterceptor,
 				Before: []intercept.Func{bot.loadUserInterceptor}},
 		},
+		{
+			Endpoints: []interface{}{&btnBatchSend},
+			Handler:   bot.confirmBatchSendHandler,
+			Interceptor: &Interceptor{
+				Type:   CallbackInterceptor,
+				Before: []intercept.Func{bot.loadUserInterceptor}},
+		},
+		{
+			Endpoints: []interface{}{&btnCancelBatchSend},
+			Handler:   bot.cancelBatchSendHandler,
+			Interceptor: &Interceptor{
+				Type:   CallbackInterceptor,
+				Before: []intercept.Func{bot.loadUserInterceptor}},
+		},
 		{
 			Endpoints: []interface{}{&btnAcceptInlineSend},
 			Handler:   bot.acceptInlineSendHandler,
@@ -330,6 +532,13 @@ func (bot TipBot) getHandler() []Handler {
 				Type:   CallbackInterceptor,
 				Before: []intercept.Func{bot.loadUserInterceptor}},
 		},
+		{
+			Endpoints: []interface{}{&btnContributeTipjar},
+			Handler:   bot.contributeTipjarHandler,
+			Interceptor: &Interceptor{
+				Type:   CallbackInterceptor,
+				Before: []intercept.Func{bot.loadUserInterceptor}},
+		},
 		{
 			Endpoints: []interface{}{&btnCancelInlineTipjar},
 			Handler:   bot.cancelInlineTipjarHandler,
@@ -337,5 +546,75 @@ func (bot TipBot) getHandler() []Handler {
 				Type:   CallbackInterceptor,
 				Before: []intercept.Func{bot.loadUserInterceptor}},
 		},
+		{
+			Endpoints: []interface{}{&btnAcceptSplitbill},
+			Handler:   bot.acceptSplitbillHandler,
+			Interceptor: &Interceptor{
+				Type:   CallbackInterceptor,
+				Before: []intercept.Func{bot.loadUserInterceptor}},
+		},
+		{
+			Endpoints: []interface{}{&btnRemindSplitbill},
+			Handler:   bot.remindSplitbillHandler,
+			Interceptor: &Interceptor{
+				Type:   CallbackInterceptor,
+				Before: []intercept.Func{bot.loadUserInterceptor}},
+		},
+		{
+			Endpoints: []interface{}{&btnCancelSplitbill},
+			Handler:   bot.cancelSplitbillHandler,
+			Interceptor: &Interceptor{
+				Type:   CallbackInterceptor,
+				Before: []intercept.Func{bot.loadUserInterceptor}},
+		},
+		{
+			Endpoints: []interface{}{&btnAwardBounty},
+			Handler:   bot.awardBountyHandler,
+			Interceptor: &Interceptor{
+				Type:   CallbackInterceptor,
+				Before: []intercept.Func{bot.loadUserInterceptor}},
+		},
+		{
+			Endpoints: []interface{}{&btnCancelBounty},
+			Handler:   bot.cancelBountyHandler,
+			Interceptor: &Interceptor{
+				Type:   CallbackInterceptor,
+				Before: []intercept.Func{bot.loadUserInterceptor}},
+		},
+		{
+			Endpoints: []interface{}{&btnUnlockPaywall},
+			Handler:   bot.unlockPaywallHandler,
+			Interceptor: &Interceptor{
+				Type:   CallbackInterceptor,
+				Before: []intercept.Func{bot.loadUserInterceptor}},
+		},
+		{
+			Endpoints: []interface{}{&btnPayJoinRequest},
+			Handler:   bot.payJoinRequestHandler,
+			Interceptor: &Interceptor{
+				Type:   CallbackInterceptor,
+				Before: []intercept.Func{bot.loadUserInterceptor}},
+		},
+		{
+			Endpoints: []interface{}{&btnCancelSubscription},
+			Handler:   bot.cancelSubscriptionHandler,
+			Interceptor: &Interceptor{
+				Type:   CallbackInterceptor,
+				Before: []intercept.Func{bot.loadUserInterceptor}},
+		},
+		{
+			Endpoints: []interface{}{&btnCancelScheduledSend},
+			Handler:   bot.cancelScheduledSendHandler,
+			Interceptor: &Interceptor{
+				Type:   CallbackInterceptor,
+				Before: []intercept.Func{bot.loadUserInterceptor}},
+		},
+		{
+			Endpoints: []interface{}{&btnUndoTip},
+			Handler:   bot.undoTipHandler,
+			Interceptor: &Interceptor{
+				Type:   CallbackInterceptor,
+				Before: []intercept.Func{bot.loadUserInterceptor}},
+		},
 	}
 }
@@ -3,8 +3,10 @@ package telegram
 import (
 	"math"
 	"math/rand"
+	"strconv"
 	"strings"
 	"time"
+	"unicode"
 )
 
 func init() {
@@ -34,6 +36,23 @@ func GetMemoFromCommand(command string, fromWord int) string {
 	return memo
 }
 
+// getDuration parses durations like "30m", "12h" or "7d"
+func getDuration(input string) (time.Duration, error) {
+	if strings.HasSuffix(input, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(input, "d"))
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(input)
+}
+
+// hasDurationUnit checks whether the input ends with a unit like getDuration expects, "0" has none
+func hasDurationUnit(input string) bool {
+	return len(input) > 0 && unicode.IsLetter(rune(input[len(input)-1]))
+}
+
 func MakeProgressbar(current int, total int) string {
 	MAX_BARS := 16
 	progress := math.Round((float64(current) / float64(total)) * float64(MAX_BARS))
@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/LightningTipBot/LightningTipBot/internal/errors"
+	"github.com/LightningTipBot/LightningTipBot/internal/events"
 	"github.com/LightningTipBot/LightningTipBot/internal/i18n"
 
 	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
@@ -24,17 +25,17 @@ var (
 
 type InlineFaucet struct {
 	*transaction.Base
-	Message         string         `json:"inline_faucet_message"`
-	Amount          int            `json:"inline_faucet_amount"`
-	RemainingAmount int            `json:"inline_faucet_remainingamount"`
-	PerUserAmount   int            `json:"inline_faucet_peruseramount"`
-	From            *lnbits.User   `json:"inline_faucet_from"`
-	To              []*lnbits.User `json:"inline_faucet_to"`
-	Memo            string         `json:"inline_faucet_memo"`
-	NTotal          int            `json:"inline_faucet_ntotal"`
-	NTaken          int            `json:"inline_faucet_ntaken"`
-	UserNeedsWallet bool           `json:"inline_faucet_userneedswallet"`
-	LanguageCode    string         `json:"languagecode"`
+	Message         string           `json:"inline_faucet_message"`
+	Amount          int              `json:"inline_faucet_amount"`
+	RemainingAmount int              `json:"inline_faucet_remainingamount"`
+	PerUserAmount   int              `json:"inline_faucet_peruseramount"`
+	From            lnbits.UserRef   `json:"inline_faucet_from"`
+	To              []lnbits.UserRef `json:"inline_faucet_to"`
+	Memo            string           `json:"inline_faucet_memo"`
+	NTotal          int              `json:"inline_faucet_ntotal"`
+	NTaken          int              `json:"inline_faucet_ntaken"`
+	UserNeedsWallet bool             `json:"inline_faucet_userneedswallet"`
+	LanguageCode    string           `json:"languagecode"`
 }
 
 func (bot TipBot) mapFaucetLanguage(ctx context.Context, command string) context.Context {
@@ -85,7 +86,7 @@ func (bot TipBot) createFaucet(ctx context.Context, text string, sender *tb.User
 		Base:            transaction.New(transaction.ID(id)),
 		Message:         inlineMessage,
 		Amount:          amount,
-		From:            fromUser,
+		From:            fromUser.Ref(),
 		Memo:            memo,
 		PerUserAmount:   perUserAmount,
 		NTotal:          nTotal,
@@ -184,6 +185,10 @@ func (bot TipBot) faucetHandler(ctx context.Context, m *tb.Message) {
 		log.Errorf("[faucet] %s", err)
 		return
 	}
+	// the claims of large faucets are confirmed with the PIN once
+	if bot.requirePinForCommand(ctx, LoadUser(ctx), inlineFaucet.Amount, m) {
+		return
+	}
 	fromUserStr := GetUserStr(m.Sender)
 	bot.trySendMessage(m.Chat, inlineFaucet.Message, bot.makeFaucetKeyboard(ctx, inlineFaucet.ID))
 	log.Infof("[faucet] %s created faucet %s: %d sat (%d per user)", fromUserStr, inlineFaucet.ID, inlineFaucet.Amount, inlineFaucet.PerUserAmount)
@@ -196,6 +201,11 @@ func (bot TipBot) handleInlineFaucetQuery(ctx context.Context, q *tb.Query) {
 		// log.Errorf("[faucet] %s", err)
 		return
 	}
+	// the PIN can't be entered in inline queries
+	if bot.PinRequired(LoadUser(ctx), inlineFaucet.Amount) {
+		bot.inlineQueryReplyWithError(q, TranslateUser(ctx, "inlineQueryPinRequiredMessage"), fmt.Sprintf(TranslateUser(ctx, "inlineQueryFaucetDescription"), bot.Telegram.Me.Username))
+		return
+	}
 	urls := []string{
 		queryImage,
 	}
@@ -215,7 +225,7 @@ func (bot TipBot) handleInlineFaucetQuery(ctx context.Context, q *tb.Query) {
 		results[i].SetResultID(inlineFaucet.ID)
 
 		runtime.IgnoreError(inlineFaucet.Set(inlineFaucet, bot.Bunt))
-		log.Infof("[faucet] %s created inline faucet %s: %d sat (%d per user)", GetUserStr(inlineFaucet.From.Telegram), inlineFaucet.ID, inlineFaucet.Amount, inlineFaucet.PerUserAmount)
+		log.Infof("[faucet] %s created inline faucet %s: %d sat (%d per user)", GetUserStr(&q.From), inlineFaucet.ID, inlineFaucet.Amount, inlineFaucet.PerUserAmount)
 	}
 
 	err = bot.Telegram.Answer(q, &tb.QueryResponse{
@@ -236,7 +246,6 @@ func (bot *TipBot) acceptInlineFaucetHandler(ctx context.Context, c *tb.Callback
 		return
 	}
 	inlineFaucet := fn.(*InlineFaucet)
-	from := inlineFaucet.From
 	err = inlineFaucet.Lock(inlineFaucet, bot.Bunt)
 	if err != nil {
 		log.Errorf("[faucet] LockFaucet %s error: %s", inlineFaucet.ID, err)
@@ -249,13 +258,18 @@ func (bot *TipBot) acceptInlineFaucetHandler(ctx context.Context, c *tb.Callback
 	// release faucet no matter what
 	defer inlineFaucet.Release(inlineFaucet, bot.Bunt)
 
+	from, err := bot.loadUser(inlineFaucet.From)
+	if err != nil {
+		log.Errorf("[faucet] %s", err)
+		return
+	}
 	if from.Telegram.ID == to.Telegram.ID {
 		bot.trySendMessage(from.Telegram, Translate(ctx, "sendYourselfMessage"))
 		return
 	}
 	// check if to user has already taken from the faucet
 	for _, a := range inlineFaucet.To {
-		if a.Telegram.ID == to.Telegram.ID {
+		if a.TelegramID == to.Telegram.ID {
 			// to user is already in To slice, has taken from facuet
 			// log.Infof("[faucet] %s already took from faucet %s", GetUserStr(to.Telegram), inlineFaucet.ID)
 			return
@@ -263,8 +277,6 @@ func (bot *TipBot) acceptInlineFaucetHandler(ctx context.Context, c *tb.Callback
 	}
 
 	if inlineFaucet.RemainingAmount >= inlineFaucet.PerUserAmount {
-		toUserStrMd := GetUserStrMd(to.Telegram)
-		fromUserStrMd := GetUserStrMd(from.Telegram)
 		toUserStr := GetUserStr(to.Telegram)
 		fromUserStr := GetUserStr(from.Telegram)
 		// check if user exists and create a wallet if not
@@ -285,7 +297,7 @@ func (bot *TipBot) acceptInlineFaucetHandler(ctx context.Context, c *tb.Callback
 
 		// todo: user new get username function to get userStrings
 		transactionMemo := fmt.Sprintf("Faucet from %s to %s (%d sat).", fromUserStr, toUserStr, inlineFaucet.PerUserAmount)
-		t := NewTransaction(bot, from, to, inlineFaucet.PerUserAmount, TransactionType("faucet"))
+		t := NewTransaction(bot, from, to, inlineFaucet.PerUserAmount, TransactionType("faucet"), TransactionConfirmed())
 		t.Memo = transactionMemo
 
 		success, err := t.Send()
@@ -296,19 +308,13 @@ func (bot *TipBot) acceptInlineFaucetHandler(ctx context.Context, c *tb.Callback
 			return
 		}
 
-		log.Infof("[faucet] faucet %s: %d sat from %s to %s ", inlineFaucet.ID, inlineFaucet.PerUserAmount, fromUserStr, toUserStr)
+		payment := transactionPayment(events.FaucetClaim, t)
+		payment.ReferenceID = inlineFaucet.ID
+		bot.Events.Publish(payment)
 		inlineFaucet.NTaken += 1
-		inlineFaucet.To = append(inlineFaucet.To, to)
+		inlineFaucet.To = append(inlineFaucet.To, to.Ref())
 		inlineFaucet.RemainingAmount = inlineFaucet.RemainingAmount - inlineFaucet.PerUserAmount
 
-		_, err = bot.Telegram.Send(to.Telegram, fmt.Sprintf(i18n.Translate(to.Telegram.LanguageCode, "inlineFaucetReceivedMessage"), fromUserStrMd, inlineFaucet.PerUserAmount))
-		_, err = bot.Telegram.Send(from.Telegram, fmt.Sprintf(i18n.Translate(from.Telegram.LanguageCode, "inlineFaucetSentMessage"), inlineFaucet.PerUserAmount, toUserStrMd))
-		if err != nil {
-			errmsg := fmt.Errorf("[faucet] Error: Send message to %s: %s", toUserStr, err)
-			log.Errorln(errmsg)
-			return
-		}
-
 		// build faucet message
 		inlineFaucet.Message = fmt.Sprintf(i18n.Translate(inlineFaucet.LanguageCode, "inlineFaucetMessage"), inlineFaucet.PerUserAmount, inlineFaucet.RemainingAmount, inlineFaucet.Amount, inlineFaucet.NTaken, inlineFaucet.NTotal, MakeProgressbar(inlineFaucet.RemainingAmount, inlineFaucet.Amount))
 		memo := inlineFaucet.Memo
@@ -342,7 +348,7 @@ func (bot *TipBot) cancelInlineFaucetHandler(ctx context.Context, c *tb.Callback
 		return
 	}
 	inlineFaucet := fn.(*InlineFaucet)
-	if c.Sender.ID == inlineFaucet.From.Telegram.ID {
+	if c.Sender.ID == inlineFaucet.From.TelegramID {
 		bot.tryEditMessage(c.Message, i18n.Translate(inlineFaucet.LanguageCode, "inlineFaucetCancelledMessage"), &tb.ReplyMarkup{})
 		// set the inlineFaucet inactive
 		inlineFaucet.Active = false
@@ -22,13 +22,13 @@ var (
 
 type InlineReceive struct {
 	*transaction.Base
-	Message           string       `json:"inline_receive_message"`
-	Amount            int          `json:"inline_receive_amount"`
-	From              *lnbits.User `json:"inline_receive_from"`
-	To                *lnbits.User `json:"inline_receive_to"`
-	From_SpecificUser bool         `json:"from_specific_user"`
-	Memo              string       `json:"inline_receive_memo"`
-	LanguageCode      string       `json:"languagecode"`
+	Message           string         `json:"inline_receive_message"`
+	Amount            int            `json:"inline_receive_amount"`
+	From              lnbits.UserRef `json:"inline_receive_from"`
+	To                lnbits.UserRef `json:"inline_receive_to"`
+	From_SpecificUser bool           `json:"from_specific_user"`
+	Memo              string         `json:"inline_receive_memo"`
+	LanguageCode      string         `json:"languagecode"`
 }
 
 func (bot TipBot) makeReceiveKeyboard(ctx context.Context, id string) *tb.ReplyMarkup {
@@ -61,6 +61,7 @@ func (bot TipBot) handleInlineReceiveQuery(ctx context.Context, q *tb.Query) {
 	// command is "@LightningTipBot receive 123 @from_user This is the memo"
 	memo_argn := 2 // argument index at which the memo starts, will be 3 if there is a from_username in command
 	fromUserDb := &lnbits.User{}
+	fromUser := lnbits.UserRef{}
 	from_SpecificUser := false
 	if len(strings.Split(q.Text, " ")) > 2 {
 		from_username := strings.Split(q.Text, " ")[2]
@@ -76,6 +77,7 @@ func (bot TipBot) handleInlineReceiveQuery(ctx context.Context, q *tb.Query) {
 				return
 			}
 			memo_argn = 3 // assume that memo starts after the from_username
+			fromUser = fromUserDb.Ref()
 			from_SpecificUser = true
 		}
 	}
@@ -114,10 +116,10 @@ func (bot TipBot) handleInlineReceiveQuery(ctx context.Context, q *tb.Query) {
 		inlineReceive := InlineReceive{
 			Base:              transaction.New(transaction.ID(id)),
 			Message:           inlineMessage,
-			To:                to,
+			To:                to.Ref(),
 			Memo:              memo,
 			Amount:            amount,
-			From:              fromUserDb,
+			From:              fromUser,
 			From_SpecificUser: from_SpecificUser,
 			LanguageCode:      ctx.Value("publicLanguageCode").(string),
 		}
@@ -164,16 +166,20 @@ func (bot *TipBot) acceptInlineReceiveHandler(ctx context.Context, c *tb.Callbac
 	}
 	// check if this payment is requested from a specific user
 	if inlineReceive.From_SpecificUser {
-		if inlineReceive.From.Telegram.ID != from.Telegram.ID {
+		if inlineReceive.From.TelegramID != from.Telegram.ID {
 			// log.Infof("User %d is not User %d", inlineReceive.From.Telegram.ID, from.Telegram.ID)
 			return
 		}
 	} else {
 		// otherwise, we just set it to the user who has clicked
-		inlineReceive.From = from
+		inlineReceive.From = from.Ref()
 	}
 
-	to := inlineReceive.To
+	to, err := bot.loadUser(inlineReceive.To)
+	if err != nil {
+		log.Errorf("[acceptInlineReceiveHandler] %s", err)
+		return
+	}
 	toUserStrMd := GetUserStrMd(to.Telegram)
 	fromUserStrMd := GetUserStrMd(from.Telegram)
 	toUserStr := GetUserStr(to.Telegram)
@@ -197,12 +203,16 @@ func (bot *TipBot) acceptInlineReceiveHandler(ctx context.Context, c *tb.Callbac
 		return
 	}
 
+	// large payments wait for the PIN
+	if bot.requirePinForCallback(ctx, from, inlineReceive.Amount, "receive", c) {
+		return
+	}
 	// set inactive to avoid double-sends
 	inlineReceive.Inactivate(inlineReceive, bot.Bunt)
 
 	// todo: user new get username function to get userStrings
 	transactionMemo := fmt.Sprintf("InlineReceive from %s to %s (%d sat).", fromUserStr, toUserStr, inlineReceive.Amount)
-	t := NewTransaction(bot, from, to, inlineReceive.Amount, TransactionType("inline receive"))
+	t := NewTransaction(bot, from, to, inlineReceive.Amount, TransactionType("inline receive"), TransactionConfirmed())
 	t.Memo = transactionMemo
 	success, err := t.Send()
 	if !success {
@@ -244,7 +254,7 @@ func (bot *TipBot) cancelInlineReceiveHandler(ctx context.Context, c *tb.Callbac
 		return
 	}
 	inlineReceive := rn.(*InlineReceive)
-	if c.Sender.ID == inlineReceive.To.Telegram.ID {
+	if c.Sender.ID == inlineReceive.To.TelegramID {
 		bot.tryEditMessage(c.Message, i18n.Translate(inlineReceive.LanguageCode, "inlineReceiveCancelledMessage"), &tb.ReplyMarkup{})
 		// set the inlineReceive inactive
 		inlineReceive.Active = false
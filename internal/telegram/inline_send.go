@@ -23,13 +23,13 @@ var (
 
 type InlineSend struct {
 	*transaction.Base
-	Message         string       `json:"inline_send_message"`
-	Amount          int          `json:"inline_send_amount"`
-	From            *lnbits.User `json:"inline_send_from"`
-	To              *lnbits.User `json:"inline_send_to"`
-	To_SpecificUser bool         `json:"to_specific_user"`
-	Memo            string       `json:"inline_send_memo"`
-	LanguageCode    string       `json:"languagecode"`
+	Message         string         `json:"inline_send_message"`
+	Amount          int            `json:"inline_send_amount"`
+	From            lnbits.UserRef `json:"inline_send_from"`
+	To              lnbits.UserRef `json:"inline_send_to"`
+	To_SpecificUser bool           `json:"to_specific_user"`
+	Memo            string         `json:"inline_send_memo"`
+	LanguageCode    string         `json:"languagecode"`
 }
 
 func (bot TipBot) makeSendKeyboard(ctx context.Context, id string) *tb.ReplyMarkup {
@@ -60,6 +60,11 @@ func (bot TipBot) handleInlineSendQuery(ctx context.Context, q *tb.Query) {
 	}
 	fromUser := LoadUser(ctx)
 	fromUserStr := GetUserStr(&q.From)
+	// the PIN can't be entered in inline queries
+	if bot.PinRequired(fromUser, amount) {
+		bot.inlineQueryReplyWithError(q, TranslateUser(ctx, "inlineQueryPinRequiredMessage"), fmt.Sprintf(TranslateUser(ctx, "inlineQuerySendDescription"), bot.Telegram.Me.Username))
+		return
+	}
 	balance, err := bot.GetUserBalanceCached(fromUser)
 	if err != nil {
 		errmsg := fmt.Sprintf("could not get balance of user %s", fromUserStr)
@@ -77,6 +82,7 @@ func (bot TipBot) handleInlineSendQuery(ctx context.Context, q *tb.Query) {
 	// command is "@LightningTipBot send 123 @to_user This is the memo"
 	memo_argn := 2 // argument index at which the memo starts, will be 3 if there is a to_username in command
 	toUserDb := &lnbits.User{}
+	toUser := lnbits.UserRef{}
 	to_SpecificUser := false
 	if len(strings.Split(q.Text, " ")) > 2 {
 		to_username := strings.Split(q.Text, " ")[2]
@@ -92,6 +98,7 @@ func (bot TipBot) handleInlineSendQuery(ctx context.Context, q *tb.Query) {
 				return
 			}
 			memo_argn = 3 // assume that memo starts after the to_username
+			toUser = toUserDb.Ref()
 			to_SpecificUser = true
 		}
 	}
@@ -131,8 +138,8 @@ func (bot TipBot) handleInlineSendQuery(ctx context.Context, q *tb.Query) {
 		inlineSend := InlineSend{
 			Base:            transaction.New(transaction.ID(id)),
 			Message:         inlineMessage,
-			From:            fromUser,
-			To:              toUserDb,
+			From:            fromUser.Ref(),
+			To:              toUser,
 			To_SpecificUser: to_SpecificUser,
 			Memo:            memo,
 			Amount:          amount,
@@ -164,7 +171,6 @@ func (bot *TipBot) acceptInlineSendHandler(ctx context.Context, c *tb.Callback)
 	}
 	inlineSend := sn.(*InlineSend)
 
-	fromUser := inlineSend.From
 	// immediatelly set intransaction to block duplicate calls
 	err = inlineSend.Lock(inlineSend, bot.Bunt)
 	if err != nil {
@@ -178,17 +184,22 @@ func (bot *TipBot) acceptInlineSendHandler(ctx context.Context, c *tb.Callback)
 
 	defer inlineSend.Release(inlineSend, bot.Bunt)
 
+	fromUser, err := bot.loadUser(inlineSend.From)
+	if err != nil {
+		log.Errorf("[acceptInlineSendHandler] %s", err)
+		return
+	}
 	amount := inlineSend.Amount
 
 	// check if this payment goes to a specific user
 	if inlineSend.To_SpecificUser {
-		if inlineSend.To.Telegram.ID != to.Telegram.ID {
+		if inlineSend.To.TelegramID != to.Telegram.ID {
 			// log.Infof("User %d is not User %d", inlineSend.To.Telegram.ID, to.Telegram.ID)
 			return
 		}
 	} else {
 		// otherwise, we just set it to the user who has clicked
-		inlineSend.To = to
+		inlineSend.To = to.Ref()
 	}
 
 	if fromUser.Telegram.ID == to.Telegram.ID {
@@ -217,7 +228,7 @@ func (bot *TipBot) acceptInlineSendHandler(ctx context.Context, c *tb.Callback)
 
 	// todo: user new get username function to get userStrings
 	transactionMemo := fmt.Sprintf("InlineSend from %s to %s (%d sat).", fromUserStr, toUserStr, amount)
-	t := NewTransaction(bot, fromUser, to, amount, TransactionType("inline send"))
+	t := NewTransaction(bot, fromUser, to, amount, TransactionType("inline send"), TransactionConfirmed())
 	t.Memo = transactionMemo
 	success, err := t.Send()
 	if !success {
@@ -257,7 +268,7 @@ func (bot *TipBot) cancelInlineSendHandler(ctx context.Context, c *tb.Callback)
 		return
 	}
 	inlineSend := sn.(*InlineSend)
-	if c.Sender.ID == inlineSend.From.Telegram.ID {
+	if c.Sender.ID == inlineSend.From.TelegramID {
 		bot.tryEditMessage(c.Message, i18n.Translate(inlineSend.LanguageCode, "sendCancelledMessage"), &tb.ReplyMarkup{})
 		// set the inlineSend inactive
 		inlineSend.Active = false
@@ -4,8 +4,10 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/LightningTipBot/LightningTipBot/internal/errors"
+	"github.com/LightningTipBot/LightningTipBot/internal/events"
 	"github.com/LightningTipBot/LightningTipBot/internal/i18n"
 	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
 	"github.com/LightningTipBot/LightningTipBot/internal/storage/transaction"
@@ -19,20 +21,25 @@ var (
 	inlineTipjarMenu      = &tb.ReplyMarkup{ResizeReplyKeyboard: false}
 	btnCancelInlineTipjar = inlineTipjarMenu.Data("🚫", "cancel_tipjar_inline")
 	btnAcceptInlineTipjar = inlineTipjarMenu.Data("💸 Pay", "confirm_tipjar_inline")
+	btnContributeTipjar   = inlineTipjarMenu.Data("💸", "contribute_tipjar_inline")
 )
 
 type InlineTipjar struct {
 	*transaction.Base
-	Message       string         `json:"inline_tipjar_message"`
-	Amount        int            `json:"inline_tipjar_amount"`
-	GivenAmount   int            `json:"inline_tipjar_givenamount"`
-	PerUserAmount int            `json:"inline_tipjar_peruseramount"`
-	To            *lnbits.User   `json:"inline_tipjar_to"`
-	From          []*lnbits.User `json:"inline_tipjar_from"`
-	Memo          string         `json:"inline_tipjar_memo"`
-	NTotal        int            `json:"inline_tipjar_ntotal"`
-	NGiven        int            `json:"inline_tipjar_ngiven"`
-	LanguageCode  string         `json:"languagecode"`
+	Message       string           `json:"inline_tipjar_message"`
+	Amount        int              `json:"inline_tipjar_amount"`
+	GivenAmount   int              `json:"inline_tipjar_givenamount"`
+	PerUserAmount int              `json:"inline_tipjar_peruseramount"`
+	To            lnbits.UserRef   `json:"inline_tipjar_to"`
+	From          []lnbits.UserRef `json:"inline_tipjar_from"`
+	Memo          string           `json:"inline_tipjar_memo"`
+	NTotal        int              `json:"inline_tipjar_ntotal"`
+	NGiven        int              `json:"inline_tipjar_ngiven"`
+	LanguageCode  string           `json:"languagecode"`
+	// crowdfunding tipjars have a deadline and hold all contributions until the goal is reached
+	Deadline    time.Time        `json:"inline_tipjar_deadline"`
+	FromAmounts []int            `json:"inline_tipjar_fromamounts"`
+	EditMessage tb.StoredMessage `json:"inline_tipjar_editmessage"`
 }
 
 func (bot TipBot) mapTipjarLanguage(ctx context.Context, command string) context.Context {
@@ -52,6 +59,10 @@ func (bot TipBot) createTipjar(ctx context.Context, text string, sender *tb.User
 	if err != nil {
 		return nil, errors.New(errors.DecodePerUserAmountError, err)
 	}
+	// "/tipjar 1000 0" is an amount per user, deadlines have a unit
+	if deadline, err := getDuration(peruserStr); err == nil && hasDurationUnit(peruserStr) {
+		return bot.createGoalTipjar(ctx, text, sender, amount, deadline)
+	}
 	perUserAmount, err := getAmount(peruserStr)
 	if err != nil {
 		return nil, errors.New(errors.InvalidAmountError, err)
@@ -83,7 +94,7 @@ func (bot TipBot) createTipjar(ctx context.Context, text string, sender *tb.User
 		Base:          transaction.New(transaction.ID(id)),
 		Message:       inlineMessage,
 		Amount:        amount,
-		To:            toUser,
+		To:            toUser.Ref(),
 		Memo:          memo,
 		PerUserAmount: perUserAmount,
 		NTotal:        nTotal,
@@ -113,6 +124,10 @@ func (bot TipBot) makeTipjar(ctx context.Context, m *tb.Message, query bool) (*I
 			bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "inlineTipjarHelpText"), Translate(ctx, "inlineTipjarInvalidPeruserAmountMessage")))
 			bot.tryDeleteMessage(m)
 			return nil, err
+		case errors.InvalidDeadlineError:
+			bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "inlineTipjarHelpText"), fmt.Sprintf(Translate(ctx, "inlineTipjarInvalidDeadlineMessage"), int(tipjarMaxDeadline.Hours()/24))))
+			bot.tryDeleteMessage(m)
+			return nil, err
 		case errors.GetBalanceError:
 			// log.Errorln(err.Error())
 			bot.tryDeleteMessage(m)
@@ -143,6 +158,9 @@ func (bot TipBot) makeQueryTipjar(ctx context.Context, q *tb.Query, query bool)
 		case errors.InvalidAmountPerUserError:
 			bot.inlineQueryReplyWithError(q, TranslateUser(ctx, "inlineTipjarInvalidPeruserAmountMessage"), fmt.Sprintf(TranslateUser(ctx, "inlineQueryTipjarDescription"), bot.Telegram.Me.Username))
 			return nil, err
+		case errors.InvalidDeadlineError:
+			bot.inlineQueryReplyWithError(q, fmt.Sprintf(TranslateUser(ctx, "inlineTipjarInvalidDeadlineMessage"), int(tipjarMaxDeadline.Hours()/24)), fmt.Sprintf(TranslateUser(ctx, "inlineQueryTipjarDescription"), bot.Telegram.Me.Username))
+			return nil, err
 		case errors.GetBalanceError:
 			bot.inlineQueryReplyWithError(q, TranslateUser(ctx, "inlineQueryTipjarTitle"), fmt.Sprintf(TranslateUser(ctx, "inlineQueryTipjarDescription"), bot.Telegram.Me.Username))
 			return nil, err
@@ -156,6 +174,9 @@ func (bot TipBot) makeQueryTipjar(ctx context.Context, q *tb.Query, query bool)
 }
 
 func (bot TipBot) makeTipjarKeyboard(ctx context.Context, inlineTipjar *InlineTipjar) *tb.ReplyMarkup {
+	if inlineTipjar.isGoal() {
+		return bot.makeGoalTipjarKeyboard(ctx, inlineTipjar)
+	}
 	// inlineTipjarMenu := &tb.ReplyMarkup{ResizeReplyKeyboard: true}
 	// slice of buttons
 	buttons := make([]tb.Btn, 0)
@@ -182,7 +203,10 @@ func (bot TipBot) tipjarHandler(ctx context.Context, m *tb.Message) {
 		return
 	}
 	toUserStr := GetUserStr(m.Sender)
-	bot.trySendMessage(m.Chat, inlineTipjar.Message, bot.makeTipjarKeyboard(ctx, inlineTipjar))
+	msg := bot.trySendMessage(m.Chat, inlineTipjar.Message, bot.makeTipjarKeyboard(ctx, inlineTipjar))
+	if msg != nil {
+		inlineTipjar.EditMessage = storedMessage(msg)
+	}
 	log.Infof("[tipjar] %s created tipjar %s: %d sat (%d per user)", toUserStr, inlineTipjar.ID, inlineTipjar.Amount, inlineTipjar.PerUserAmount)
 	runtime.IgnoreError(inlineTipjar.Set(inlineTipjar, bot.Bunt))
 }
@@ -212,7 +236,7 @@ func (bot TipBot) handleInlineTipjarQuery(ctx context.Context, q *tb.Query) {
 		results[i].SetResultID(inlineTipjar.ID)
 
 		runtime.IgnoreError(inlineTipjar.Set(inlineTipjar, bot.Bunt))
-		log.Infof("[tipjar] %s created inline tipjar %s: %d sat (%d per user)", GetUserStr(inlineTipjar.To.Telegram), inlineTipjar.ID, inlineTipjar.Amount, inlineTipjar.PerUserAmount)
+		log.Infof("[tipjar] %s created inline tipjar %s: %d sat (%d per user)", GetUserStr(&q.From), inlineTipjar.ID, inlineTipjar.Amount, inlineTipjar.PerUserAmount)
 	}
 
 	err = bot.Telegram.Answer(q, &tb.QueryResponse{
@@ -237,7 +261,6 @@ func (bot *TipBot) acceptInlineTipjarHandler(ctx context.Context, c *tb.Callback
 		return
 	}
 	inlineTipjar := fn.(*InlineTipjar)
-	to := inlineTipjar.To
 	err = inlineTipjar.Lock(inlineTipjar, bot.Bunt)
 	if err != nil {
 		log.Errorf("[tipjar] LockTipjar %s error: %s", inlineTipjar.ID, err)
@@ -250,27 +273,34 @@ func (bot *TipBot) acceptInlineTipjarHandler(ctx context.Context, c *tb.Callback
 	// release tipjar no matter what
 	defer inlineTipjar.Release(inlineTipjar, bot.Bunt)
 
+	to, err := bot.loadUser(inlineTipjar.To)
+	if err != nil {
+		log.Errorf("[tipjar] %s", err)
+		return
+	}
 	if from.Telegram.ID == to.Telegram.ID {
 		bot.trySendMessage(from.Telegram, Translate(ctx, "sendYourselfMessage"))
 		return
 	}
 	// // check if to user has already given to the tipjar
 	for _, a := range inlineTipjar.From {
-		if a.Telegram.ID == to.Telegram.ID {
+		if a.TelegramID == to.Telegram.ID {
 			// to user is already in To slice, has taken from facuet
 			// log.Infof("[tipjar] %s already gave to tipjar %s", GetUserStr(to.Telegram), inlineTipjar.ID)
 			return
 		}
 	}
 	if inlineTipjar.GivenAmount < inlineTipjar.Amount {
-		toUserStrMd := GetUserStrMd(to.Telegram)
-		fromUserStrMd := GetUserStrMd(from.Telegram)
+		// large contributions wait for the PIN
+		if bot.requirePinForCallback(ctx, from, inlineTipjar.PerUserAmount, "tipjar", c) {
+			return
+		}
 		toUserStr := GetUserStr(to.Telegram)
 		fromUserStr := GetUserStr(from.Telegram)
 
 		// todo: user new get username function to get userStrings
 		transactionMemo := fmt.Sprintf("Tipjar from %s to %s (%d sat).", fromUserStr, toUserStr, inlineTipjar.PerUserAmount)
-		t := NewTransaction(bot, from, to, inlineTipjar.PerUserAmount, TransactionType("tipjar"))
+		t := NewTransaction(bot, from, to, inlineTipjar.PerUserAmount, TransactionType("tipjar"), TransactionConfirmed())
 		t.Memo = transactionMemo
 
 		success, err := t.Send()
@@ -281,24 +311,18 @@ func (bot *TipBot) acceptInlineTipjarHandler(ctx context.Context, c *tb.Callback
 			return
 		}
 
-		log.Infof("[tipjar] tipjar %s: %d sat from %s to %s ", inlineTipjar.ID, inlineTipjar.PerUserAmount, fromUserStr, toUserStr)
+		payment := transactionPayment(events.TipjarContribution, t)
+		payment.ReferenceID = inlineTipjar.ID
+		bot.Events.Publish(payment)
 		inlineTipjar.NGiven += 1
-		inlineTipjar.From = append(inlineTipjar.From, from)
+		inlineTipjar.From = append(inlineTipjar.From, from.Ref())
 		inlineTipjar.GivenAmount = inlineTipjar.GivenAmount + inlineTipjar.PerUserAmount
 
-		_, err = bot.Telegram.Send(to.Telegram, fmt.Sprintf(i18n.Translate(to.Telegram.LanguageCode, "inlineTipjarReceivedMessage"), fromUserStrMd, inlineTipjar.PerUserAmount))
-		_, err = bot.Telegram.Send(from.Telegram, fmt.Sprintf(i18n.Translate(from.Telegram.LanguageCode, "inlineTipjarSentMessage"), inlineTipjar.PerUserAmount, toUserStrMd))
-		if err != nil {
-			errmsg := fmt.Errorf("[tipjar] Error: Send message to %s: %s", toUserStr, err)
-			log.Errorln(errmsg)
-			return
-		}
-
 		// build tipjar message
 		inlineTipjar.Message = fmt.Sprintf(
 			i18n.Translate(inlineTipjar.LanguageCode, "inlineTipjarMessage"),
 			inlineTipjar.PerUserAmount,
-			GetUserStr(inlineTipjar.To.Telegram),
+			GetUserStr(to.Telegram),
 			inlineTipjar.GivenAmount,
 			inlineTipjar.Amount,
 			inlineTipjar.NGiven,
@@ -319,7 +343,7 @@ func (bot *TipBot) acceptInlineTipjarHandler(ctx context.Context, c *tb.Callback
 		// tipjar is full
 		inlineTipjar.Message = fmt.Sprintf(
 			i18n.Translate(inlineTipjar.LanguageCode, "inlineTipjarEndedMessage"),
-			GetUserStr(inlineTipjar.To.Telegram),
+			GetUserStr(to.Telegram),
 			inlineTipjar.Amount,
 			inlineTipjar.NGiven,
 		)
@@ -340,7 +364,11 @@ func (bot *TipBot) cancelInlineTipjarHandler(ctx context.Context, c *tb.Callback
 		return
 	}
 	inlineTipjar := fn.(*InlineTipjar)
-	if c.Sender.ID == inlineTipjar.To.Telegram.ID {
+	if inlineTipjar.isGoal() {
+		bot.cancelGoalTipjarHandler(ctx, c, inlineTipjar)
+		return
+	}
+	if c.Sender.ID == inlineTipjar.To.TelegramID {
 		bot.tryEditMessage(c.Message, i18n.Translate(inlineTipjar.LanguageCode, "inlineTipjarCancelledMessage"), &tb.ReplyMarkup{})
 		// set the inlineTipjar inactive
 		inlineTipjar.Active = false
@@ -0,0 +1,284 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/LightningTipBot/LightningTipBot/internal"
+	"github.com/LightningTipBot/LightningTipBot/internal/i18n"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
+	"github.com/LightningTipBot/LightningTipBot/internal/storage/transaction"
+	"github.com/LightningTipBot/LightningTipBot/internal/str"
+	log "github.com/sirupsen/logrus"
+	"github.com/skip2/go-qrcode"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+var (
+	joinRequestMenu    = &tb.ReplyMarkup{ResizeReplyKeyboard: false}
+	btnPayJoinRequest  = joinRequestMenu.Data("💸 Pay", "pay_join_request")
+	joinRequestKeyBase = "join-"
+)
+
+// JoinFee is the admission fee of a group. It is configured by the group owner
+// with /joinfee and paid to their wallet.
+type JoinFee struct {
+	ChatID    int64          `json:"chat_id"`
+	ChatTitle string         `json:"chat_title"`
+	Fee       int            `json:"fee"`
+	Owner     lnbits.UserRef `json:"owner"`
+}
+
+func (fee JoinFee) Key() string {
+	return fmt.Sprintf("join-fee:%d", fee.ChatID)
+}
+
+// JoinRequest is a pending request to join a group with an admission fee.
+// Its ID is derived from the payment hash of the invoice sent to the applicant.
+type JoinRequest struct {
+	*transaction.Base
+	ChatID         int64          `json:"join_chat_id"`
+	ChatTitle      string         `json:"join_chat_title"`
+	User           *tb.User       `json:"join_user"`
+	Fee            int            `json:"join_fee"`
+	Owner          lnbits.UserRef `json:"join_owner"`
+	WalletID       string         `json:"join_wallet_id"`
+	PaymentRequest string         `json:"join_payment_request"`
+}
+
+func joinRequestID(paymentHash string) string {
+	return joinRequestKeyBase + paymentHash
+}
+
+func helpJoinFeeUsage(ctx context.Context, errormsg string) string {
+	return fmt.Sprintf(Translate(ctx, "joinFeeHelpText"), errormsg)
+}
+
+// joinFeeHandler invoked on "/joinfee [<amount>]" in a group. Only the owner of
+// the group can set the fee, an amount of 0 disables it.
+func (bot *TipBot) joinFeeHandler(ctx context.Context, m *tb.Message) {
+	bot.anyTextHandler(ctx, m)
+	if m.Private() {
+		bot.trySendMessage(m.Sender, helpJoinFeeUsage(ctx, Translate(ctx, "joinFeeHelpInGroup")))
+		return
+	}
+	NewMessage(m, WithDuration(0, bot))
+	fee := &JoinFee{ChatID: m.Chat.ID}
+	if _, err := getArgumentFromCommand(m.Text, 1); err != nil {
+		// show the current fee
+		if bot.Bunt.Get(fee) != nil || fee.Fee == 0 {
+			bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "joinFeeDisabledMessage"), str.MarkdownEscape(m.Chat.Title)))
+			return
+		}
+		bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "joinFeeCurrentMessage"), str.MarkdownEscape(m.Chat.Title), fee.Fee))
+		return
+	}
+	amount, err := decodeAmountFromCommand(m.Text)
+	if err != nil || amount < 0 {
+		bot.trySendMessage(m.Sender, helpJoinFeeUsage(ctx, Translate(ctx, "joinFeeInvalidAmountMessage")))
+		return
+	}
+	member, err := bot.Telegram.ChatMemberOf(m.Chat, m.Sender)
+	if err != nil || member.Role != tb.Creator {
+		bot.trySendMessage(m.Sender, helpJoinFeeUsage(ctx, Translate(ctx, "joinFeeNotOwnerMessage")))
+		return
+	}
+	fee.ChatTitle = m.Chat.Title
+	fee.Fee = amount
+	fee.Owner = LoadUser(ctx).Ref()
+	runtime.IgnoreError(bot.Bunt.Set(fee))
+	log.Infof("[joinfee] %s set the join fee of %s (%d) to %d sat", GetUserStr(m.Sender), m.Chat.Title, m.Chat.ID, amount)
+	if amount == 0 {
+		bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "joinFeeDisabledMessage"), str.MarkdownEscape(m.Chat.Title)))
+		return
+	}
+	bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "joinFeeSetMessage"), str.MarkdownEscape(m.Chat.Title), amount))
+}
+
+// joinRequestHandler is called by JoinRequestPoller. Applicants of groups with a join fee receive
+// an invoice of the group owner's wallet. Users with a wallet can also pay with a button.
+func (bot *TipBot) joinRequestHandler(r *ChatJoinRequest) {
+	fee := &JoinFee{ChatID: r.Chat.ID}
+	if bot.Bunt.Get(fee) != nil || fee.Fee == 0 {
+		// no fee, the request is left to the admins
+		return
+	}
+	userStr := GetUserStr(r.From)
+	owner, err := bot.loadUser(fee.Owner)
+	if err != nil {
+		log.Errorf("[joinRequest] Could not load the owner of %s: %s", r.Chat.Title, err)
+		return
+	}
+	invoice, err := owner.Wallet.Invoice(
+		lnbits.InvoiceParams{
+			Out:     false,
+			Amount:  int64(fee.Fee),
+			Memo:    fmt.Sprintf("Join %s (@%s)", r.Chat.Title, bot.Telegram.Me.Username),
+			Webhook: internal.Configuration.Lnbits.WebhookServer},
+		bot.Client)
+	if err != nil {
+		log.Errorf("[joinRequest] Could not create an invoice for %s: %s", userStr, err)
+		return
+	}
+	joinRequest := &JoinRequest{
+		Base:           transaction.New(transaction.ID(joinRequestID(invoice.PaymentHash))),
+		ChatID:         r.Chat.ID,
+		ChatTitle:      r.Chat.Title,
+		User:           r.From,
+		Fee:            fee.Fee,
+		Owner:          fee.Owner,
+		WalletID:       owner.Wallet.ID,
+		PaymentRequest: invoice.PaymentRequest,
+	}
+	runtime.IgnoreError(joinRequest.Set(joinRequest, bot.Bunt))
+	log.Infof("[joinRequest] %s asked to join %s (%d) for %d sat", userStr, r.Chat.Title, r.Chat.ID, fee.Fee)
+
+	languageCode := r.From.LanguageCode
+	bot.trySendMessage(r.From, fmt.Sprintf(i18n.Translate(languageCode, "joinRequestMessage"), str.MarkdownEscape(r.Chat.Title), fee.Fee))
+	qr, err := qrcode.Encode(invoice.PaymentRequest, qrcode.Medium, 256)
+	if err != nil {
+		log.Errorf("[joinRequest] Failed to create QR code for invoice: %s", err)
+		return
+	}
+	if user, exists := bot.UserExists(r.From); exists && user.Wallet != nil {
+		payButton := joinRequestMenu.Data(fmt.Sprintf(i18n.Translate(languageCode, "joinRequestPayButtonMessage"), fee.Fee), "pay_join_request", joinRequest.ID)
+		joinRequestMenu.Inline(joinRequestMenu.Row(payButton))
+		bot.trySendMessage(r.From, &tb.Photo{File: tb.File{FileReader: bytes.NewReader(qr)}, Caption: fmt.Sprintf("`%s`", invoice.PaymentRequest)}, joinRequestMenu)
+		return
+	}
+	bot.trySendMessage(r.From, &tb.Photo{File: tb.File{FileReader: bytes.NewReader(qr)}, Caption: fmt.Sprintf("`%s`", invoice.PaymentRequest)})
+}
+
+// payJoinRequestHandler pays the join fee from the applicant's wallet
+func (bot *TipBot) payJoinRequestHandler(ctx context.Context, c *tb.Callback) {
+	from := LoadUser(ctx)
+	if from.Wallet == nil {
+		return
+	}
+	tx := &JoinRequest{Base: transaction.New(transaction.ID(c.Data))}
+	sn, err := tx.Get(tx, bot.Bunt)
+	if err != nil {
+		log.Errorf("[payJoinRequestHandler] %s", err)
+		return
+	}
+	joinRequest := sn.(*JoinRequest)
+	if joinRequest.User.ID != c.Sender.ID {
+		return
+	}
+	err = joinRequest.Lock(joinRequest, bot.Bunt)
+	if err != nil {
+		log.Errorf("[payJoinRequestHandler] %s", err)
+		return
+	}
+	defer joinRequest.Release(joinRequest, bot.Bunt)
+	if !joinRequest.Active {
+		log.Errorf("[payJoinRequestHandler] join request %s not active anymore", joinRequest.ID)
+		return
+	}
+	// large fees wait for the PIN
+	if bot.requirePinForCallback(ctx, from, joinRequest.Fee, "joinfee", c) {
+		return
+	}
+
+	owner, err := bot.loadUser(joinRequest.Owner)
+	if err != nil {
+		log.Errorf("[payJoinRequestHandler] %s", err)
+		return
+	}
+	t := NewTransaction(bot, from, owner, joinRequest.Fee, TransactionType("join fee"), TransactionConfirmed())
+	t.Memo = fmt.Sprintf("Join fee of %s from %s (%d sat).", joinRequest.ChatTitle, GetUserStr(from.Telegram), joinRequest.Fee)
+	success, err := t.Send()
+	if !success {
+		log.Warnf("[payJoinRequestHandler] Transaction from %s failed: %s", GetUserStr(from.Telegram), err)
+		bot.trySendMessage(c.Sender, fmt.Sprintf(TranslateUser(ctx, "joinRequestPaymentFailedMessage"), joinRequest.Fee))
+		return
+	}
+	// the invoice is not needed anymore
+	bot.tryDeleteMessage(c.Message)
+	bot.admitJoinRequest(joinRequest)
+}
+
+// JoinRequestInvoicePaid is called by the webhook server for every paid invoice. If the invoice
+// belongs to a join request, the applicant is admitted to the group. The webhook is not
+// authenticated, the payment is therefore checked with LNbits first.
+func (bot *TipBot) JoinRequestInvoicePaid(paymentHash string, walletID string) {
+	tx := &JoinRequest{Base: transaction.New(transaction.ID(joinRequestID(paymentHash)))}
+	sn, err := tx.Get(tx, bot.Bunt)
+	if err != nil {
+		// not a join request
+		return
+	}
+	joinRequest := sn.(*JoinRequest)
+	err = joinRequest.Lock(joinRequest, bot.Bunt)
+	if err != nil {
+		log.Errorf("[JoinRequestInvoicePaid] %s", err)
+		return
+	}
+	defer joinRequest.Release(joinRequest, bot.Bunt)
+	if !joinRequest.Active {
+		log.Errorf("[JoinRequestInvoicePaid] join request %s not active anymore", joinRequest.ID)
+		return
+	}
+	if err = bot.verifyJoinRequestPayment(joinRequest, paymentHash, walletID); err != nil {
+		log.Warnf("[JoinRequestInvoicePaid] join request %s: %s", joinRequest.ID, err)
+		return
+	}
+	bot.admitJoinRequest(joinRequest)
+}
+
+// verifyJoinRequestPayment checks that the invoice of a join request was paid to the wallet of the group owner
+func (bot *TipBot) verifyJoinRequestPayment(joinRequest *JoinRequest, paymentHash string, walletID string) error {
+	// requests created before the wallet was stored accept any wallet of the owner
+	if len(joinRequest.WalletID) > 0 && walletID != joinRequest.WalletID {
+		return fmt.Errorf("paid to wallet %s instead of %s", walletID, joinRequest.WalletID)
+	}
+	owner, err := bot.loadUser(joinRequest.Owner)
+	if err != nil {
+		return err
+	}
+	wallet, err := bot.findUserWallet(owner, walletID)
+	if err != nil {
+		return err
+	}
+	status, err := wallet.Payment(paymentHash, bot.Client)
+	if err != nil {
+		return err
+	}
+	if !status.Paid {
+		return fmt.Errorf("invoice %s is not paid", paymentHash)
+	}
+	return nil
+}
+
+// admitJoinRequest approves a paid join request. The request must be locked by the caller.
+func (bot *TipBot) admitJoinRequest(joinRequest *JoinRequest) {
+	joinRequest.Active = false
+	user := joinRequest.User
+	userStr := GetUserStr(user)
+	// the owner is only notified, the applicant is admitted in any case
+	owner, err := bot.loadUser(joinRequest.Owner)
+	if err != nil {
+		log.Warnf("[joinRequest] Could not load the owner of %s: %s", joinRequest.ChatTitle, err)
+	}
+	err = bot.approveChatJoinRequest(joinRequest.ChatID, user.ID)
+	if err != nil {
+		// the request was handled by an admin or has expired in the meantime
+		log.Errorf("[joinRequest] Could not approve %s in %s: %s", userStr, joinRequest.ChatTitle, err)
+		bot.trySendMessage(user, fmt.Sprintf(i18n.Translate(user.LanguageCode, "joinRequestApproveFailedMessage"), str.MarkdownEscape(joinRequest.ChatTitle), GetUserStrMd(owner.Telegram)))
+		return
+	}
+	log.Infof("[joinRequest] %s paid %d sat and joined %s (%d)", userStr, joinRequest.Fee, joinRequest.ChatTitle, joinRequest.ChatID)
+	bot.trySendMessage(user, fmt.Sprintf(i18n.Translate(user.LanguageCode, "joinRequestApprovedMessage"), str.MarkdownEscape(joinRequest.ChatTitle)))
+	bot.trySendMessage(owner.Telegram, fmt.Sprintf(i18n.Translate(owner.Telegram.LanguageCode, "joinRequestPaidMessage"), GetUserStrMd(user), joinRequest.Fee, str.MarkdownEscape(joinRequest.ChatTitle)))
+}
+
+func (bot TipBot) approveChatJoinRequest(chatID int64, userID int) error {
+	_, err := bot.Telegram.Raw("approveChatJoinRequest", map[string]string{
+		"chat_id": strconv.FormatInt(chatID, 10),
+		"user_id": strconv.Itoa(userID),
+	})
+	return err
+}
@@ -0,0 +1,323 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal"
+	"github.com/LightningTipBot/LightningTipBot/internal/i18n"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	decodepay "github.com/fiatjaf/ln-decodepay"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/buntdb"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	spendingLimitsKeyBase = "limits-"
+	spendingDayKeyBase    = "spent-"
+	// spendingDayTTL keeps the spending of a day long enough for every time zone
+	spendingDayTTL = 3 * 24 * time.Hour
+)
+
+// limitNames are the arguments of /limits for the fields of SpendingLimits
+var limitNames = []string{"transaction", "day", "recipient"}
+
+// SpendingLimits are the maximum amounts a user can spend, 0 means unlimited
+type SpendingLimits struct {
+	PerTransaction int `json:"per_transaction"`
+	PerDay         int `json:"per_day"`
+	PerRecipient   int `json:"per_recipient"`
+}
+
+// field returns the limit with the name used by /limits
+func (s *SpendingLimits) field(name string) *int {
+	switch name {
+	case "transaction":
+		return &s.PerTransaction
+	case "day":
+		return &s.PerDay
+	case "recipient":
+		return &s.PerRecipient
+	}
+	return nil
+}
+
+// UserLimits are the spending limits a user set. Raised limits are pending until PendingAt.
+type UserLimits struct {
+	UserID    int             `json:"user_id"`
+	Limits    SpendingLimits  `json:"limits"`
+	Pending   *SpendingLimits `json:"pending,omitempty"`
+	PendingAt time.Time       `json:"pending_at"`
+}
+
+func (l *UserLimits) Key() string {
+	return fmt.Sprintf("%s%d", spendingLimitsKeyBase, l.UserID)
+}
+
+// isLimitRaise checks whether changing a limit from old to new allows to spend more
+func isLimitRaise(old, new int) bool {
+	return old > 0 && (new == 0 || new > old)
+}
+
+// set changes a limit. Lower limits apply immediately, raised limits after the cooling-off time.
+func (l *UserLimits) set(name string, value int, now time.Time, coolingOff time.Duration) (pending bool) {
+	if isLimitRaise(*l.Limits.field(name), value) {
+		if l.Pending == nil {
+			p := l.Limits
+			l.Pending = &p
+		}
+		*l.Pending.field(name) = value
+		l.PendingAt = now.Add(coolingOff)
+		return true
+	}
+	*l.Limits.field(name) = value
+	// a lower limit also replaces a pending raise
+	if l.Pending != nil {
+		*l.Pending.field(name) = value
+		if *l.Pending == l.Limits {
+			l.Pending = nil
+		}
+	}
+	return false
+}
+
+// applyPending applies raised limits whose cooling-off time has passed
+func (l *UserLimits) applyPending(now time.Time) bool {
+	if l.Pending == nil || now.Before(l.PendingAt) {
+		return false
+	}
+	l.Limits = *l.Pending
+	l.Pending = nil
+	return true
+}
+
+// minLimit returns the stricter of two limits
+func minLimit(a, b int) int {
+	if a == 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// effectiveLimits combines the limits of the user with the limits of the operator
+func effectiveLimits(user SpendingLimits) SpendingLimits {
+	operator := internal.Configuration.Bot.Limits
+	return SpendingLimits{
+		PerTransaction: minLimit(user.PerTransaction, operator.PerTransaction),
+		PerDay:         minLimit(user.PerDay, operator.PerDay),
+		PerRecipient:   minLimit(user.PerRecipient, operator.PerRecipient),
+	}
+}
+
+func limitsCoolingOff() time.Duration {
+	return time.Duration(internal.Configuration.Bot.Limits.CoolingOffHours) * time.Hour
+}
+
+// getUserLimits returns the limits a user set
+func (bot *TipBot) getUserLimits(user *lnbits.User) *UserLimits {
+	limits := &UserLimits{UserID: user.Telegram.ID}
+	if err := bot.Bunt.Get(limits); err != nil {
+		return limits
+	}
+	if limits.applyPending(time.Now()) {
+		if err := bot.Bunt.Set(limits); err != nil {
+			log.Errorf("[limits] Could not save limits of %s: %s", GetUserStr(user.Telegram), err)
+		}
+	}
+	return limits
+}
+
+// SpendingDay is what a user spent on one day in their time zone
+type SpendingDay struct {
+	UserID     int            `json:"user_id"`
+	Day        string         `json:"day"`
+	Total      int            `json:"total"`
+	Recipients map[string]int `json:"recipients"`
+}
+
+func (d *SpendingDay) Key() string {
+	return fmt.Sprintf("%s%d-%s", spendingDayKeyBase, d.UserID, d.Day)
+}
+
+// telegramRecipient identifies a Telegram user as the recipient of a payment
+func telegramRecipient(user *tb.User) string {
+	return fmt.Sprintf("tg:%d", user.ID)
+}
+
+func (bot *TipBot) getSpendingDay(user *lnbits.User, now time.Time) *SpendingDay {
+	day := &SpendingDay{UserID: user.Telegram.ID, Day: now.In(userLocation(user)).Format("2006-01-02")}
+	if err := bot.Bunt.Get(day); err != nil || day.Recipients == nil {
+		day.Recipients = make(map[string]int)
+	}
+	return day
+}
+
+// spendingLimitError is the translated rejection of a payment that exceeds a limit
+type spendingLimitError struct {
+	message string
+}
+
+func (e spendingLimitError) Error() string {
+	return e.message
+}
+
+func newSpendingLimitError(user *lnbits.User, key string, args ...interface{}) error {
+	return spendingLimitError{message: fmt.Sprintf(i18n.Translate(user.Telegram.LanguageCode, key), args...)}
+}
+
+// reserve adds a payment to the spending if it fits into the daily limits, otherwise it returns the exceeded limit
+func (d *SpendingDay) reserve(limits SpendingLimits, recipient string, amount int) string {
+	if limits.PerDay > 0 && d.Total+amount > limits.PerDay {
+		return "day"
+	}
+	if limits.PerRecipient > 0 && d.Recipients[recipient]+amount > limits.PerRecipient {
+		return "recipient"
+	}
+	d.Total += amount
+	d.Recipients[recipient] += amount
+	return ""
+}
+
+// updateSpendingDay changes the spending of a day of a user in a single update
+func (bot *TipBot) updateSpendingDay(userID int, day string, update func(d *SpendingDay) error) error {
+	d := &SpendingDay{UserID: userID, Day: day}
+	return bot.Bunt.Update(func(tx *buntdb.Tx) error {
+		if value, err := tx.Get(d.Key()); err == nil {
+			if err = json.Unmarshal([]byte(value), d); err != nil {
+				return err
+			}
+		}
+		if d.Recipients == nil {
+			d.Recipients = make(map[string]int)
+		}
+		if err := update(d); err != nil {
+			return err
+		}
+		b, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		_, _, err = tx.Set(d.Key(), string(b), &buntdb.SetOptions{Expires: true, TTL: spendingDayTTL})
+		return err
+	})
+}
+
+// reserveSpending is called before every payment a user makes. It checks the limits and adds the
+// payment to the spending of the day in one update, so that concurrent payments can't exceed the
+// limits together. It returns the day of the reservation, failed payments are given back with releaseSpending.
+func (bot *TipBot) reserveSpending(user *lnbits.User, recipient string, amount int) (string, error) {
+	limits := effectiveLimits(bot.getUserLimits(user).Limits)
+	if limits.PerTransaction > 0 && amount > limits.PerTransaction {
+		return "", newSpendingLimitError(user, "limitPerTransactionMessage", limits.PerTransaction)
+	}
+	day := time.Now().In(userLocation(user)).Format("2006-01-02")
+	err := bot.updateSpendingDay(user.Telegram.ID, day, func(d *SpendingDay) error {
+		switch d.reserve(limits, recipient, amount) {
+		case "day":
+			return newSpendingLimitError(user, "limitPerDayMessage", limits.PerDay, d.Total)
+		case "recipient":
+			return newSpendingLimitError(user, "limitPerRecipientMessage", limits.PerRecipient, d.Recipients[recipient])
+		}
+		return nil
+	})
+	return day, err
+}
+
+// releaseSpending gives back the reservation of a payment that failed
+func (bot *TipBot) releaseSpending(user *lnbits.User, day string, recipient string, amount int) {
+	err := bot.updateSpendingDay(user.Telegram.ID, day, func(d *SpendingDay) error {
+		d.Total -= amount
+		d.Recipients[recipient] -= amount
+		return nil
+	})
+	if err != nil {
+		log.Errorf("[limits] Could not release spending of %s: %s", GetUserStr(user.Telegram), err)
+	}
+}
+
+// PayInvoice pays a Lightning invoice from the active wallet of the user within the spending limits
+func (bot *TipBot) PayInvoice(user *lnbits.User, paymentRequest string) (lnbits.BitInvoice, error) {
+	bolt11, err := decodepay.Decodepay(paymentRequest)
+	if err != nil {
+		return lnbits.BitInvoice{}, err
+	}
+	amount := int(bolt11.MSatoshi / 1000)
+	recipient := "ln:" + bolt11.Payee
+	day, err := bot.reserveSpending(user, recipient, amount)
+	if err != nil {
+		return lnbits.BitInvoice{}, err
+	}
+	invoice, err := user.Wallet.Pay(lnbits.PaymentParams{Out: true, Bolt11: paymentRequest}, bot.Client)
+	if err != nil {
+		bot.releaseSpending(user, day, recipient, amount)
+		return invoice, err
+	}
+	return invoice, nil
+}
+
+// limitsHandler invoked on "/limits [<transaction|day|recipient> <amount|off>]"
+func (bot *TipBot) limitsHandler(ctx context.Context, m *tb.Message) {
+	bot.anyTextHandler(ctx, m)
+	user := LoadUser(ctx)
+	if user.Wallet == nil {
+		return
+	}
+	if !m.Private() {
+		NewMessage(m, WithDuration(0, bot))
+	}
+	userLimits := bot.getUserLimits(user)
+	name, err := getArgumentFromCommand(m.Text, 1)
+	if err != nil {
+		bot.trySendMessage(m.Sender, bot.makeLimitsMessage(ctx, user, userLimits))
+		return
+	}
+	name = strings.ToLower(name)
+	valueStr, err := getArgumentFromCommand(m.Text, 2)
+	if userLimits.Limits.field(name) == nil || err != nil {
+		bot.trySendMessage(m.Sender, Translate(ctx, "limitsHelpText"))
+		return
+	}
+	value := 0
+	if strings.ToLower(valueStr) != "off" {
+		value, err = getAmount(valueStr)
+		if err != nil || value < 1 {
+			bot.trySendMessage(m.Sender, Translate(ctx, "limitsHelpText"))
+			return
+		}
+	}
+	pending := userLimits.set(name, value, time.Now(), limitsCoolingOff())
+	err = bot.Bunt.Set(userLimits)
+	if err != nil {
+		log.Errorf("[/limits] Could not save limits of %s: %s", GetUserStr(user.Telegram), err)
+		bot.trySendMessage(m.Sender, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	log.Infof("[/limits] %s set the %s limit to %d (pending: %t)", GetUserStr(user.Telegram), name, value, pending)
+	if pending {
+		bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "limitsPendingMessage"), formatUserTime(user, userLimits.PendingAt)))
+	}
+	bot.trySendMessage(m.Sender, bot.makeLimitsMessage(ctx, user, userLimits))
+}
+
+func (bot *TipBot) makeLimitsMessage(ctx context.Context, user *lnbits.User, userLimits *UserLimits) string {
+	formatLimits := func(limits SpendingLimits) []interface{} {
+		formatted := make([]interface{}, len(limitNames))
+		for i, name := range limitNames {
+			formatted[i] = Translate(ctx, "limitsUnlimitedMessage")
+			if limit := *limits.field(name); limit > 0 {
+				formatted[i] = fmt.Sprintf("%d sat", limit)
+			}
+		}
+		return formatted
+	}
+	day := bot.getSpendingDay(user, time.Now())
+	message := fmt.Sprintf(Translate(ctx, "limitsMessage"), append(formatLimits(effectiveLimits(userLimits.Limits)), day.Total)...)
+	if userLimits.Pending != nil {
+		message += fmt.Sprintf(Translate(ctx, "limitsPendingListMessage"), append([]interface{}{formatUserTime(user, userLimits.PendingAt)}, formatLimits(effectiveLimits(*userLimits.Pending))...)...)
+	}
+	return message + fmt.Sprintf(Translate(ctx, "limitsUsageMessage"), internal.Configuration.Bot.Limits.CoolingOffHours)
+}
@@ -0,0 +1,65 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUserLimits_set(t *testing.T) {
+	now := time.Now()
+	coolingOff := 24 * time.Hour
+	l := &UserLimits{}
+	// setting a limit on an unlimited field is never a raise
+	if l.set("day", 1000, now, coolingOff) || l.Limits.PerDay != 1000 {
+		t.Fatalf("set(day, 1000) is pending, limits %+v", l.Limits)
+	}
+	if !l.set("day", 5000, now, coolingOff) || l.Limits.PerDay != 1000 || l.Pending.PerDay != 5000 {
+		t.Fatalf("set(day, 5000) applied immediately, limits %+v", l.Limits)
+	}
+	// lowering another limit applies now and keeps the pending raise
+	l.set("transaction", 100, now, coolingOff)
+	if l.set("transaction", 50, now, coolingOff) || l.Limits.PerTransaction != 50 || l.Pending.PerTransaction != 50 {
+		t.Fatalf("lowering a limit did not apply, limits %+v pending %+v", l.Limits, l.Pending)
+	}
+	// removing a limit is a raise
+	if !l.set("transaction", 0, now, coolingOff) {
+		t.Errorf("set(transaction, off) applied immediately")
+	}
+	if l.applyPending(now.Add(coolingOff - time.Minute)) {
+		t.Errorf("applyPending() before the cooling-off time")
+	}
+	if !l.applyPending(now.Add(coolingOff)) || l.Pending != nil || l.Limits.PerDay != 5000 || l.Limits.PerTransaction != 0 {
+		t.Errorf("applyPending() = %+v, want 5000 per day and no transaction limit", l.Limits)
+	}
+	// lowering a limit back cancels the pending raise
+	l.set("day", 6000, now, coolingOff)
+	l.set("day", 5000, now, coolingOff)
+	if l.Pending != nil {
+		t.Errorf("pending %+v after lowering back", l.Pending)
+	}
+}
+
+func Test_minLimit(t *testing.T) {
+	for _, tt := range []struct{ a, b, want int }{{0, 0, 0}, {0, 10, 10}, {10, 0, 10}, {5, 10, 5}, {10, 5, 5}} {
+		if got := minLimit(tt.a, tt.b); got != tt.want {
+			t.Errorf("minLimit(%d, %d) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSpendingDay_reserve(t *testing.T) {
+	limits := SpendingLimits{PerDay: 1000, PerRecipient: 600}
+	d := &SpendingDay{Recipients: make(map[string]int)}
+	if exceeded := d.reserve(limits, "a", 500); exceeded != "" {
+		t.Fatalf("reserve(a, 500) exceeded %s", exceeded)
+	}
+	if exceeded := d.reserve(limits, "a", 200); exceeded != "recipient" || d.Recipients["a"] != 500 {
+		t.Errorf("reserve(a, 200) = %q, recipient spending %d", exceeded, d.Recipients["a"])
+	}
+	if exceeded := d.reserve(limits, "b", 500); exceeded != "" {
+		t.Fatalf("reserve(b, 500) exceeded %s", exceeded)
+	}
+	if exceeded := d.reserve(limits, "c", 1); exceeded != "day" || d.Total != 1000 {
+		t.Errorf("reserve(c, 1) = %q, total %d", exceeded, d.Total)
+	}
+}
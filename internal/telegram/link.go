@@ -4,15 +4,75 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/LightningTipBot/LightningTipBot/internal"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/str"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/skip2/go-qrcode"
 	tb "gopkg.in/tucnak/telebot.v2"
 )
 
-func (bot TipBot) lndhubHandler(ctx context.Context, m *tb.Message) {
+const (
+	lndhubLinksKeyBase = "lndhub-"
+	// lndhubInvoiceMode links can only create invoices and read the balance
+	lndhubInvoiceMode = "invoice"
+	// lndhubFullMode links can spend the funds of the wallet
+	lndhubFullMode = "full"
+)
+
+// LndhubLink is an issued LNDHub link. The URL is not stored, it contains a wallet key.
+type LndhubLink struct {
+	Mode       string    `json:"mode"`
+	WalletID   string    `json:"wallet_id"`
+	WalletName string    `json:"wallet_name"`
+	IssuedAt   time.Time `json:"issued_at"`
+}
+
+// LndhubLinks are the LNDHub links of a user that were not revoked
+type LndhubLinks struct {
+	UserID int          `json:"user_id"`
+	Links  []LndhubLink `json:"links"`
+}
+
+func (l *LndhubLinks) Key() string {
+	return fmt.Sprintf("%s%d", lndhubLinksKeyBase, l.UserID)
+}
+
+// revoke removes the links of a wallet and returns how many were removed
+func (l *LndhubLinks) revoke(walletID string) int {
+	links := make([]LndhubLink, 0, len(l.Links))
+	for _, link := range l.Links {
+		if link.WalletID != walletID {
+			links = append(links, link)
+		}
+	}
+	revoked := len(l.Links) - len(links)
+	l.Links = links
+	return revoked
+}
+
+func (bot *TipBot) getLndhubLinks(user *lnbits.User) *LndhubLinks {
+	links := &LndhubLinks{UserID: user.Telegram.ID}
+	if err := bot.Bunt.Get(links); err != nil {
+		links.Links = make([]LndhubLink, 0)
+	}
+	return links
+}
+
+// lndhubUrl returns the LNDHub URL of a wallet. Invoice links use the invoice key.
+func lndhubUrl(wallet *lnbits.Wallet, mode string) string {
+	if mode == lndhubInvoiceMode {
+		return fmt.Sprintf("lndhub://invoice:%s@%slndhub/ext/", wallet.Inkey, internal.Configuration.Lnbits.LnbitsPublicUrl)
+	}
+	return fmt.Sprintf("lndhub://admin:%s@%slndhub/ext/", wallet.Adminkey, internal.Configuration.Lnbits.LnbitsPublicUrl)
+}
+
+// lndhubHandler invoked on "/link [invoice|full|revoke]"
+func (bot *TipBot) lndhubHandler(ctx context.Context, m *tb.Message) {
 	if internal.Configuration.Lnbits.LnbitsPublicUrl == "" {
 		bot.trySendMessage(m.Sender, Translate(ctx, "couldNotLinkMessage"))
 		return
@@ -26,18 +86,97 @@ func (bot TipBot) lndhubHandler(ctx context.Context, m *tb.Message) {
 	}
 	// first check whether the user is initialized
 	fromUser := LoadUser(ctx)
-	bot.trySendMessage(m.Sender, Translate(ctx, "walletConnectMessage"))
-
-	lndhubUrl := fmt.Sprintf("lndhub://admin:%s@%slndhub/ext/", fromUser.Wallet.Adminkey, internal.Configuration.Lnbits.LnbitsPublicUrl)
+	if fromUser.Wallet == nil {
+		return
+	}
+	action, err := getArgumentFromCommand(m.Text, 1)
+	if err != nil {
+		bot.trySendMessage(m.Sender, bot.makeLndhubLinksMessage(ctx, fromUser))
+		return
+	}
+	switch strings.ToLower(action) {
+	case lndhubFullMode:
+		// full links can spend everything, they need the PIN
+		if bot.requirePinForCommand(ctx, fromUser, pinAlways, m) {
+			return
+		}
+		bot.issueLndhubLink(ctx, fromUser, lndhubFullMode)
+	case lndhubInvoiceMode:
+		bot.issueLndhubLink(ctx, fromUser, lndhubInvoiceMode)
+	case "revoke":
+		bot.revokeLndhubLinks(ctx, fromUser)
+	default:
+		bot.trySendMessage(m.Sender, Translate(ctx, "linkHelpText"))
+	}
+}
 
+// issueLndhubLink sends an LNDHub link of the active wallet and adds it to the issued links
+func (bot *TipBot) issueLndhubLink(ctx context.Context, user *lnbits.User, mode string) {
+	url := lndhubUrl(user.Wallet, mode)
 	// create qr code
-	qr, err := qrcode.Encode(lndhubUrl, qrcode.Medium, 256)
+	qr, err := qrcode.Encode(url, qrcode.Medium, 256)
 	if err != nil {
-		errmsg := fmt.Sprintf("[/invoice] Failed to create QR code for invoice: %s", err)
+		errmsg := fmt.Sprintf("[/link] Failed to create QR code for link: %s", err)
 		log.Errorln(errmsg)
 		return
 	}
+	links := bot.getLndhubLinks(user)
+	links.Links = append(links.Links, LndhubLink{Mode: mode, WalletID: user.Wallet.ID, WalletName: user.Wallet.Name, IssuedAt: time.Now()})
+	err = bot.Bunt.Set(links)
+	if err != nil {
+		log.Errorf("[/link] Could not save links of %s: %s", GetUserStr(user.Telegram), err)
+	}
+	log.Infof("[/link] %s created a %s link for wallet %s", GetUserStr(user.Telegram), mode, user.Wallet.ID)
+	if mode == lndhubInvoiceMode {
+		bot.trySendMessage(user.Telegram, Translate(ctx, "walletConnectInvoiceMessage"))
+	} else {
+		bot.trySendMessage(user.Telegram, Translate(ctx, "walletConnectMessage"))
+	}
+	// send the link to the user
+	bot.trySendMessage(user.Telegram, &tb.Photo{File: tb.File{FileReader: bytes.NewReader(qr)}, Caption: fmt.Sprintf("`%s`", url)})
+}
+
+// revokeLndhubLinks replaces the keys of the active wallet so that all its links stop working
+func (bot *TipBot) revokeLndhubLinks(ctx context.Context, user *lnbits.User) {
+	wallet, err := bot.Client.ResetWalletKeys(*user.Wallet)
+	if err != nil || len(wallet.Adminkey) == 0 || len(wallet.Inkey) == 0 {
+		log.Errorf("[/link] Could not reset the keys of wallet %s of %s: %v", user.Wallet.ID, GetUserStr(user.Telegram), err)
+		bot.trySendMessage(user.Telegram, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	user.Wallet.Adminkey, user.Wallet.Inkey = wallet.Adminkey, wallet.Inkey
+	if user.DefaultWallet != nil && user.DefaultWallet.ID == user.Wallet.ID {
+		user.DefaultWallet.Adminkey, user.DefaultWallet.Inkey = wallet.Adminkey, wallet.Inkey
+	}
+	err = UpdateUserRecord(user, *bot)
+	if err != nil {
+		// the old keys don't work anymore, the user must not lose the new ones
+		log.Errorf("[/link] Could not save the new keys of wallet %s of %s: %s", user.Wallet.ID, GetUserStr(user.Telegram), err)
+		bot.trySendMessage(user.Telegram, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	links := bot.getLndhubLinks(user)
+	revoked := links.revoke(user.Wallet.ID)
+	err = bot.Bunt.Set(links)
+	if err != nil {
+		log.Errorf("[/link] Could not save links of %s: %s", GetUserStr(user.Telegram), err)
+	}
+	log.Infof("[/link] %s revoked %d links of wallet %s", GetUserStr(user.Telegram), revoked, user.Wallet.ID)
+	bot.trySendMessage(user.Telegram, fmt.Sprintf(Translate(ctx, "linkRevokedMessage"), str.MarkdownEscape(user.Wallet.Name)))
+}
 
-	// send the invoice data to user
-	bot.trySendMessage(m.Sender, &tb.Photo{File: tb.File{FileReader: bytes.NewReader(qr)}, Caption: fmt.Sprintf("`%s`", lndhubUrl)})
+func (bot *TipBot) makeLndhubLinksMessage(ctx context.Context, user *lnbits.User) string {
+	links := bot.getLndhubLinks(user)
+	if len(links.Links) == 0 {
+		return Translate(ctx, "linkNoneMessage") + Translate(ctx, "linkUsageMessage")
+	}
+	lines := make([]string, len(links.Links))
+	for i, link := range links.Links {
+		mode := Translate(ctx, "linkFullMode")
+		if link.Mode == lndhubInvoiceMode {
+			mode = Translate(ctx, "linkInvoiceMode")
+		}
+		lines[i] = fmt.Sprintf(Translate(ctx, "linkEntryMessage"), mode, str.MarkdownEscape(link.WalletName), formatUserTime(user, link.IssuedAt))
+	}
+	return fmt.Sprintf(Translate(ctx, "linksMessage"), strings.Join(lines, "\n")) + Translate(ctx, "linkUsageMessage")
 }
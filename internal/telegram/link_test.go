@@ -0,0 +1,29 @@
+package telegram
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+)
+
+func TestLndhubUrl(t *testing.T) {
+	wallet := &lnbits.Wallet{Adminkey: "adminkey", Inkey: "inkey"}
+	if url := lndhubUrl(wallet, lndhubInvoiceMode); !strings.HasPrefix(url, "lndhub://invoice:inkey@") {
+		t.Errorf("lndhubUrl(invoice) = %s", url)
+	}
+	if url := lndhubUrl(wallet, lndhubFullMode); !strings.HasPrefix(url, "lndhub://admin:adminkey@") {
+		t.Errorf("lndhubUrl(full) = %s", url)
+	}
+}
+
+func TestLndhubLinks_revoke(t *testing.T) {
+	links := &LndhubLinks{Links: []LndhubLink{
+		{Mode: lndhubFullMode, WalletID: "a"},
+		{Mode: lndhubInvoiceMode, WalletID: "b"},
+		{Mode: lndhubInvoiceMode, WalletID: "a"},
+	}}
+	if revoked := links.revoke("a"); revoked != 2 || len(links.Links) != 1 || links.Links[0].WalletID != "b" {
+		t.Errorf("revoke(a) = %d, links %+v", revoked, links.Links)
+	}
+}
@@ -20,7 +20,7 @@ import (
 // LnurlPayState saves the state of the user for an LNURL payment
 type LnurlPayState struct {
 	*transaction.Base
-	From              *lnbits.User            `json:"from"`
+	From              lnbits.UserRef          `json:"from"`
 	LNURLPayResponse1 lnurl.LNURLPayResponse1 `json:"LNURLPayResponse1"`
 	LNURLPayResponse2 lnurl.LNURLPayResponse2 `json:"LNURLPayResponse2"`
 	Amount            int                     `json:"amount"`
@@ -4,9 +4,14 @@ import (
 	"strconv"
 	"time"
 
+	"github.com/LightningTipBot/LightningTipBot/internal/scheduler"
+	log "github.com/sirupsen/logrus"
 	tb "gopkg.in/tucnak/telebot.v2"
 )
 
+// deleteMessageJob deletes a message from a group chat, see Message.dispose
+const deleteMessageJob = "delete-message"
+
 type Message struct {
 	Message  *tb.Message `json:"message"`
 	duration time.Duration
@@ -17,7 +22,7 @@ type MessageOption func(m *Message)
 func WithDuration(duration time.Duration, tipBot *TipBot) MessageOption {
 	return func(m *Message) {
 		m.duration = duration
-		go m.dispose(tipBot)
+		m.dispose(tipBot)
 	}
 }
 
@@ -35,13 +40,37 @@ func (msg Message) Key() string {
 	return strconv.Itoa(msg.Message.ID)
 }
 
+// dispose schedules the deletion of the message, so that it is deleted even after a restart
 func (msg Message) dispose(tipBot *TipBot) {
 	// do not delete messages from private chat
 	if msg.Message.Private() {
 		return
 	}
-	go func() {
-		time.Sleep(msg.duration)
-		tipBot.tryDeleteMessage(msg.Message)
-	}()
+	_, err := tipBot.Scheduler.Schedule(deleteMessageJob, time.Now().Add(msg.duration), storedMessage(msg.Message))
+	if err != nil {
+		log.Errorf("[dispose] Could not schedule deletion of message %d: %s", msg.Message.ID, err)
+	}
+}
+
+// deleteMessageJobHandler handles the jobs scheduled by Message.dispose
+func (bot TipBot) deleteMessageJobHandler(job *scheduler.Job) error {
+	msg := tb.StoredMessage{}
+	if err := job.Decode(&msg); err != nil {
+		log.Errorf("[deleteMessageJobHandler] %s", err)
+		// retrying doesn't help
+		return nil
+	}
+	err := bot.Telegram.Delete(msg)
+	if err == tb.ErrToDeleteNotFound || err == tb.ErrNoRightsToDelete {
+		// already deleted or too old, nothing left to do
+		log.Debugf("[deleteMessageJobHandler] %s", err)
+		return nil
+	}
+	return err
+}
+
+// storedMessage returns a reference to m that can be edited later, also for inline messages
+func storedMessage(m *tb.Message) tb.StoredMessage {
+	messageID, chatID := m.MessageSig()
+	return tb.StoredMessage{MessageID: messageID, ChatID: chatID}
 }
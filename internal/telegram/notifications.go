@@ -0,0 +1,296 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/events"
+	"github.com/LightningTipBot/LightningTipBot/internal/i18n"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
+	"github.com/LightningTipBot/LightningTipBot/internal/scheduler"
+	"github.com/LightningTipBot/LightningTipBot/internal/str"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/buntdb"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	notificationSettingsKeyBase = "notifications-"
+	sendDigestsJob              = "send-digests"
+	sendDigestsInterval         = time.Hour
+	// digestHour is the hour in the time zone of the user after which digests are sent
+	digestHour     = 8
+	digestTopCount = 3
+	// digestMemoCount is the number of the latest memos in a digest
+	digestMemoCount = 10
+)
+
+// notification modes of a kind of payment
+const (
+	notifyInstant = "instant"
+	notifySilent  = "silent"
+	notifyDigest  = "digest"
+	notifyOff     = "off"
+)
+
+// digest frequencies, digests are turned off with notifyOff
+const (
+	digestDaily  = "daily"
+	digestWeekly = "weekly"
+)
+
+var (
+	notificationKinds = []events.Kind{events.Tip, events.FaucetClaim, events.TipjarContribution, events.Deposit}
+	notificationModes = []string{notifyInstant, notifySilent, notifyDigest, notifyOff}
+)
+
+// NotificationSettings are the notification modes of a user per kind of payment and the frequency of the digest
+type NotificationSettings struct {
+	UserID     int                    `json:"user_id"`
+	Modes      map[events.Kind]string `json:"modes"`
+	Digest     string                 `json:"digest"`
+	LastDigest time.Time              `json:"last_digest"`
+}
+
+func (s *NotificationSettings) Key() string {
+	return fmt.Sprintf("%s%d", notificationSettingsKeyBase, s.UserID)
+}
+
+// mode returns how the user is notified about a kind of payment, instantly if nothing is set
+func (s *NotificationSettings) mode(kind events.Kind) string {
+	if mode, ok := s.Modes[kind]; ok {
+		return mode
+	}
+	return notifyInstant
+}
+
+func (s *NotificationSettings) digestEnabled() bool {
+	return s.Digest == digestDaily || s.Digest == digestWeekly
+}
+
+// digestDue checks whether the digest of the user is due at now
+func (s *NotificationSettings) digestDue(loc *time.Location, now time.Time) bool {
+	local := now.In(loc)
+	if !s.digestEnabled() || local.Hour() < digestHour || (s.Digest == digestWeekly && local.Weekday() != time.Monday) {
+		return false
+	}
+	last := s.LastDigest.In(loc)
+	return s.LastDigest.IsZero() || last.Year() != local.Year() || last.YearDay() != local.YearDay()
+}
+
+// getNotificationSettings returns the settings of a user, the defaults if there are none
+func (bot *TipBot) getNotificationSettings(userID int) *NotificationSettings {
+	settings := &NotificationSettings{UserID: userID}
+	if bot.Bunt.Get(settings) != nil || settings.Modes == nil {
+		settings.Modes = make(map[events.Kind]string)
+	}
+	return settings
+}
+
+// notifyUser sends a notification about a kind of payment in the mode the user has chosen
+func (bot *TipBot) notifyUser(user *lnbits.User, kind events.Kind, what string) {
+	switch bot.getNotificationSettings(user.Telegram.ID).mode(kind) {
+	case notifyOff, notifyDigest:
+		return
+	case notifySilent:
+		bot.trySendMessage(user.Telegram, what, tb.Silent)
+	default:
+		bot.trySendMessage(user.Telegram, what)
+	}
+}
+
+// getDigestStatistics sums up the statistics of the given number of days before today
+func (bot *TipBot) getDigestStatistics(user *lnbits.User, now time.Time, days int) *PaymentStatistics {
+	local := now.In(userLocation(user))
+	total := &PaymentStatistics{UserID: user.Telegram.ID, Counterparties: make(map[string]int)}
+	for i := 1; i <= days; i++ {
+		day := time.Date(local.Year(), local.Month(), local.Day()-i, 12, 0, 0, 0, local.Location())
+		stats := &PaymentStatistics{UserID: user.Telegram.ID, Day: day.Format(statisticsDayFormat)}
+		if bot.Bunt.Get(stats) != nil {
+			continue
+		}
+		total.Received += stats.Received
+		total.ReceivedCount += stats.ReceivedCount
+		total.Sent += stats.Sent
+		total.SentCount += stats.SentCount
+		for counterparty, amount := range stats.Counterparties {
+			total.Counterparties[counterparty] += amount
+		}
+		// the older days come first
+		total.Memos = append(stats.Memos, total.Memos...)
+	}
+	return total
+}
+
+// topCounterparties returns the counterparties with the largest volume first
+func topCounterparties(stats *PaymentStatistics, n int) []string {
+	counterparties := make([]string, 0, len(stats.Counterparties))
+	for counterparty := range stats.Counterparties {
+		counterparties = append(counterparties, counterparty)
+	}
+	sort.Slice(counterparties, func(i, j int) bool {
+		a, b := counterparties[i], counterparties[j]
+		if stats.Counterparties[a] != stats.Counterparties[b] {
+			return stats.Counterparties[a] > stats.Counterparties[b]
+		}
+		return a < b
+	})
+	if len(counterparties) > n {
+		counterparties = counterparties[:n]
+	}
+	return counterparties
+}
+
+// makeDigestMessage summarises the statistics, there is no digest without payments
+func makeDigestMessage(languageCode string, settings *NotificationSettings, stats *PaymentStatistics) string {
+	if stats.ReceivedCount == 0 && stats.SentCount == 0 {
+		return ""
+	}
+	title := i18n.Translate(languageCode, "digestDailyTitle")
+	if settings.Digest == digestWeekly {
+		title = i18n.Translate(languageCode, "digestWeeklyTitle")
+	}
+	message := fmt.Sprintf(i18n.Translate(languageCode, "digestMessage"), title, stats.Received, stats.ReceivedCount, stats.Sent, stats.SentCount)
+	top := topCounterparties(stats, digestTopCount)
+	for i, counterparty := range top {
+		if i == 0 {
+			message += i18n.Translate(languageCode, "digestTopMessage")
+		}
+		message += fmt.Sprintf("\n%d. %s: %d sat", i+1, str.MarkdownEscape(counterparty), stats.Counterparties[counterparty])
+	}
+	memos := stats.Memos
+	if len(memos) > digestMemoCount {
+		memos = memos[len(memos)-digestMemoCount:]
+	}
+	for i, memo := range memos {
+		if i == 0 {
+			message += i18n.Translate(languageCode, "digestMemosMessage")
+		}
+		message += fmt.Sprintf("\n✉️ %s: %s", str.MarkdownEscape(memo.From), str.MarkdownEscape(memo.Memo))
+	}
+	return message
+}
+
+// sendDigestsJobHandler sends the digests that are due
+func (bot *TipBot) sendDigestsJobHandler(job *scheduler.Job) error {
+	now := time.Now()
+	var subscribers []*NotificationSettings
+	runtime.IgnoreError(bot.Bunt.View(func(tx *buntdb.Tx) error {
+		return tx.AscendKeys(notificationSettingsKeyBase+"*", func(key, value string) bool {
+			settings := &NotificationSettings{}
+			if json.Unmarshal([]byte(value), settings) == nil && settings.digestEnabled() {
+				subscribers = append(subscribers, settings)
+			}
+			return true
+		})
+	}))
+	for _, settings := range subscribers {
+		user, err := GetLnbitsUser(&tb.User{ID: settings.UserID}, *bot)
+		if err != nil || user.Wallet == nil || !settings.digestDue(userLocation(user), now) {
+			continue
+		}
+		days := 1
+		if settings.Digest == digestWeekly {
+			days = 7
+		}
+		if message := makeDigestMessage(user.Telegram.LanguageCode, settings, bot.getDigestStatistics(user, now, days)); len(message) > 0 {
+			bot.trySendMessage(user.Telegram, message, tb.Silent)
+		}
+		settings.LastDigest = now
+		if err = bot.Bunt.Set(settings); err != nil {
+			log.Errorf("[sendDigestsJobHandler] Could not save settings of %s: %s", GetUserStr(user.Telegram), err)
+		}
+	}
+	return nil
+}
+
+// notificationsHandler invoked on "/notifications [<kind>|all <mode>]" and "/notifications digest <daily|weekly|off>"
+func (bot *TipBot) notificationsHandler(ctx context.Context, m *tb.Message) {
+	bot.anyTextHandler(ctx, m)
+	user := LoadUser(ctx)
+	if user.Wallet == nil {
+		return
+	}
+	if !m.Private() {
+		NewMessage(m, WithDuration(0, bot))
+	}
+	settings := bot.getNotificationSettings(user.Telegram.ID)
+	target, err := getArgumentFromCommand(m.Text, 1)
+	if err != nil {
+		bot.trySendMessage(m.Sender, makeNotificationSettingsMessage(ctx, settings))
+		return
+	}
+	value, err := getArgumentFromCommand(m.Text, 2)
+	if err != nil {
+		bot.trySendMessage(m.Sender, Translate(ctx, "notificationsHelpText"))
+		return
+	}
+	target, value = strings.ToLower(target), strings.ToLower(value)
+	if !settings.apply(target, value) {
+		bot.trySendMessage(m.Sender, Translate(ctx, "notificationsHelpText"))
+		return
+	}
+	err = bot.Bunt.Set(settings)
+	if err != nil {
+		log.Errorf("[/notifications] Could not save settings of %s: %s", GetUserStr(user.Telegram), err)
+		bot.trySendMessage(m.Sender, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	log.Infof("[/notifications] %s set %s to %s", GetUserStr(user.Telegram), target, value)
+	bot.trySendMessage(m.Sender, makeNotificationSettingsMessage(ctx, settings))
+}
+
+// apply sets the mode of a kind of payment, of all kinds or the frequency of the digest
+func (s *NotificationSettings) apply(target, value string) bool {
+	if target == "digest" {
+		if value != digestDaily && value != digestWeekly && value != notifyOff {
+			return false
+		}
+		if value == notifyOff {
+			// payments in digest mode would be lost without a digest
+			for kind, mode := range s.Modes {
+				if mode == notifyDigest {
+					s.Modes[kind] = notifyInstant
+				}
+			}
+		}
+		s.Digest = value
+		return true
+	}
+	validMode := false
+	for _, mode := range notificationModes {
+		validMode = validMode || mode == value
+	}
+	if !validMode {
+		return false
+	}
+	found := false
+	for _, kind := range notificationKinds {
+		if target == "all" || target == string(kind) {
+			s.Modes[kind] = value
+			found = true
+		}
+	}
+	// payments in digest mode would be lost without a digest
+	if found && value == notifyDigest && !s.digestEnabled() {
+		s.Digest = digestDaily
+	}
+	return found
+}
+
+func makeNotificationSettingsMessage(ctx context.Context, settings *NotificationSettings) string {
+	lines := make([]string, len(notificationKinds))
+	for i, kind := range notificationKinds {
+		lines[i] = fmt.Sprintf(Translate(ctx, "notificationsEntryMessage"), kind, settings.mode(kind))
+	}
+	digest := settings.Digest
+	if !settings.digestEnabled() {
+		digest = notifyOff
+	}
+	return fmt.Sprintf(Translate(ctx, "notificationsMessage"), strings.Join(lines, "\n"), digest) + Translate(ctx, "notificationsUsageMessage")
+}
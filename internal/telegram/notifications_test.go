@@ -0,0 +1,56 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/events"
+)
+
+func TestNotificationSettings_apply(t *testing.T) {
+	settings := &NotificationSettings{Modes: make(map[events.Kind]string)}
+	if settings.apply("tip", "loud") || settings.apply("donation", notifyOff) || settings.apply("digest", "hourly") {
+		t.Fatalf("apply() accepted an invalid setting")
+	}
+	if !settings.apply("all", notifySilent) || !settings.apply("faucet", notifyDigest) {
+		t.Fatalf("apply() rejected a valid setting")
+	}
+	if settings.mode(events.Tip) != notifySilent || settings.mode(events.FaucetClaim) != notifyDigest || settings.mode(events.Pay) != notifyInstant {
+		t.Errorf("modes = %v", settings.Modes)
+	}
+	// payments in digest mode turn on the digest
+	if settings.Digest != digestDaily {
+		t.Errorf("digest = %q", settings.Digest)
+	}
+	// turning off the digest notifies instantly about payments in digest mode
+	if !settings.apply("digest", notifyOff) || settings.digestEnabled() {
+		t.Fatalf("apply() did not turn off the digest")
+	}
+	if settings.mode(events.FaucetClaim) != notifyInstant || settings.mode(events.Tip) != notifySilent {
+		t.Errorf("modes = %v", settings.Modes)
+	}
+}
+
+func TestNotificationSettings_digestDue(t *testing.T) {
+	monday := time.Date(2021, 11, 15, 9, 0, 0, 0, time.UTC)
+	settings := &NotificationSettings{Digest: digestWeekly}
+	if !settings.digestDue(time.UTC, monday) || settings.digestDue(time.UTC, monday.Add(-2*time.Hour)) || settings.digestDue(time.UTC, monday.AddDate(0, 0, 1)) {
+		t.Errorf("weekly digest is due on mondays after %d:00", digestHour)
+	}
+	settings.LastDigest = monday
+	if settings.digestDue(time.UTC, monday.Add(time.Hour)) || !settings.digestDue(time.UTC, monday.AddDate(0, 0, 7)) {
+		t.Errorf("weekly digest is due once a week")
+	}
+	settings.Digest = notifyOff
+	if settings.digestDue(time.UTC, monday.AddDate(0, 0, 7)) {
+		t.Errorf("digest is due although it is off")
+	}
+}
+
+func TestTopCounterparties(t *testing.T) {
+	stats := &PaymentStatistics{Counterparties: map[string]int{"@a": 10, "@b": 500, "@c": 21, "@d": 21}}
+	top := topCounterparties(stats, 3)
+	if len(top) != 3 || top[0] != "@b" || top[1] != "@c" || top[2] != "@d" {
+		t.Errorf("topCounterparties() = %v", top)
+	}
+}
@@ -0,0 +1,594 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal"
+	"github.com/LightningTipBot/LightningTipBot/internal/i18n"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/nostr"
+	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
+	"github.com/LightningTipBot/LightningTipBot/internal/str"
+	decodepay "github.com/fiatjaf/ln-decodepay"
+	log "github.com/sirupsen/logrus"
+	"github.com/skip2/go-qrcode"
+	"github.com/tidwall/buntdb"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	nwcConnectionKeyBase = "nwc-conn-"
+	nwcRequestKeyBase    = "nwc-req-"
+	nwcServiceKey        = "nwc-service-key"
+	// event kinds of NIP-47
+	nwcInfoKind     = 13194
+	nwcRequestKind  = 23194
+	nwcResponseKind = 23195
+	// nwcRequestTTL keeps handled requests long enough that a relay can't replay them
+	nwcRequestTTL     = 24 * time.Hour
+	nwcPublishTimeout = 10 * time.Second
+	nwcReconnectDelay = 30 * time.Second
+	nwcMaxConnections = 10
+)
+
+// nwcMethods are the NIP-47 methods a connection can be allowed to use
+var nwcMethods = []string{"pay_invoice", "get_balance", "make_invoice", "lookup_invoice"}
+
+// NWCConnection is a Nostr Wallet Connect connection of a user. Only the public key of the app is stored.
+type NWCConnection struct {
+	PubKey  string   `json:"pubkey"`
+	UserID  int      `json:"user_id"`
+	Name    string   `json:"name"`
+	Methods []string `json:"methods"`
+	// Budget is the amount the app can pay per day, Spent is what it paid on Day
+	Budget    int       `json:"budget"`
+	Spent     int       `json:"spent"`
+	Day       string    `json:"day"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (c *NWCConnection) Key() string {
+	return nwcConnectionKeyBase + c.PubKey
+}
+
+func (c *NWCConnection) allows(method string) bool {
+	for _, m := range c.Methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// reserve adds a payment to the spending of the day if it fits into the budget
+func (c *NWCConnection) reserve(amount int, day string) bool {
+	if c.Day != day {
+		c.Day = day
+		c.Spent = 0
+	}
+	if c.Spent+amount > c.Budget {
+		return false
+	}
+	c.Spent += amount
+	return true
+}
+
+// nwcError is the error of a NIP-47 response
+type nwcError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func newNWCError(code, message string) *nwcError {
+	return &nwcError{Code: code, Message: message}
+}
+
+type nwcRequest struct {
+	Method string          `json:"method"`
+	Params json.RawMessage `json:"params"`
+}
+
+type nwcResponse struct {
+	ResultType string      `json:"result_type"`
+	Error      *nwcError   `json:"error,omitempty"`
+	Result     interface{} `json:"result,omitempty"`
+}
+
+// nwcTransaction is an invoice or a payment in a NIP-47 result, amounts are in msat
+type nwcTransaction struct {
+	Type        string `json:"type"`
+	Invoice     string `json:"invoice,omitempty"`
+	Description string `json:"description,omitempty"`
+	Preimage    string `json:"preimage,omitempty"`
+	PaymentHash string `json:"payment_hash"`
+	Amount      int64  `json:"amount"`
+	FeesPaid    int64  `json:"fees_paid"`
+	CreatedAt   int64  `json:"created_at"`
+	SettledAt   int64  `json:"settled_at,omitempty"`
+}
+
+// nwcURI returns the connection URI an app needs to connect to the wallet service
+func nwcURI(servicePubKey, relay, secret string) string {
+	return fmt.Sprintf("nostr+walletconnect://%s?relay=%s&secret=%s", servicePubKey, url.QueryEscape(relay), secret)
+}
+
+// getNWCPrivateKey returns the key of the wallet service from the configuration or from BuntDB
+func (bot *TipBot) getNWCPrivateKey() (string, error) {
+	if sk := internal.Configuration.Bot.NWC.PrivateKey; len(sk) > 0 {
+		return sk, nil
+	}
+	var sk string
+	err := bot.Bunt.Update(func(tx *buntdb.Tx) error {
+		var err error
+		sk, err = tx.Get(nwcServiceKey)
+		if err == nil {
+			return nil
+		}
+		sk, err = nostr.GeneratePrivateKey()
+		if err != nil {
+			return err
+		}
+		log.Infof("[nwc] Generated a new wallet service key")
+		_, _, err = tx.Set(nwcServiceKey, sk, nil)
+		return err
+	})
+	return sk, err
+}
+
+func (bot *TipBot) getNWCConnection(pubKey string) *NWCConnection {
+	connection := &NWCConnection{PubKey: pubKey}
+	if err := bot.Bunt.Get(connection); err != nil {
+		return nil
+	}
+	return connection
+}
+
+// getNWCConnections returns the connections of a user in the order they were created
+func (bot *TipBot) getNWCConnections(user *lnbits.User) []*NWCConnection {
+	connections := make([]*NWCConnection, 0)
+	runtime.IgnoreError(bot.Bunt.View(func(tx *buntdb.Tx) error {
+		return tx.AscendKeys(nwcConnectionKeyBase+"*", func(key, value string) bool {
+			connection := &NWCConnection{}
+			if json.Unmarshal([]byte(value), connection) == nil && connection.UserID == user.Telegram.ID {
+				connections = append(connections, connection)
+			}
+			return true
+		})
+	}))
+	sort.SliceStable(connections, func(i, j int) bool {
+		return connections[i].CreatedAt.Before(connections[j].CreatedAt)
+	})
+	return connections
+}
+
+// claimNWCRequest returns false if the request was already handled
+func (bot *TipBot) claimNWCRequest(id string) bool {
+	claimed := false
+	runtime.IgnoreError(bot.Bunt.Update(func(tx *buntdb.Tx) error {
+		if _, err := tx.Get(nwcRequestKeyBase + id); err == nil {
+			return nil
+		}
+		claimed = true
+		_, _, err := tx.Set(nwcRequestKeyBase+id, "1", &buntdb.SetOptions{Expires: true, TTL: nwcRequestTTL})
+		return err
+	}))
+	return claimed
+}
+
+// runNWC serves Nostr Wallet Connect requests and reconnects to the relay when the connection is lost
+func (bot *TipBot) runNWC() {
+	relayUrl := internal.Configuration.Bot.NWC.Relay
+	if len(relayUrl) == 0 {
+		return
+	}
+	sk, err := bot.getNWCPrivateKey()
+	if err != nil {
+		log.Errorf("[nwc] Could not load the wallet service key: %s", err)
+		return
+	}
+	for {
+		relay, err := nostr.ConnectRelay(relayUrl)
+		if err == nil {
+			log.Infof("[nwc] Connected to %s", relayUrl)
+			err = bot.serveNWC(context.Background(), relay, sk)
+			runtime.IgnoreError(relay.Close())
+		}
+		log.Warnf("[nwc] Relay %s disconnected: %v", relayUrl, err)
+		time.Sleep(nwcReconnectDelay)
+	}
+}
+
+// serveNWC answers the requests to the wallet service until the subscription ends
+func (bot *TipBot) serveNWC(ctx context.Context, relay nostr.Relay, sk string) error {
+	pk, err := nostr.GetPublicKey(sk)
+	if err != nil {
+		return err
+	}
+	info := nostr.NewEvent(nwcInfoKind, strings.Join(nwcMethods, " "))
+	if err = info.Sign(sk); err != nil {
+		return err
+	}
+	bot.publishNWC(ctx, relay, info)
+	events, err := relay.Subscribe(ctx, nostr.Filter{
+		Kinds: []int{nwcRequestKind},
+		Tags:  map[string][]string{"p": {pk}},
+		Since: time.Now().Add(-time.Minute).Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	// requests are handled one after another so that budgets can't be overspent
+	for event := range events {
+		if response := bot.handleNWCRequest(sk, event); response != nil {
+			bot.publishNWC(ctx, relay, response)
+		}
+	}
+	return fmt.Errorf("subscription closed")
+}
+
+func (bot *TipBot) publishNWC(ctx context.Context, relay nostr.Relay, event *nostr.Event) {
+	ctx, cancel := context.WithTimeout(ctx, nwcPublishTimeout)
+	defer cancel()
+	if err := relay.Publish(ctx, event); err != nil {
+		log.Warnf("[nwc] Could not publish event of kind %d: %s", event.Kind, err)
+	}
+}
+
+// handleNWCRequest executes a request and returns the response event or nil if there is nothing to answer
+func (bot *TipBot) handleNWCRequest(sk string, event *nostr.Event) *nostr.Event {
+	if event.Kind != nwcRequestKind || event.Verify() != nil {
+		return nil
+	}
+	for _, expiration := range event.TagValues("expiration") {
+		if expiresAt, err := strconv.ParseInt(expiration, 10, 64); err == nil && expiresAt < time.Now().Unix() {
+			return nil
+		}
+	}
+	// relays can deliver an event more than once
+	if !bot.claimNWCRequest(event.ID) {
+		return nil
+	}
+	response := bot.executeNWCRequest(sk, event)
+	content, err := json.Marshal(response)
+	if err != nil {
+		return nil
+	}
+	encrypted, err := nostr.Encrypt(sk, event.PubKey, string(content))
+	if err != nil {
+		return nil
+	}
+	reply := nostr.NewEvent(nwcResponseKind, encrypted, []string{"p", event.PubKey}, []string{"e", event.ID})
+	if reply.Sign(sk) != nil {
+		return nil
+	}
+	return reply
+}
+
+func (bot *TipBot) executeNWCRequest(sk string, event *nostr.Event) nwcResponse {
+	connection := bot.getNWCConnection(event.PubKey)
+	if connection == nil {
+		return nwcResponse{Error: newNWCError("UNAUTHORIZED", "no wallet is connected to this key")}
+	}
+	plaintext, err := nostr.Decrypt(sk, event.PubKey, event.Content)
+	var request nwcRequest
+	if err != nil || json.Unmarshal([]byte(plaintext), &request) != nil {
+		return nwcResponse{Error: newNWCError("OTHER", "invalid request")}
+	}
+	response := nwcResponse{ResultType: request.Method}
+	known := false
+	for _, method := range nwcMethods {
+		known = known || method == request.Method
+	}
+	if !known {
+		response.Error = newNWCError("NOT_IMPLEMENTED", fmt.Sprintf("%s is not supported", request.Method))
+		return response
+	}
+	if !connection.allows(request.Method) {
+		response.Error = newNWCError("RESTRICTED", fmt.Sprintf("%s is not allowed for this connection", request.Method))
+		return response
+	}
+	user, err := GetLnbitsUser(&tb.User{ID: connection.UserID}, *bot)
+	if err != nil || user.Wallet == nil {
+		response.Error = newNWCError("UNAUTHORIZED", "the wallet does not exist")
+		return response
+	}
+	log.Infof("[nwc] %s called %s via %s", GetUserStr(user.Telegram), request.Method, connection.Name)
+	switch request.Method {
+	case "pay_invoice":
+		response.Result, response.Error = bot.nwcPayInvoice(user, connection, request.Params)
+	case "get_balance":
+		response.Result, response.Error = bot.nwcGetBalance(user)
+	case "make_invoice":
+		response.Result, response.Error = bot.nwcMakeInvoice(user, request.Params)
+	case "lookup_invoice":
+		response.Result, response.Error = bot.nwcLookupInvoice(user, request.Params)
+	}
+	return response
+}
+
+func (bot *TipBot) nwcPayInvoice(user *lnbits.User, connection *NWCConnection, params json.RawMessage) (interface{}, *nwcError) {
+	var p struct {
+		Invoice string `json:"invoice"`
+	}
+	if json.Unmarshal(params, &p) != nil {
+		return nil, newNWCError("OTHER", "invalid params")
+	}
+	bolt11, err := decodepay.Decodepay(p.Invoice)
+	if err != nil {
+		return nil, newNWCError("OTHER", "invalid invoice")
+	}
+	amount := int(bolt11.MSatoshi / 1000)
+	if amount < 1 {
+		return nil, newNWCError("OTHER", "invoices without an amount are not supported")
+	}
+	// the PIN can't be entered in a connected app
+	if bot.PinRequired(user, amount) {
+		return nil, newNWCError("RESTRICTED", "this payment needs the PIN, pay it in Telegram")
+	}
+	// the budget is reserved before the payment and released if it fails
+	day := time.Now().In(userLocation(user)).Format("2006-01-02")
+	if !connection.reserve(amount, day) {
+		return nil, newNWCError("QUOTA_EXCEEDED", fmt.Sprintf("the daily budget of %d sat is exceeded", connection.Budget))
+	}
+	runtime.IgnoreError(bot.Bunt.Set(connection))
+	invoice, err := bot.PayInvoice(user, p.Invoice)
+	if err != nil {
+		connection.Spent -= amount
+		runtime.IgnoreError(bot.Bunt.Set(connection))
+		if _, ok := err.(spendingLimitError); ok {
+			return nil, newNWCError("QUOTA_EXCEEDED", err.Error())
+		}
+		log.Warnf("[nwc] Payment of %s via %s failed: %s", GetUserStr(user.Telegram), connection.Name, err)
+		return nil, newNWCError("PAYMENT_FAILED", err.Error())
+	}
+	runtime.IgnoreError(bot.Cache.Delete(fmt.Sprintf("%s_balance", user.Name)))
+	log.Infof("[nwc] %s paid %d sat via %s", GetUserStr(user.Telegram), amount, connection.Name)
+	bot.trySendMessage(user.Telegram, fmt.Sprintf(i18n.Translate(user.Telegram.LanguageCode, "nwcPaidMessage"), str.MarkdownEscape(connection.Name), amount))
+	status, err := user.Wallet.Payment(invoice.PaymentHash, bot.Client)
+	if err != nil {
+		log.Warnf("[nwc] Could not load the preimage of %s: %s", invoice.PaymentHash, err)
+	}
+	return map[string]string{"preimage": status.Preimage}, nil
+}
+
+func (bot *TipBot) nwcGetBalance(user *lnbits.User) (interface{}, *nwcError) {
+	balance, err := bot.GetUserBalance(user)
+	if err != nil {
+		return nil, newNWCError("INTERNAL", "could not load the balance")
+	}
+	return map[string]int64{"balance": int64(balance) * 1000}, nil
+}
+
+func (bot *TipBot) nwcMakeInvoice(user *lnbits.User, params json.RawMessage) (interface{}, *nwcError) {
+	var p struct {
+		Amount          int64  `json:"amount"`
+		Description     string `json:"description"`
+		DescriptionHash string `json:"description_hash"`
+	}
+	if json.Unmarshal(params, &p) != nil || p.Amount < 1000 {
+		return nil, newNWCError("OTHER", "the amount must be at least 1 sat")
+	}
+	invoice, err := user.Wallet.Invoice(
+		lnbits.InvoiceParams{
+			Out:             false,
+			Amount:          p.Amount / 1000,
+			Memo:            p.Description,
+			DescriptionHash: p.DescriptionHash,
+			Webhook:         internal.Configuration.Lnbits.WebhookServer},
+		bot.Client)
+	if err != nil {
+		log.Warnf("[nwc] Could not create an invoice for %s: %s", GetUserStr(user.Telegram), err)
+		return nil, newNWCError("INTERNAL", "could not create the invoice")
+	}
+	return nwcTransaction{
+		Type:        "incoming",
+		Invoice:     invoice.PaymentRequest,
+		Description: p.Description,
+		PaymentHash: invoice.PaymentHash,
+		Amount:      p.Amount / 1000 * 1000,
+		CreatedAt:   time.Now().Unix(),
+	}, nil
+}
+
+func (bot *TipBot) nwcLookupInvoice(user *lnbits.User, params json.RawMessage) (interface{}, *nwcError) {
+	var p struct {
+		PaymentHash string `json:"payment_hash"`
+		Invoice     string `json:"invoice"`
+	}
+	if json.Unmarshal(params, &p) != nil {
+		return nil, newNWCError("OTHER", "invalid params")
+	}
+	if len(p.PaymentHash) == 0 {
+		bolt11, err := decodepay.Decodepay(p.Invoice)
+		if err != nil {
+			return nil, newNWCError("OTHER", "invalid invoice")
+		}
+		p.PaymentHash = bolt11.PaymentHash
+	}
+	status, err := user.Wallet.Payment(p.PaymentHash, bot.Client)
+	if err != nil {
+		return nil, newNWCError("NOT_FOUND", "invoice not found")
+	}
+	result := nwcTransaction{
+		Type:        "incoming",
+		Invoice:     status.Details.Bolt11,
+		Description: status.Details.Memo,
+		Preimage:    status.Preimage,
+		PaymentHash: p.PaymentHash,
+		Amount:      status.Details.Amount,
+		FeesPaid:    status.Details.Fee,
+		CreatedAt:   status.Details.Time,
+	}
+	if result.Amount < 0 {
+		result.Type = "outgoing"
+		result.Amount = -result.Amount
+	}
+	if status.Paid {
+		result.SettledAt = status.Details.Time
+	}
+	return result, nil
+}
+
+// nwcHandler invoked on "/nwc [new <name> <budget> [<methods>]|revoke <name>]"
+func (bot *TipBot) nwcHandler(ctx context.Context, m *tb.Message) {
+	bot.anyTextHandler(ctx, m)
+	user := LoadUser(ctx)
+	if user.Wallet == nil {
+		return
+	}
+	if !m.Private() {
+		NewMessage(m, WithDuration(0, bot))
+	}
+	if len(internal.Configuration.Bot.NWC.Relay) == 0 {
+		bot.trySendMessage(m.Sender, Translate(ctx, "nwcDisabledMessage"))
+		return
+	}
+	connections := bot.getNWCConnections(user)
+	action, err := getArgumentFromCommand(m.Text, 1)
+	if err != nil {
+		bot.trySendMessage(m.Sender, bot.makeNWCMessage(ctx, user, connections))
+		return
+	}
+	name, _ := getArgumentFromCommand(m.Text, 2)
+	switch strings.ToLower(action) {
+	case "new":
+		budgetStr, err := getArgumentFromCommand(m.Text, 3)
+		if err != nil {
+			break
+		}
+		budget, err := getAmount(budgetStr)
+		if err != nil || budget < 0 {
+			break
+		}
+		methods := nwcMethods
+		if methodsStr, err := getArgumentFromCommand(m.Text, 4); err == nil {
+			methods = strings.Split(strings.ToLower(methodsStr), ",")
+		}
+		// connections that can pay need the PIN
+		if containsString(methods, "pay_invoice") && bot.requirePinForCommand(ctx, user, pinAlways, m) {
+			return
+		}
+		bot.createNWCConnection(ctx, user, connections, name, budget, methods)
+		return
+	case "revoke":
+		bot.revokeNWCConnection(ctx, user, connections, name)
+		return
+	}
+	bot.trySendMessage(m.Sender, Translate(ctx, "nwcHelpText"))
+}
+
+// createNWCConnection creates a keypair for an app and sends its connection URI
+func (bot *TipBot) createNWCConnection(ctx context.Context, user *lnbits.User, connections []*NWCConnection, name string, budget int, methods []string) {
+	if !walletNameRegex.MatchString(name) || findNWCConnection(connections, name) != nil {
+		bot.trySendMessage(user.Telegram, Translate(ctx, "nwcInvalidNameMessage"))
+		return
+	}
+	if len(connections) >= nwcMaxConnections {
+		bot.trySendMessage(user.Telegram, fmt.Sprintf(Translate(ctx, "nwcTooManyMessage"), nwcMaxConnections))
+		return
+	}
+	for _, method := range methods {
+		if !(&NWCConnection{Methods: nwcMethods}).allows(method) {
+			bot.trySendMessage(user.Telegram, Translate(ctx, "nwcHelpText"))
+			return
+		}
+	}
+	serviceKey, err := bot.getNWCPrivateKey()
+	var servicePubKey, secret, pubKey string
+	if err == nil {
+		servicePubKey, err = nostr.GetPublicKey(serviceKey)
+	}
+	if err == nil {
+		secret, err = nostr.GeneratePrivateKey()
+	}
+	if err == nil {
+		pubKey, err = nostr.GetPublicKey(secret)
+	}
+	if err != nil {
+		log.Errorf("[/nwc] Could not create keys for %s: %s", GetUserStr(user.Telegram), err)
+		bot.trySendMessage(user.Telegram, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	connection := &NWCConnection{
+		PubKey:    pubKey,
+		UserID:    user.Telegram.ID,
+		Name:      name,
+		Methods:   methods,
+		Budget:    budget,
+		CreatedAt: time.Now(),
+	}
+	err = bot.Bunt.Set(connection)
+	if err != nil {
+		log.Errorf("[/nwc] Could not save connection of %s: %s", GetUserStr(user.Telegram), err)
+		bot.trySendMessage(user.Telegram, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	log.Infof("[/nwc] %s connected %s with a budget of %d sat", GetUserStr(user.Telegram), name, budget)
+	// the secret is only sent once and never stored
+	uri := nwcURI(servicePubKey, internal.Configuration.Bot.NWC.Relay, secret)
+	bot.trySendMessage(user.Telegram, fmt.Sprintf(Translate(ctx, "nwcCreatedMessage"), str.MarkdownEscape(name), budget, strings.Join(methods, ", ")))
+	qr, err := qrcode.Encode(uri, qrcode.Medium, 256)
+	if err != nil {
+		log.Errorf("[/nwc] Failed to create QR code for connection: %s", err)
+		bot.trySendMessage(user.Telegram, fmt.Sprintf("`%s`", uri))
+		return
+	}
+	bot.trySendMessage(user.Telegram, &tb.Photo{File: tb.File{FileReader: bytes.NewReader(qr)}, Caption: fmt.Sprintf("`%s`", uri)})
+}
+
+// revokeNWCConnection deletes a connection, its app can't use the wallet anymore
+func (bot *TipBot) revokeNWCConnection(ctx context.Context, user *lnbits.User, connections []*NWCConnection, name string) {
+	connection := findNWCConnection(connections, name)
+	if connection == nil {
+		bot.trySendMessage(user.Telegram, fmt.Sprintf(Translate(ctx, "nwcUnknownMessage"), str.MarkdownEscape(name)))
+		return
+	}
+	err := bot.Bunt.Update(func(tx *buntdb.Tx) error {
+		_, err := tx.Delete(connection.Key())
+		return err
+	})
+	if err != nil {
+		log.Errorf("[/nwc] Could not revoke connection of %s: %s", GetUserStr(user.Telegram), err)
+		bot.trySendMessage(user.Telegram, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	log.Infof("[/nwc] %s revoked %s", GetUserStr(user.Telegram), connection.Name)
+	bot.trySendMessage(user.Telegram, fmt.Sprintf(Translate(ctx, "nwcRevokedMessage"), str.MarkdownEscape(connection.Name)))
+}
+
+// findNWCConnection returns the connection with the name or the number in the /nwc list
+func findNWCConnection(connections []*NWCConnection, nameOrNumber string) *NWCConnection {
+	if i, err := strconv.Atoi(nameOrNumber); err == nil && i > 0 && i <= len(connections) {
+		return connections[i-1]
+	}
+	for _, connection := range connections {
+		if strings.EqualFold(connection.Name, nameOrNumber) {
+			return connection
+		}
+	}
+	return nil
+}
+
+func (bot *TipBot) makeNWCMessage(ctx context.Context, user *lnbits.User, connections []*NWCConnection) string {
+	if len(connections) == 0 {
+		return Translate(ctx, "nwcNoneMessage") + Translate(ctx, "nwcUsageMessage")
+	}
+	day := time.Now().In(userLocation(user)).Format("2006-01-02")
+	lines := make([]string, len(connections))
+	for i, connection := range connections {
+		spent := 0
+		if connection.Day == day {
+			spent = connection.Spent
+		}
+		lines[i] = fmt.Sprintf(Translate(ctx, "nwcEntryMessage"), i+1, str.MarkdownEscape(connection.Name), spent, connection.Budget, strings.Join(connection.Methods, ", "))
+	}
+	return fmt.Sprintf(Translate(ctx, "nwcMessage"), strings.Join(lines, "\n")) + Translate(ctx, "nwcUsageMessage")
+}
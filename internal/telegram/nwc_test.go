@@ -0,0 +1,162 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/nostr"
+	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
+	"github.com/LightningTipBot/LightningTipBot/internal/storage"
+)
+
+// memoryRelay is a local stand-in for a relay
+type memoryRelay struct {
+	mutex         sync.Mutex
+	published     []*nostr.Event
+	subscriptions []chan *nostr.Event
+	filters       []nostr.Filter
+}
+
+func (r *memoryRelay) Publish(ctx context.Context, event *nostr.Event) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.published = append(r.published, event)
+	for i, filter := range r.filters {
+		if filter.Matches(event) {
+			r.subscriptions[i] <- event
+		}
+	}
+	return nil
+}
+
+func (r *memoryRelay) Subscribe(ctx context.Context, filters ...nostr.Filter) (<-chan *nostr.Event, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	events := make(chan *nostr.Event, 10)
+	for _, filter := range filters {
+		r.subscriptions = append(r.subscriptions, events)
+		r.filters = append(r.filters, filter)
+	}
+	return events, nil
+}
+
+func (r *memoryRelay) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	closed := make(map[chan *nostr.Event]bool)
+	for _, events := range r.subscriptions {
+		if !closed[events] {
+			close(events)
+			closed[events] = true
+		}
+	}
+	r.subscriptions, r.filters = nil, nil
+	return nil
+}
+
+func (r *memoryRelay) subscribed() bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.filters) > 0
+}
+
+// responses returns the decrypted responses to an app
+func (r *memoryRelay) responses(t *testing.T, sk, servicePk string) []nwcResponse {
+	pk, _ := nostr.GetPublicKey(sk)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var responses []nwcResponse
+	for _, event := range r.published {
+		if event.Kind != nwcResponseKind || event.TagValues("p")[0] != pk {
+			continue
+		}
+		if err := event.Verify(); err != nil || event.PubKey != servicePk {
+			t.Fatalf("invalid response %+v: %v", event, err)
+		}
+		plaintext, err := nostr.Decrypt(sk, servicePk, event.Content)
+		if err != nil {
+			t.Fatalf("Decrypt() error = %v", err)
+		}
+		var response nwcResponse
+		if err = json.Unmarshal([]byte(plaintext), &response); err != nil {
+			t.Fatalf("invalid response %s", plaintext)
+		}
+		responses = append(responses, response)
+	}
+	return responses
+}
+
+func TestTipBot_serveNWC(t *testing.T) {
+	bot := &TipBot{Bunt: storage.NewBunt(":memory:")}
+	serviceSk, _ := nostr.GeneratePrivateKey()
+	servicePk, _ := nostr.GetPublicKey(serviceSk)
+	appSk, _ := nostr.GeneratePrivateKey()
+	appPk, _ := nostr.GetPublicKey(appSk)
+	strangerSk, _ := nostr.GeneratePrivateKey()
+	if err := bot.Bunt.Set(&NWCConnection{PubKey: appPk, UserID: 1, Name: "app", Methods: []string{"get_balance"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	relay := &memoryRelay{}
+	done := make(chan error)
+	go func() {
+		done <- bot.serveNWC(context.Background(), relay, serviceSk)
+	}()
+	request := func(sk, method string) *nostr.Event {
+		content, _ := nostr.Encrypt(sk, servicePk, `{"method":"`+method+`","params":{}}`)
+		event := nostr.NewEvent(nwcRequestKind, content, []string{"p", servicePk})
+		if err := event.Sign(sk); err != nil {
+			t.Fatal(err)
+		}
+		return event
+	}
+	for !relay.subscribed() {
+		time.Sleep(time.Millisecond)
+	}
+	pay := request(appSk, "pay_invoice")
+	for _, event := range []*nostr.Event{pay, pay, request(appSk, "pay_keysend"), request(strangerSk, "get_balance")} {
+		runtime.IgnoreError(relay.Publish(context.Background(), event))
+	}
+	// wait until all requests are answered
+	deadline := time.Now().Add(5 * time.Second)
+	for len(relay.responses(t, appSk, servicePk)) < 2 || len(relay.responses(t, strangerSk, servicePk)) < 1 {
+		if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	relay.Close()
+	if err := <-done; err == nil {
+		t.Errorf("serveNWC() returned without error after the relay closed")
+	}
+
+	responses := relay.responses(t, appSk, servicePk)
+	// the replayed payment is not answered twice
+	if len(responses) != 2 {
+		t.Fatalf("got %d responses to the app, want 2", len(responses))
+	}
+	if responses[0].ResultType != "pay_invoice" || responses[0].Error == nil || responses[0].Error.Code != "RESTRICTED" {
+		t.Errorf("pay_invoice response = %+v, want RESTRICTED", responses[0])
+	}
+	if responses[1].Error == nil || responses[1].Error.Code != "NOT_IMPLEMENTED" {
+		t.Errorf("pay_keysend response = %+v, want NOT_IMPLEMENTED", responses[1])
+	}
+	if responses = relay.responses(t, strangerSk, servicePk); len(responses) != 1 || responses[0].Error.Code != "UNAUTHORIZED" {
+		t.Errorf("responses to an unknown app = %+v, want UNAUTHORIZED", responses)
+	}
+}
+
+func TestNWCConnection_reserve(t *testing.T) {
+	c := &NWCConnection{Budget: 1000}
+	if !c.reserve(600, "2021-01-01") || c.reserve(500, "2021-01-01") {
+		t.Fatalf("reserve() exceeded the budget, spent %d", c.Spent)
+	}
+	// the budget renews every day
+	if !c.reserve(1000, "2021-01-02") || c.Spent != 1000 {
+		t.Errorf("reserve() on a new day failed, spent %d", c.Spent)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/LightningTipBot/LightningTipBot/internal/events"
 	"github.com/LightningTipBot/LightningTipBot/internal/i18n"
 	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
 	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
@@ -31,15 +32,15 @@ func helpPayInvoiceUsage(ctx context.Context, errormsg string) string {
 
 type PayData struct {
 	*transaction.Base
-	From            *lnbits.User `json:"from"`
-	Invoice         string       `json:"invoice"`
-	Hash            string       `json:"hash"`
-	Proof           string       `json:"proof"`
-	Memo            string       `json:"memo"`
-	Message         string       `json:"message"`
-	Amount          int64        `json:"amount"`
-	LanguageCode    string       `json:"languagecode"`
-	TelegramMessage *tb.Message  `json:"telegrammessage"`
+	From            lnbits.UserRef `json:"from"`
+	Invoice         string         `json:"invoice"`
+	Hash            string         `json:"hash"`
+	Proof           string         `json:"proof"`
+	Memo            string         `json:"memo"`
+	Message         string         `json:"message"`
+	Amount          int64          `json:"amount"`
+	LanguageCode    string         `json:"languagecode"`
+	TelegramMessage *tb.Message    `json:"telegrammessage"`
 }
 
 // payHandler invoked on "/pay lnbc..." command
@@ -131,7 +132,7 @@ func (bot *TipBot) payHandler(ctx context.Context, m *tb.Message) {
 	payMessage := bot.trySendMessage(m.Chat, confirmText, paymentConfirmationMenu)
 	payData := PayData{
 		Base:            transaction.New(transaction.ID(id)),
-		From:            user,
+		From:            user.Ref(),
 		Invoice:         paymentRequest,
 		Amount:          int64(amount),
 		Memo:            bolt11.Description,
@@ -157,7 +158,7 @@ func (bot *TipBot) confirmPayHandler(ctx context.Context, c *tb.Callback) {
 	payData := sn.(*PayData)
 
 	// onnly the correct user can press
-	if payData.From.Telegram.ID != c.Sender.ID {
+	if payData.From.TelegramID != c.Sender.ID {
 		return
 	}
 	// immediatelly set intransaction to block duplicate calls
@@ -184,6 +185,10 @@ func (bot *TipBot) confirmPayHandler(ctx context.Context, c *tb.Callback) {
 		bot.tryDeleteMessage(c.Message)
 		return
 	}
+	// large payments wait for the PIN
+	if bot.requirePinForCallback(ctx, user, int(payData.Amount), "pay", c) {
+		return
+	}
 
 	invoiceString := payData.Invoice
 
@@ -203,10 +208,12 @@ func (bot *TipBot) confirmPayHandler(ctx context.Context, c *tb.Callback) {
 		},
 	)
 	// pay invoice
-	invoice, err := user.Wallet.Pay(lnbits.PaymentParams{Out: true, Bolt11: invoiceString}, bot.Client)
+	invoice, err := bot.PayInvoice(user, invoiceString)
 	if err != nil {
 		errmsg := fmt.Sprintf("[/pay] Could not pay invoice of %s: %s", userStr, err)
-		err = fmt.Errorf(i18n.Translate(payData.LanguageCode, "invoiceUndefinedErrorMessage"))
+		if _, ok := err.(spendingLimitError); !ok {
+			err = fmt.Errorf(i18n.Translate(payData.LanguageCode, "invoiceUndefinedErrorMessage"))
+		}
 		bot.tryEditMessage(c.Message, fmt.Sprintf(i18n.Translate(payData.LanguageCode, "invoicePaymentFailedMessage"), err.Error()), &tb.ReplyMarkup{})
 		// verbose error message, turned off for now
 		// if len(err.Error()) == 0 {
@@ -227,7 +234,7 @@ func (bot *TipBot) confirmPayHandler(ctx context.Context, c *tb.Callback) {
 		bot.trySendMessage(c.Sender, i18n.Translate(payData.LanguageCode, "invoicePaidMessage"))
 		bot.tryEditMessage(c.Message, fmt.Sprintf(i18n.Translate(payData.LanguageCode, "invoicePublicPaidMessage"), userStr), &tb.ReplyMarkup{})
 	}
-	log.Printf("[pay] User %s paid invoice %s (%d sat)", userStr, payData.ID, payData.Amount)
+	bot.Events.Publish(events.Payment{Kind: events.Pay, From: user, Amount: int(payData.Amount), Memo: payData.Memo, PaymentHash: invoice.PaymentHash, ReferenceID: payData.ID})
 	return
 }
 
@@ -245,7 +252,7 @@ func (bot *TipBot) cancelPaymentHandler(ctx context.Context, c *tb.Callback) {
 	}
 	payData := sn.(*PayData)
 	// onnly the correct user can press
-	if payData.From.Telegram.ID != c.Sender.ID {
+	if payData.From.TelegramID != c.Sender.ID {
 		return
 	}
 	bot.tryEditMessage(c.Message, i18n.Translate(payData.LanguageCode, "paymentCancelledMessage"), &tb.ReplyMarkup{})
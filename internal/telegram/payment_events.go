@@ -0,0 +1,179 @@
+package telegram
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/events"
+	"github.com/LightningTipBot/LightningTipBot/internal/i18n"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/str"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/buntdb"
+)
+
+const (
+	paymentStatisticsKeyBase = "stats-"
+	paymentStatisticsTTL     = 35 * 24 * time.Hour
+	statisticsDayFormat      = "2006-01-02"
+)
+
+// subscribePaymentEvents hooks the reactions to payments into the event bus
+func (bot *TipBot) subscribePaymentEvents() {
+	bot.Events.Subscribe("log", logPayment)
+	bot.Events.Subscribe("statistics", bot.recordPaymentStatistics)
+	bot.Events.Subscribe("notifications", bot.notifyPayment)
+	bot.Events.Subscribe("webhooks", bot.emitPaymentWebhooks)
+}
+
+// transactionPayment is the event of a successful transaction between Telegram users
+func transactionPayment(kind events.Kind, t *Transaction) events.Payment {
+	return events.Payment{
+		Kind:          kind,
+		From:          t.From,
+		To:            t.To,
+		Amount:        t.Amount,
+		ChatID:        t.ChatID,
+		Chat:          t.ChatName,
+		TransactionID: t.ID,
+		Time:          t.Time,
+	}
+}
+
+// paymentUserStr describes a side of a payment, payments from or to outside the bot have none
+func paymentUserStr(user *lnbits.User) string {
+	if user == nil || user.Telegram == nil {
+		return "lightning"
+	}
+	return GetUserStr(user.Telegram)
+}
+
+func logPayment(payment events.Payment) {
+	reference := ""
+	if len(payment.ReferenceID) > 0 {
+		reference = " " + payment.ReferenceID
+	}
+	log.Infof("[%s%s] %d sat from %s to %s", payment.Kind, reference, payment.Amount, paymentUserStr(payment.From), paymentUserStr(payment.To))
+}
+
+// notifyPayment tells the users about the payments they did not make themselves, as set with /notifications
+func (bot *TipBot) notifyPayment(payment events.Payment) {
+	var received, sent string
+	switch payment.Kind {
+	case events.Tip:
+		received = "tipReceivedMessage"
+	case events.FaucetClaim:
+		received, sent = "inlineFaucetReceivedMessage", "inlineFaucetSentMessage"
+	case events.TipjarContribution:
+		received, sent = "inlineTipjarReceivedMessage", "inlineTipjarSentMessage"
+	case events.Deposit:
+		bot.notifyUser(payment.To, payment.Kind, fmt.Sprintf(i18n.Translate(payment.To.Telegram.LanguageCode, "invoiceReceivedMessage"), payment.Amount))
+		bot.notifyPaymentMemo(payment)
+		return
+	default:
+		return
+	}
+	bot.notifyUser(payment.To, payment.Kind, fmt.Sprintf(i18n.Translate(payment.To.Telegram.LanguageCode, received), GetUserStrMd(payment.From.Telegram), payment.Amount))
+	if len(sent) > 0 {
+		bot.notifyUser(payment.From, payment.Kind, fmt.Sprintf(i18n.Translate(payment.From.Telegram.LanguageCode, sent), payment.Amount, GetUserStrMd(payment.To.Telegram)))
+	}
+	bot.notifyPaymentMemo(payment)
+}
+
+func (bot *TipBot) notifyPaymentMemo(payment events.Payment) {
+	if len(payment.Memo) == 0 {
+		return
+	}
+	// memos are not part of the statistics, they are kept for the digest
+	if bot.getNotificationSettings(payment.To.Telegram.ID).mode(payment.Kind) == notifyDigest {
+		bot.addDigestMemo(payment.To, payment.Time, DigestMemo{From: paymentUserStr(payment.From), Memo: payment.Memo})
+		return
+	}
+	bot.notifyUser(payment.To, payment.Kind, fmt.Sprintf("✉️ %s", str.MarkdownEscape(payment.Memo)))
+}
+
+// PaymentStatistics are the payments of a user on a day in the time zone of the user
+type PaymentStatistics struct {
+	UserID        int    `json:"user_id"`
+	Day           string `json:"day"`
+	Received      int    `json:"received"`
+	ReceivedCount int    `json:"received_count"`
+	Sent          int    `json:"sent"`
+	SentCount     int    `json:"sent_count"`
+	// Counterparties is the volume per counterparty in both directions
+	Counterparties map[string]int `json:"counterparties"`
+	// Memos are the memos of received payments that the user gets in the digest
+	Memos []DigestMemo `json:"memos,omitempty"`
+}
+
+// DigestMemo is the memo of a payment and its sender
+type DigestMemo struct {
+	From string `json:"from"`
+	Memo string `json:"memo"`
+}
+
+func (s *PaymentStatistics) Key() string {
+	return fmt.Sprintf("%s%d-%s", paymentStatisticsKeyBase, s.UserID, s.Day)
+}
+
+// recordPaymentStatistics adds a payment to the daily statistics of both users
+func (bot *TipBot) recordPaymentStatistics(payment events.Payment) {
+	if payment.From != nil && payment.From.Telegram != nil {
+		bot.addPaymentStatistics(payment.From, payment.Time, -payment.Amount, paymentUserStr(payment.To))
+	}
+	if payment.To != nil && payment.To.Telegram != nil {
+		bot.addPaymentStatistics(payment.To, payment.Time, payment.Amount, paymentUserStr(payment.From))
+	}
+}
+
+// addPaymentStatistics adds a received (amount > 0) or a sent (amount < 0) payment
+func (bot *TipBot) addPaymentStatistics(user *lnbits.User, t time.Time, amount int, counterparty string) {
+	err := bot.updatePaymentStatistics(user, t, func(stats *PaymentStatistics) {
+		if amount > 0 {
+			stats.Received += amount
+			stats.ReceivedCount++
+			stats.Counterparties[counterparty] += amount
+		} else {
+			stats.Sent -= amount
+			stats.SentCount++
+			stats.Counterparties[counterparty] -= amount
+		}
+	})
+	if err != nil {
+		log.Errorf("[statistics] Could not record payment of %s: %s", GetUserStr(user.Telegram), err)
+	}
+}
+
+// addDigestMemo keeps the memo of a received payment for the digest
+func (bot *TipBot) addDigestMemo(user *lnbits.User, t time.Time, memo DigestMemo) {
+	err := bot.updatePaymentStatistics(user, t, func(stats *PaymentStatistics) {
+		stats.Memos = append(stats.Memos, memo)
+	})
+	if err != nil {
+		log.Errorf("[statistics] Could not record memo of %s: %s", GetUserStr(user.Telegram), err)
+	}
+}
+
+// updatePaymentStatistics changes the statistics of the day of t in the time zone of the user
+func (bot *TipBot) updatePaymentStatistics(user *lnbits.User, t time.Time, update func(stats *PaymentStatistics)) error {
+	stats := &PaymentStatistics{UserID: user.Telegram.ID, Day: t.In(userLocation(user)).Format(statisticsDayFormat)}
+	key := stats.Key()
+	return bot.Bunt.Update(func(tx *buntdb.Tx) error {
+		if value, err := tx.Get(key); err == nil {
+			if err = json.Unmarshal([]byte(value), stats); err != nil {
+				return err
+			}
+		}
+		if stats.Counterparties == nil {
+			stats.Counterparties = make(map[string]int)
+		}
+		update(stats)
+		b, err := json.Marshal(stats)
+		if err != nil {
+			return err
+		}
+		_, _, err = tx.Set(key, string(b), &buntdb.SetOptions{Expires: true, TTL: paymentStatisticsTTL})
+		return err
+	})
+}
@@ -0,0 +1,55 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/events"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/storage"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+func TestTipBot_recordPaymentStatistics(t *testing.T) {
+	bot := &TipBot{Bunt: storage.NewBunt(":memory:")}
+	alice := &lnbits.User{Telegram: &tb.User{ID: 1, Username: "alice"}}
+	bob := &lnbits.User{Telegram: &tb.User{ID: 2, Username: "bob"}, TimeZone: "America/New_York"}
+	// 02:00 UTC is still the previous day in New York
+	now := time.Date(2021, 11, 14, 2, 0, 0, 0, time.UTC)
+	bot.recordPaymentStatistics(events.Payment{Kind: events.Tip, From: alice, To: bob, Amount: 21, Time: now})
+	bot.recordPaymentStatistics(events.Payment{Kind: events.Tip, From: alice, To: bob, Amount: 100, Time: now})
+	bot.recordPaymentStatistics(events.Payment{Kind: events.Deposit, To: alice, Amount: 1000, Time: now})
+
+	stats := &PaymentStatistics{UserID: 1, Day: "2021-11-14"}
+	if err := bot.Bunt.Get(stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Sent != 121 || stats.SentCount != 2 || stats.Received != 1000 || stats.Counterparties["@bob"] != 121 || stats.Counterparties["lightning"] != 1000 {
+		t.Errorf("statistics of alice = %+v", stats)
+	}
+	stats = &PaymentStatistics{UserID: 2, Day: "2021-11-13"}
+	if err := bot.Bunt.Get(stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.Received != 121 || stats.ReceivedCount != 2 || stats.Sent != 0 {
+		t.Errorf("statistics of bob = %+v", stats)
+	}
+}
+
+func TestTipBot_notifyPaymentMemo(t *testing.T) {
+	bot := &TipBot{Bunt: storage.NewBunt(":memory:")}
+	alice := &lnbits.User{Telegram: &tb.User{ID: 1, Username: "alice"}}
+	bob := &lnbits.User{Telegram: &tb.User{ID: 2, Username: "bob"}}
+	settings := bot.getNotificationSettings(bob.Telegram.ID)
+	settings.apply(string(events.Tip), notifyDigest)
+	if err := bot.Bunt.Set(settings); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2021, 11, 14, 12, 0, 0, 0, time.UTC)
+	bot.notifyPaymentMemo(events.Payment{Kind: events.Tip, From: alice, To: bob, Amount: 21, Memo: "thanks", Time: now})
+
+	stats := bot.getDigestStatistics(bob, now.AddDate(0, 0, 1), 1)
+	if len(stats.Memos) != 1 || stats.Memos[0] != (DigestMemo{From: "@alice", Memo: "thanks"}) {
+		t.Errorf("memos of bob = %+v", stats.Memos)
+	}
+}
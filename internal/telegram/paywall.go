@@ -0,0 +1,245 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/i18n"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
+	"github.com/LightningTipBot/LightningTipBot/internal/storage/transaction"
+	"github.com/LightningTipBot/LightningTipBot/internal/str"
+	log "github.com/sirupsen/logrus"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+var (
+	paywallMenu      = &tb.ReplyMarkup{ResizeReplyKeyboard: false}
+	btnUnlockPaywall = paywallMenu.Data("🔓", "unlock_paywall")
+)
+
+// PaywallContent is the locked part of a paywall. Photos and files are
+// stored by their Telegram file ID.
+type PaywallContent struct {
+	Text       string `json:"text"`
+	PhotoID    string `json:"photo_id"`
+	DocumentID string `json:"document_id"`
+	FileName   string `json:"file_name"`
+	Caption    string `json:"caption"`
+}
+
+type Paywall struct {
+	*transaction.Base
+	From          lnbits.UserRef   `json:"paywall_from"`
+	Price         int              `json:"paywall_price"`
+	Teaser        string           `json:"paywall_teaser"`
+	Content       PaywallContent   `json:"paywall_content"`
+	Buyers        []int            `json:"paywall_buyers"`
+	Earnings      int              `json:"paywall_earnings"`
+	ChatTitle     string           `json:"paywall_chattitle"`
+	AuthorMessage tb.StoredMessage `json:"paywall_authormessage"`
+	LanguageCode  string           `json:"languagecode"`
+}
+
+func helpPaywallUsage(ctx context.Context, errormsg string) string {
+	return fmt.Sprintf(Translate(ctx, "paywallHelpText"), errormsg)
+}
+
+// getPaywallContent returns the content of "/paywall <price> <content>" or,
+// if the command is a reply, the replied-to text, photo or file.
+func getPaywallContent(m *tb.Message) (content PaywallContent, teaser string, ok bool) {
+	arguments := strings.SplitN(m.Text, " ", 3)
+	if len(arguments) == 3 {
+		teaser = strings.TrimSpace(arguments[2])
+	}
+	if !m.IsReply() {
+		// the text after the price is the locked content
+		return PaywallContent{Text: teaser}, "", len(teaser) > 0
+	}
+	r := m.ReplyTo
+	switch {
+	case r.Photo != nil:
+		content = PaywallContent{PhotoID: r.Photo.FileID, Caption: r.Caption}
+	case r.Document != nil:
+		content = PaywallContent{DocumentID: r.Document.FileID, FileName: r.Document.FileName, Caption: r.Caption}
+	case len(r.Text) > 0:
+		content = PaywallContent{Text: r.Text}
+	default:
+		return content, teaser, false
+	}
+	return content, teaser, true
+}
+
+// isPaywallAuthor checks that a reply puts a message of the sender behind the paywall,
+// only the author can sell the content of a message
+func isPaywallAuthor(m *tb.Message) bool {
+	return !m.IsReply() || (m.ReplyTo.Sender != nil && m.ReplyTo.Sender.ID == m.Sender.ID)
+}
+
+// kind returns the translation key describing the content
+func (content PaywallContent) kind() string {
+	switch {
+	case len(content.PhotoID) > 0:
+		return "paywallKindPhoto"
+	case len(content.DocumentID) > 0:
+		return "paywallKindFile"
+	}
+	return "paywallKindText"
+}
+
+// sendable returns the content as it is sent to a buyer
+func (content PaywallContent) sendable() interface{} {
+	switch {
+	case len(content.PhotoID) > 0:
+		return &tb.Photo{File: tb.File{FileID: content.PhotoID}, Caption: str.MarkdownEscape(content.Caption)}
+	case len(content.DocumentID) > 0:
+		return &tb.Document{File: tb.File{FileID: content.DocumentID}, FileName: content.FileName, Caption: str.MarkdownEscape(content.Caption)}
+	}
+	return str.MarkdownEscape(content.Text)
+}
+
+func (paywall *Paywall) makeMessage(author *lnbits.User) string {
+	message := fmt.Sprintf(
+		i18n.Translate(paywall.LanguageCode, "paywallMessage"),
+		GetUserStrMd(author.Telegram),
+		i18n.Translate(paywall.LanguageCode, paywall.Content.kind()),
+		paywall.Price,
+		len(paywall.Buyers),
+	)
+	if len(paywall.Teaser) > 0 {
+		message = message + fmt.Sprintf(i18n.Translate(paywall.LanguageCode, "paywallAppendTeaser"), str.MarkdownEscape(paywall.Teaser))
+	}
+	return message
+}
+
+func (bot TipBot) makePaywallKeyboard(paywall *Paywall) *tb.ReplyMarkup {
+	unlockButton := paywallMenu.Data(fmt.Sprintf(i18n.Translate(paywall.LanguageCode, "paywallUnlockButtonMessage"), paywall.Price), "unlock_paywall", paywall.ID)
+	paywallMenu.Inline(
+		paywallMenu.Row(unlockButton))
+	return paywallMenu
+}
+
+// paywallHandler invoked on "/paywall <price> <content>" or as a reply to a
+// text, photo or file with "/paywall <price> [<teaser>]"
+func (bot *TipBot) paywallHandler(ctx context.Context, m *tb.Message) {
+	bot.anyTextHandler(ctx, m)
+	from := LoadUser(ctx)
+	if from.Wallet == nil {
+		return
+	}
+	if m.Private() {
+		bot.trySendMessage(m.Sender, helpPaywallUsage(ctx, Translate(ctx, "paywallHelpInGroup")))
+		return
+	}
+	price, err := decodeAmountFromCommand(m.Text)
+	if err != nil || price < 1 {
+		NewMessage(m, WithDuration(0, bot))
+		bot.trySendMessage(m.Sender, helpPaywallUsage(ctx, Translate(ctx, "paywallInvalidAmountMessage")))
+		return
+	}
+	if !isPaywallAuthor(m) {
+		NewMessage(m, WithDuration(0, bot))
+		bot.trySendMessage(m.Sender, helpPaywallUsage(ctx, Translate(ctx, "paywallNotAuthorMessage")))
+		return
+	}
+	content, teaser, ok := getPaywallContent(m)
+	if !ok {
+		NewMessage(m, WithDuration(0, bot))
+		bot.trySendMessage(m.Sender, helpPaywallUsage(ctx, Translate(ctx, "paywallNoContentMessage")))
+		return
+	}
+	id := fmt.Sprintf("paywall-%d-%d-%s", m.Sender.ID, price, RandStringRunes(5))
+	paywall := &Paywall{
+		Base:         transaction.New(transaction.ID(id)),
+		From:         from.Ref(),
+		Price:        price,
+		Teaser:       teaser,
+		Content:      content,
+		ChatTitle:    m.Chat.Title,
+		LanguageCode: ctx.Value("publicLanguageCode").(string),
+	}
+	runtime.IgnoreError(paywall.Set(paywall, bot.Bunt))
+
+	// remove the unlocked original from the chat
+	if m.IsReply() {
+		bot.tryDeleteMessage(m.ReplyTo)
+	}
+	bot.tryDeleteMessage(m)
+	bot.trySendMessage(m.Chat, paywall.makeMessage(from), bot.makePaywallKeyboard(paywall))
+	log.Infof("[paywall] %s created paywall %s: %d sat", GetUserStr(m.Sender), paywall.ID, price)
+}
+
+// unlockPaywallHandler charges the buyer and sends the content in a private chat
+func (bot *TipBot) unlockPaywallHandler(ctx context.Context, c *tb.Callback) {
+	buyer := LoadUser(ctx)
+	if buyer.Wallet == nil {
+		return
+	}
+	tx := &Paywall{Base: transaction.New(transaction.ID(c.Data))}
+	sn, err := tx.Get(tx, bot.Bunt)
+	if err != nil {
+		log.Errorf("[unlockPaywallHandler] %s", err)
+		return
+	}
+	paywall := sn.(*Paywall)
+	// the author and users that already paid receive the content again
+	if paywall.From.TelegramID == buyer.Telegram.ID || containsID(paywall.Buyers, buyer.Telegram.ID) {
+		bot.trySendMessage(buyer.Telegram, paywall.Content.sendable())
+		return
+	}
+	err = paywall.Lock(paywall, bot.Bunt)
+	if err != nil {
+		log.Errorf("[unlockPaywallHandler] %s", err)
+		return
+	}
+	defer paywall.Release(paywall, bot.Bunt)
+	if !paywall.Active {
+		log.Errorf("[unlockPaywallHandler] paywall %s not active anymore", paywall.ID)
+		return
+	}
+
+	// expensive paywalls wait for the PIN
+	if bot.requirePinForCallback(ctx, buyer, paywall.Price, "paywall", c) {
+		return
+	}
+	to, err := bot.loadUser(paywall.From)
+	if err != nil {
+		log.Errorf("[unlockPaywallHandler] %s", err)
+		return
+	}
+	buyerStr := GetUserStr(buyer.Telegram)
+	t := NewTransaction(bot, buyer, to, paywall.Price, TransactionType("paywall"), TransactionChat(c.Message.Chat), TransactionConfirmed())
+	t.Memo = fmt.Sprintf("Paywall from %s to %s (%d sat).", buyerStr, GetUserStr(to.Telegram), paywall.Price)
+	success, err := t.Send()
+	if !success {
+		log.Warnf("[paywall] Transaction from %s failed: %s", buyerStr, err)
+		bot.trySendMessage(buyer.Telegram, fmt.Sprintf(i18n.Translate(buyer.Telegram.LanguageCode, "paywallFailedMessage"), paywall.Price))
+		return
+	}
+	log.Infof("[paywall] %s unlocked paywall %s for %d sat", buyerStr, paywall.ID, paywall.Price)
+	paywall.Buyers = append(paywall.Buyers, buyer.Telegram.ID)
+	paywall.Earnings += paywall.Price
+	bot.trySendMessage(buyer.Telegram, paywall.Content.sendable())
+	bot.tryEditMessage(c.Message, paywall.makeMessage(to), bot.makePaywallKeyboard(paywall))
+	bot.updatePaywallEarnings(paywall, to)
+}
+
+// updatePaywallEarnings keeps a single message in the author's private chat up to date
+// instead of notifying them about every purchase.
+func (bot *TipBot) updatePaywallEarnings(paywall *Paywall, author *lnbits.User) {
+	earnings := fmt.Sprintf(
+		i18n.Translate(author.Telegram.LanguageCode, "paywallEarningsMessage"),
+		str.MarkdownEscape(paywall.ChatTitle),
+		len(paywall.Buyers),
+		paywall.Earnings,
+	)
+	if len(paywall.AuthorMessage.MessageID) > 0 {
+		if _, err := bot.Telegram.Edit(paywall.AuthorMessage, earnings); err == nil {
+			return
+		}
+	}
+	if msg := bot.trySendMessage(author.Telegram, earnings); msg != nil {
+		paywall.AuthorMessage = storedMessage(msg)
+	}
+}
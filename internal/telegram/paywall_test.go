@@ -0,0 +1,83 @@
+package telegram
+
+import (
+	"testing"
+
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+func Test_getPaywallContent(t *testing.T) {
+	tests := []struct {
+		name       string
+		m          *tb.Message
+		want       PaywallContent
+		wantTeaser string
+		wantOk     bool
+	}{
+		{
+			name:   "text",
+			m:      &tb.Message{Text: "/paywall 100 the secret sauce"},
+			want:   PaywallContent{Text: "the secret sauce"},
+			wantOk: true,
+		},
+		{
+			name:   "no content",
+			m:      &tb.Message{Text: "/paywall 100"},
+			wantOk: false,
+		},
+		{
+			name:       "reply to text",
+			m:          &tb.Message{Text: "/paywall 100 a teaser", ReplyTo: &tb.Message{Text: "the secret sauce"}},
+			want:       PaywallContent{Text: "the secret sauce"},
+			wantTeaser: "a teaser",
+			wantOk:     true,
+		},
+		{
+			name:   "reply to photo",
+			m:      &tb.Message{Text: "/paywall 100", ReplyTo: &tb.Message{Photo: &tb.Photo{File: tb.File{FileID: "photo"}}, Caption: "sunset"}},
+			want:   PaywallContent{PhotoID: "photo", Caption: "sunset"},
+			wantOk: true,
+		},
+		{
+			name:   "reply to document",
+			m:      &tb.Message{Text: "/paywall 100", ReplyTo: &tb.Message{Document: &tb.Document{File: tb.File{FileID: "file"}, FileName: "book.pdf"}}},
+			want:   PaywallContent{DocumentID: "file", FileName: "book.pdf"},
+			wantOk: true,
+		},
+		{
+			name:       "reply to sticker",
+			m:          &tb.Message{Text: "/paywall 100 a teaser", ReplyTo: &tb.Message{Sticker: &tb.Sticker{File: tb.File{FileID: "sticker"}}}},
+			wantTeaser: "a teaser",
+			wantOk:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content, teaser, ok := getPaywallContent(tt.m)
+			if content != tt.want || teaser != tt.wantTeaser || ok != tt.wantOk {
+				t.Errorf("getPaywallContent() = %+v, %q, %v, want %+v, %q, %v", content, teaser, ok, tt.want, tt.wantTeaser, tt.wantOk)
+			}
+		})
+	}
+}
+
+func Test_isPaywallAuthor(t *testing.T) {
+	author, other := &tb.User{ID: 1}, &tb.User{ID: 2}
+	tests := []struct {
+		name string
+		m    *tb.Message
+		want bool
+	}{
+		{name: "no reply", m: &tb.Message{Sender: author, Text: "/paywall 100 secret"}, want: true},
+		{name: "own message", m: &tb.Message{Sender: author, ReplyTo: &tb.Message{Sender: author, Text: "secret"}}, want: true},
+		{name: "message of another user", m: &tb.Message{Sender: author, ReplyTo: &tb.Message{Sender: other, Text: "secret"}}, want: false},
+		{name: "message without sender", m: &tb.Message{Sender: author, ReplyTo: &tb.Message{Text: "secret"}}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isPaywallAuthor(tt.m); got != tt.want {
+				t.Errorf("isPaywallAuthor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,201 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal"
+	"github.com/LightningTipBot/LightningTipBot/internal/i18n"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
+	"github.com/LightningTipBot/LightningTipBot/internal/scheduler"
+	"github.com/LightningTipBot/LightningTipBot/internal/storage/transaction"
+	"github.com/LightningTipBot/LightningTipBot/internal/str"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/buntdb"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+var telegramUsernameRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]{4,31}$`)
+
+const (
+	pendingClaimKeyBase    = "claim-"
+	expirePendingClaimJob  = "expire-pending-claim"
+	pendingClaimMaxPerUser = 10
+)
+
+// PendingClaim is a send to a username that has not started the bot yet. The amount is
+// held in the bot wallet until the user starts the bot or the claim expires.
+type PendingClaim struct {
+	*transaction.Base
+	From       lnbits.UserRef `json:"claim_from"`
+	ToUsername string         `json:"claim_to_username"`
+	Amount     int            `json:"claim_amount"`
+	Memo       string         `json:"claim_memo"`
+	ExpiresAt  time.Time      `json:"claim_expires"`
+}
+
+// isTelegramUsername checks whether s is a valid username, without the @
+func isTelegramUsername(s string) bool {
+	return telegramUsernameRegex.MatchString(s)
+}
+
+func pendingClaimPattern(username string) string {
+	return fmt.Sprintf("%s%s-*", pendingClaimKeyBase, strings.ToLower(username))
+}
+
+// getPendingClaims returns the active claims of a username
+func (bot *TipBot) getPendingClaims(username string) []*PendingClaim {
+	claims := make([]*PendingClaim, 0)
+	runtime.IgnoreError(bot.Bunt.View(func(tx *buntdb.Tx) error {
+		return tx.AscendKeys(pendingClaimPattern(username), func(key, value string) bool {
+			claim := &PendingClaim{}
+			if json.Unmarshal([]byte(value), claim) != nil || claim.Base == nil {
+				return true
+			}
+			if claim.Active {
+				claims = append(claims, claim)
+			}
+			return true
+		})
+	}))
+	return claims
+}
+
+// createPendingClaim escrows a confirmed send to a user without a wallet
+func (bot *TipBot) createPendingClaim(ctx context.Context, c *tb.Callback, sendData *SendData) {
+	from := LoadUser(ctx)
+	username := strings.ToLower(sendData.ToTelegramUser)
+	toUserStrMd := str.MarkdownEscape("@" + sendData.ToTelegramUser)
+	if len(bot.getPendingClaims(username)) >= pendingClaimMaxPerUser {
+		bot.tryEditMessage(c.Message, fmt.Sprintf(i18n.Translate(sendData.LanguageCode, "pendingClaimTooManyMessage"), toUserStrMd), &tb.ReplyMarkup{})
+		return
+	}
+	escrow, err := bot.GetBotUser()
+	if err != nil {
+		log.Errorf("[send] Could not load bot wallet: %s", err)
+		bot.tryEditMessage(c.Message, i18n.Translate(sendData.LanguageCode, "errorTryLaterMessage"), &tb.ReplyMarkup{})
+		return
+	}
+	amount := int(sendData.Amount)
+	t := NewTransaction(bot, from, escrow, amount, TransactionType("pending claim"), TransactionConfirmed())
+	t.Memo = fmt.Sprintf("Pending claim from %s to @%s (%d sat).", GetUserStr(from.Telegram), username, amount)
+	success, err := t.Send()
+	if !success {
+		log.Warnf("[send] Pending claim from %s to @%s failed: %s", GetUserStr(from.Telegram), username, err)
+		bot.tryEditMessage(c.Message, fmt.Sprintf("%s %s", i18n.Translate(sendData.LanguageCode, "sendErrorMessage"), err), &tb.ReplyMarkup{})
+		return
+	}
+	// the confirmation is done
+	sendData.Active = false
+
+	days := internal.Configuration.Bot.PendingClaimDays
+	id := fmt.Sprintf("%s%s-%d-%s", pendingClaimKeyBase, username, from.Telegram.ID, RandStringRunes(5))
+	claim := &PendingClaim{
+		Base:       transaction.New(transaction.ID(id)),
+		From:       from.Ref(),
+		ToUsername: username,
+		Amount:     amount,
+		Memo:       sendData.Memo,
+		ExpiresAt:  time.Now().AddDate(0, 0, days),
+	}
+	runtime.IgnoreError(claim.Set(claim, bot.Bunt))
+	_, err = bot.Scheduler.Schedule(expirePendingClaimJob, claim.ExpiresAt, claim.ID)
+	if err != nil {
+		log.Errorf("[send] Could not schedule expiry of %s: %s", claim.ID, err)
+	}
+	log.Infof("[send] %s sent %d sat to @%s, pending until they start the bot", GetUserStr(from.Telegram), amount, username)
+	bot.tryEditMessage(c.Message, fmt.Sprintf(i18n.Translate(sendData.LanguageCode, "pendingClaimCreatedMessage"), amount, toUserStrMd, GetUserStrMd(bot.Telegram.Me), days), &tb.ReplyMarkup{})
+}
+
+// creditPendingClaims pays all pending claims of the username of a user who started the bot
+func (bot *TipBot) creditPendingClaims(user *lnbits.User) {
+	if len(user.Telegram.Username) == 0 {
+		return
+	}
+	for _, c := range bot.getPendingClaims(user.Telegram.Username) {
+		tx := &PendingClaim{Base: transaction.New(transaction.ID(c.ID))}
+		sn, err := tx.Get(tx, bot.Bunt)
+		if err != nil {
+			log.Errorf("[creditPendingClaims] %s", err)
+			continue
+		}
+		claim := sn.(*PendingClaim)
+		if claim.Lock(claim, bot.Bunt) != nil {
+			continue
+		}
+		from, err := bot.loadUser(claim.From)
+		if err != nil {
+			log.Errorf("[creditPendingClaims] %s", err)
+		} else if claim.Active && bot.payPendingClaim(claim, from, user, "pending claim payout") {
+			fromUserStrMd := GetUserStrMd(from.Telegram)
+			log.Infof("[send] %s claimed %d sat from %s", GetUserStr(user.Telegram), claim.Amount, GetUserStr(from.Telegram))
+			bot.trySendMessage(user.Telegram, fmt.Sprintf(i18n.Translate(user.Telegram.LanguageCode, "sendReceivedMessage"), fromUserStrMd, claim.Amount))
+			if len(claim.Memo) > 0 {
+				bot.trySendMessage(user.Telegram, fmt.Sprintf("✉️ %s", str.MarkdownEscape(claim.Memo)))
+			}
+			bot.trySendMessage(from.Telegram, fmt.Sprintf(i18n.Translate(from.Telegram.LanguageCode, "pendingClaimClaimedMessage"), GetUserStrMd(user.Telegram), claim.Amount))
+		}
+		runtime.IgnoreError(claim.Release(claim, bot.Bunt))
+	}
+}
+
+// payPendingClaim pays out the escrow of a locked claim. The claim is inactivated before
+// the payment so that it can never be paid twice, and reactivated if the payment fails.
+func (bot *TipBot) payPendingClaim(claim *PendingClaim, from, to *lnbits.User, transactionType string) bool {
+	escrow, err := bot.GetBotUser()
+	if err != nil {
+		log.Errorf("[send] Could not load bot wallet: %s", err)
+		return false
+	}
+	if claim.Inactivate(claim, bot.Bunt) != nil {
+		return false
+	}
+	t := NewTransaction(bot, escrow, to, claim.Amount, TransactionType(transactionType))
+	t.Memo = fmt.Sprintf("Pending claim from %s to @%s (%d sat).", GetUserStr(from.Telegram), claim.ToUsername, claim.Amount)
+	success, err := t.Send()
+	if !success {
+		log.Errorf("[send] Payout of %s to %s failed: %s", claim.ID, GetUserStr(to.Telegram), err)
+		claim.Active = true
+		return false
+	}
+	return true
+}
+
+// expirePendingClaimJobHandler refunds a claim that was not claimed in time
+func (bot *TipBot) expirePendingClaimJobHandler(job *scheduler.Job) error {
+	var id string
+	if err := job.Decode(&id); err != nil {
+		log.Errorf("[expirePendingClaimJobHandler] %s", err)
+		return nil
+	}
+	tx := &PendingClaim{Base: transaction.New(transaction.ID(id))}
+	sn, err := tx.Get(tx, bot.Bunt)
+	if err != nil {
+		return err
+	}
+	claim := sn.(*PendingClaim)
+	err = claim.Lock(claim, bot.Bunt)
+	if err != nil {
+		return err
+	}
+	defer claim.Release(claim, bot.Bunt)
+	if !claim.Active {
+		// already claimed
+		return nil
+	}
+	from, err := bot.loadUser(claim.From)
+	if err != nil {
+		return err
+	}
+	if !bot.payPendingClaim(claim, from, from, "pending claim refund") {
+		return fmt.Errorf("refund of %s failed", claim.ID)
+	}
+	log.Infof("[send] Pending claim %s of %d sat expired and was refunded to %s", claim.ID, claim.Amount, GetUserStr(from.Telegram))
+	bot.trySendMessage(from.Telegram, fmt.Sprintf(i18n.Translate(from.Telegram.LanguageCode, "pendingClaimRefundedMessage"), claim.Amount, str.MarkdownEscape("@"+claim.ToUsername)))
+	return nil
+}
@@ -0,0 +1,19 @@
+package telegram
+
+import "testing"
+
+func Test_isTelegramUsername(t *testing.T) {
+	for username, want := range map[string]bool{
+		"LightningTipBot": true,
+		"alice_1":         true,
+		"bob":             false,
+		"1alice":          false,
+		"@alice":          false,
+		"alice-bob":       false,
+		"alice*":          false,
+	} {
+		if got := isTelegramUsername(username); got != want {
+			t.Errorf("isTelegramUsername(%q) = %v, want %v", username, got, want)
+		}
+	}
+}
@@ -0,0 +1,359 @@
+package telegram
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/buntdb"
+	"golang.org/x/crypto/pbkdf2"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	pinKeyBase        = "pin-"
+	pinHashIterations = 100000
+	pinMaxAttempts    = 3
+	pinLockout        = time.Hour
+	// pinConfirmationKeyBase stores the payments confirmed with the PIN until they are continued
+	pinConfirmationKeyBase = "pinconfirmed-"
+	pinConfirmationTTL     = 5 * time.Minute
+	// pinAlways needs the PIN at any threshold, for access to the wallet that is not a single payment
+	pinAlways = math.MaxInt32
+)
+
+var (
+	pinRegex = regexp.MustCompile(`^[0-9]{4,8}$`)
+	// errPinRequired rejects a payment that needs the PIN but was not confirmed with it
+	errPinRequired = fmt.Errorf("payment needs the PIN")
+)
+
+// UserPin protects payments of at least Threshold sat with a PIN
+type UserPin struct {
+	UserID         int       `json:"user_id"`
+	Salt           []byte    `json:"salt"`
+	Hash           []byte    `json:"hash"`
+	Threshold      int       `json:"threshold"`
+	FailedAttempts int       `json:"failed_attempts"`
+	LockedUntil    time.Time `json:"locked_until"`
+}
+
+func (p *UserPin) Key() string {
+	return fmt.Sprintf("%s%d", pinKeyBase, p.UserID)
+}
+
+// EnterPinStateData is the state of a user who is asked for a PIN
+type EnterPinStateData struct {
+	// Type is "command" or a button of pinCallbackHandlers to continue a payment, "set" or "new"
+	// to enter a new PIN and "change" or "remove" to manage the PIN
+	Type string `json:"type"`
+	// ID is the data of the button or identifies the command
+	ID      string      `json:"id"`
+	Message *tb.Message `json:"message"`
+	// InlineID is the inline message of the button
+	InlineID  string `json:"inline_id"`
+	Threshold int    `json:"threshold"`
+}
+
+// callback rebuilds the button that was pressed before the PIN was entered
+func (data EnterPinStateData) callback(sender *tb.User) *tb.Callback {
+	c := &tb.Callback{Sender: sender, Message: data.Message, MessageID: data.InlineID, Data: data.ID}
+	if len(data.InlineID) > 0 {
+		c.Message = &tb.Message{InlineID: data.InlineID}
+	}
+	return c
+}
+
+// pinCallbackHandlers continue the payments of buttons after the PIN was entered, by EnterPinStateData.Type.
+// Payments of commands are continued by processing the command again.
+func (bot *TipBot) pinCallbackHandlers() map[string]func(context.Context, *tb.Callback) {
+	return map[string]func(context.Context, *tb.Callback){
+		"pay":       bot.confirmPayHandler,
+		"send":      bot.confirmSendHandler,
+		"batch":     bot.confirmBatchSendHandler,
+		"receive":   bot.acceptInlineReceiveHandler,
+		"tipjar":    bot.acceptInlineTipjarHandler,
+		"goal":      bot.contributeTipjarHandler,
+		"splitbill": bot.acceptSplitbillHandler,
+		"paywall":   bot.unlockPaywallHandler,
+		"joinfee":   bot.payJoinRequestHandler,
+	}
+}
+
+func pinConfirmationKey(user *lnbits.User, id string) string {
+	return fmt.Sprintf("%s%d-%s", pinConfirmationKeyBase, user.Telegram.ID, id)
+}
+
+// confirmPin remembers that the PIN was entered for the payment with the id
+func (bot *TipBot) confirmPin(user *lnbits.User, id string) error {
+	return bot.Bunt.Update(func(tx *buntdb.Tx) error {
+		_, _, err := tx.Set(pinConfirmationKey(user, id), "1", &buntdb.SetOptions{Expires: true, TTL: pinConfirmationTTL})
+		return err
+	})
+}
+
+// consumePinConfirmation checks whether the PIN was entered for the payment with the id, a PIN confirms a single payment
+func (bot *TipBot) consumePinConfirmation(user *lnbits.User, id string) bool {
+	err := bot.Bunt.Update(func(tx *buntdb.Tx) error {
+		_, err := tx.Delete(pinConfirmationKey(user, id))
+		return err
+	})
+	return err == nil
+}
+
+// hashPin derives the hash of a PIN with PBKDF2-HMAC-SHA256
+func hashPin(pin string, salt []byte) []byte {
+	return pbkdf2.Key([]byte(pin), salt, pinHashIterations, sha256.Size, sha256.New)
+}
+
+// setPin stores a new salted hash of the PIN
+func (p *UserPin) setPin(pin string) error {
+	p.Salt = make([]byte, 16)
+	if _, err := rand.Read(p.Salt); err != nil {
+		return err
+	}
+	p.Hash = hashPin(pin, p.Salt)
+	return nil
+}
+
+func (p *UserPin) verify(pin string) bool {
+	return hmac.Equal(hashPin(pin, p.Salt), p.Hash)
+}
+
+func (p *UserPin) locked(now time.Time) bool {
+	return now.Before(p.LockedUntil)
+}
+
+// getUserPin returns the PIN of a user or nil if the user has none
+func (bot *TipBot) getUserPin(user *lnbits.User) *UserPin {
+	pin := &UserPin{UserID: user.Telegram.ID}
+	if err := bot.Bunt.Get(pin); err != nil {
+		return nil
+	}
+	return pin
+}
+
+// PinRequired checks whether a payment needs the PIN of the user. Payments without Telegram can't be confirmed with it.
+func (bot *TipBot) PinRequired(user *lnbits.User, amount int) bool {
+	pin := bot.getUserPin(user)
+	return pin != nil && amount >= pin.Threshold
+}
+
+func (bot *TipBot) deleteUserPin(user *lnbits.User) error {
+	return bot.Bunt.Update(func(tx *buntdb.Tx) error {
+		_, err := tx.Delete((&UserPin{UserID: user.Telegram.ID}).Key())
+		return err
+	})
+}
+
+// askForPin sets the state of the user and asks for the PIN in the private chat
+func (bot *TipBot) askForPin(ctx context.Context, user *lnbits.User, data EnterPinStateData, key string) {
+	stateDataJson, err := json.Marshal(data)
+	if err != nil {
+		log.Errorln(err)
+		return
+	}
+	SetUserState(user, bot, lnbits.UserEnterPin, string(stateDataJson))
+	bot.trySendMessage(user.Telegram, TranslateUser(ctx, key), tb.ForceReply)
+}
+
+// requirePin asks for the PIN before a payment of amount if the user protects it with one.
+// It returns true if the payment has to wait for the PIN. The payment is continued with
+// data after the PIN was entered and must then be sent with TransactionConfirmed.
+func (bot *TipBot) requirePin(ctx context.Context, user *lnbits.User, amount int, data EnterPinStateData) bool {
+	pin := bot.getUserPin(user)
+	if pin == nil || amount < pin.Threshold {
+		return false
+	}
+	if bot.consumePinConfirmation(user, data.ID) {
+		return false
+	}
+	if pin.locked(time.Now()) {
+		bot.trySendMessage(user.Telegram, fmt.Sprintf(TranslateUser(ctx, "pinLockedMessage"), formatUserTime(user, pin.LockedUntil)))
+		return true
+	}
+	bot.askForPin(ctx, user, data, "pinEnterMessage")
+	return true
+}
+
+// requirePinForCallback asks for the PIN before the payment of a button of pinCallbackHandlers
+func (bot *TipBot) requirePinForCallback(ctx context.Context, user *lnbits.User, amount int, paymentType string, c *tb.Callback) bool {
+	return bot.requirePin(ctx, user, amount, EnterPinStateData{Type: paymentType, ID: c.Data, Message: c.Message, InlineID: c.MessageID})
+}
+
+// requirePinForCommand asks for the PIN before the payment of a command, the command is processed again with the PIN
+func (bot *TipBot) requirePinForCommand(ctx context.Context, user *lnbits.User, amount int, m *tb.Message) bool {
+	id := fmt.Sprintf("command-%d-%d", m.Chat.ID, m.ID)
+	return bot.requirePin(ctx, user, amount, EnterPinStateData{Type: "command", ID: id, Message: m})
+}
+
+// enterPinHandler is invoked in anyTextHandler when the user needs to enter a PIN
+func (bot *TipBot) enterPinHandler(ctx context.Context, m *tb.Message) {
+	user := LoadUser(ctx)
+	if user.Wallet == nil || user.StateKey != lnbits.UserEnterPin {
+		return
+	}
+	// any command cancels the PIN entry
+	if strings.HasPrefix(m.Text, "/") {
+		ResetUserState(user, bot)
+		return
+	}
+	// the PIN should not stay in the chat history
+	bot.tryDeleteMessage(m)
+	var data EnterPinStateData
+	err := json.Unmarshal([]byte(user.StateData), &data)
+	if err != nil {
+		log.Errorf("[enterPinHandler] %s", err.Error())
+		ResetUserState(user, bot)
+		return
+	}
+	entered := strings.TrimSpace(m.Text)
+	// only well-formed PINs count as attempts
+	if !pinRegex.MatchString(entered) {
+		bot.askForPin(ctx, user, data, "pinInvalidMessage")
+		return
+	}
+
+	switch data.Type {
+	case "set", "new":
+		pin := &UserPin{UserID: user.Telegram.ID, Threshold: data.Threshold}
+		if err = pin.setPin(entered); err == nil {
+			err = bot.Bunt.Set(pin)
+		}
+		ResetUserState(user, bot)
+		if err != nil {
+			log.Errorf("[/pin] Could not save PIN of %s: %s", GetUserStr(user.Telegram), err)
+			bot.trySendMessage(m.Sender, TranslateUser(ctx, "errorTryLaterMessage"))
+			return
+		}
+		log.Infof("[/pin] %s set a PIN for payments from %d sat", GetUserStr(user.Telegram), pin.Threshold)
+		bot.trySendMessage(m.Sender, fmt.Sprintf(TranslateUser(ctx, "pinSetMessage"), pin.Threshold))
+		return
+	}
+
+	pin := bot.getUserPin(user)
+	if pin == nil {
+		ResetUserState(user, bot)
+		return
+	}
+	if pin.locked(time.Now()) {
+		ResetUserState(user, bot)
+		bot.trySendMessage(m.Sender, fmt.Sprintf(TranslateUser(ctx, "pinLockedMessage"), formatUserTime(user, pin.LockedUntil)))
+		return
+	}
+	if !pin.verify(entered) {
+		pin.FailedAttempts++
+		log.Warnf("[pin] %s entered a wrong PIN (%d attempts)", GetUserStr(user.Telegram), pin.FailedAttempts)
+		if pin.FailedAttempts >= pinMaxAttempts {
+			pin.FailedAttempts = 0
+			pin.LockedUntil = time.Now().Add(pinLockout)
+			runtime.IgnoreError(bot.Bunt.Set(pin))
+			ResetUserState(user, bot)
+			bot.trySendMessage(m.Sender, fmt.Sprintf(TranslateUser(ctx, "pinLockedMessage"), formatUserTime(user, pin.LockedUntil)))
+			return
+		}
+		runtime.IgnoreError(bot.Bunt.Set(pin))
+		bot.askForPin(ctx, user, data, "pinWrongMessage")
+		return
+	}
+	pin.FailedAttempts = 0
+	runtime.IgnoreError(bot.Bunt.Set(pin))
+	ResetUserState(user, bot)
+
+	switch data.Type {
+	case "command":
+		if err = bot.confirmPin(user, data.ID); err != nil {
+			log.Errorf("[pin] Could not confirm payment of %s: %s", GetUserStr(user.Telegram), err)
+			return
+		}
+		bot.Telegram.ProcessUpdate(tb.Update{Message: data.Message})
+	case "change":
+		threshold := pin.Threshold
+		if data.Threshold >= 0 {
+			threshold = data.Threshold
+		}
+		bot.askForPin(ctx, user, EnterPinStateData{Type: "new", Threshold: threshold}, "pinEnterNewMessage")
+	case "remove":
+		if err = bot.deleteUserPin(user); err != nil {
+			log.Errorf("[/pin] Could not remove PIN of %s: %s", GetUserStr(user.Telegram), err)
+			bot.trySendMessage(m.Sender, TranslateUser(ctx, "errorTryLaterMessage"))
+			return
+		}
+		log.Infof("[/pin] %s removed their PIN", GetUserStr(user.Telegram))
+		bot.trySendMessage(m.Sender, TranslateUser(ctx, "pinRemovedMessage"))
+	default:
+		handler, ok := bot.pinCallbackHandlers()[data.Type]
+		if !ok {
+			return
+		}
+		if err = bot.confirmPin(user, data.ID); err != nil {
+			log.Errorf("[pin] Could not confirm payment of %s: %s", GetUserStr(user.Telegram), err)
+			return
+		}
+		handler(ctx, data.callback(m.Sender))
+	}
+}
+
+// pinHandler invoked on "/pin [set|change|remove] [<threshold>]"
+func (bot *TipBot) pinHandler(ctx context.Context, m *tb.Message) {
+	bot.anyTextHandler(ctx, m)
+	user := LoadUser(ctx)
+	if user.Wallet == nil {
+		return
+	}
+	if !m.Private() {
+		NewMessage(m, WithDuration(0, bot))
+	}
+	pin := bot.getUserPin(user)
+	action, err := getArgumentFromCommand(m.Text, 1)
+	if err != nil {
+		if pin == nil {
+			bot.trySendMessage(m.Sender, TranslateUser(ctx, "pinNoneMessage"))
+			return
+		}
+		bot.trySendMessage(m.Sender, fmt.Sprintf(TranslateUser(ctx, "pinStatusMessage"), pin.Threshold))
+		return
+	}
+	// the threshold is optional, payments of any amount need the PIN by default
+	threshold := -1
+	if thresholdStr, err := getArgumentFromCommand(m.Text, 2); err == nil {
+		threshold, err = getAmount(thresholdStr)
+		if err != nil || threshold < 0 {
+			bot.trySendMessage(m.Sender, TranslateUser(ctx, "pinHelpText"))
+			return
+		}
+	}
+	switch strings.ToLower(action) {
+	case "set":
+		if pin != nil {
+			bot.trySendMessage(m.Sender, TranslateUser(ctx, "pinExistsMessage"))
+			return
+		}
+		if threshold < 0 {
+			threshold = 0
+		}
+		bot.askForPin(ctx, user, EnterPinStateData{Type: "set", Threshold: threshold}, "pinEnterNewMessage")
+	case "change", "remove":
+		if pin == nil {
+			bot.trySendMessage(m.Sender, TranslateUser(ctx, "pinNoneMessage"))
+			return
+		}
+		if pin.locked(time.Now()) {
+			bot.trySendMessage(m.Sender, fmt.Sprintf(TranslateUser(ctx, "pinLockedMessage"), formatUserTime(user, pin.LockedUntil)))
+			return
+		}
+		bot.askForPin(ctx, user, EnterPinStateData{Type: strings.ToLower(action), Threshold: threshold}, "pinEnterMessage")
+	default:
+		bot.trySendMessage(m.Sender, TranslateUser(ctx, "pinHelpText"))
+	}
+}
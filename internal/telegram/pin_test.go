@@ -0,0 +1,70 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/storage"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+func TestUserPin_verify(t *testing.T) {
+	pin := &UserPin{UserID: 1}
+	if err := pin.setPin("1234"); err != nil {
+		t.Fatal(err)
+	}
+	if !pin.verify("1234") {
+		t.Errorf("verify() rejected the PIN")
+	}
+	if pin.verify("4321") || pin.verify("") {
+		t.Errorf("verify() accepted a wrong PIN")
+	}
+	// the same PIN is salted differently
+	other := &UserPin{UserID: 2}
+	if err := other.setPin("1234"); err != nil {
+		t.Fatal(err)
+	}
+	if string(other.Hash) == string(pin.Hash) {
+		t.Errorf("two PINs have the same hash")
+	}
+	now := time.Now()
+	pin.LockedUntil = now.Add(pinLockout)
+	if !pin.locked(now) || pin.locked(now.Add(pinLockout)) {
+		t.Errorf("locked() ignores LockedUntil")
+	}
+}
+
+func TestTipBot_PinRequired(t *testing.T) {
+	bot := &TipBot{Bunt: storage.NewBunt(":memory:")}
+	user := &lnbits.User{Telegram: &tb.User{ID: 1}}
+	if bot.PinRequired(user, 1000000) {
+		t.Errorf("PinRequired() without a PIN")
+	}
+	pin := &UserPin{UserID: 1, Threshold: 1000}
+	if err := pin.setPin("1234"); err != nil {
+		t.Fatal(err)
+	}
+	if err := bot.Bunt.Set(pin); err != nil {
+		t.Fatal(err)
+	}
+	for amount, want := range map[int]bool{999: false, 1000: true, 1001: true} {
+		if got := bot.PinRequired(user, amount); got != want {
+			t.Errorf("PinRequired(%d) = %v, want %v", amount, got, want)
+		}
+	}
+}
+
+func TestEnterPinStateData_callback(t *testing.T) {
+	sender := &tb.User{ID: 1}
+	inline := EnterPinStateData{Type: "receive", ID: "inline-receive-1", InlineID: "AgAAA"}
+	c := inline.callback(sender)
+	if c.Data != inline.ID || c.MessageID != inline.InlineID || c.Message == nil || c.Message.InlineID != inline.InlineID {
+		t.Errorf("callback() of an inline message = %+v", c)
+	}
+	message := &tb.Message{ID: 5, Chat: &tb.Chat{ID: 2}}
+	c = EnterPinStateData{Type: "paywall", ID: "paywall-2-5", Message: message}.callback(sender)
+	if c.Message != message || len(c.MessageID) > 0 || c.Sender != sender {
+		t.Errorf("callback() of a message = %+v", c)
+	}
+}
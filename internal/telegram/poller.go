@@ -0,0 +1,88 @@
+package telegram
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// ChatJoinRequest is sent by Telegram when a user asks to join a chat
+// through an invite link that requires approval. telebot.v2 doesn't know
+// this update type, that's why JoinRequestPoller decodes it.
+type ChatJoinRequest struct {
+	Chat *tb.Chat `json:"chat"`
+	From *tb.User `json:"from"`
+	Date int64    `json:"date"`
+	Bio  string   `json:"bio,omitempty"`
+}
+
+type joinRequestUpdate struct {
+	tb.Update
+	ChatJoinRequest *ChatJoinRequest `json:"chat_join_request,omitempty"`
+}
+
+// JoinRequestPoller works like tb.LongPoller but hands chat join requests to
+// Handler instead of dropping them. All other updates are passed on to telebot.
+type JoinRequestPoller struct {
+	*tb.LongPoller
+	Handler func(r *ChatJoinRequest)
+}
+
+func NewJoinRequestPoller(poller *tb.LongPoller, handler func(r *ChatJoinRequest)) *JoinRequestPoller {
+	return &JoinRequestPoller{LongPoller: poller, Handler: handler}
+}
+
+// Poll does long polling.
+func (p *JoinRequestPoller) Poll(b *tb.Bot, dest chan tb.Update, stop chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+		}
+
+		updates, err := p.getUpdates(b)
+		if err != nil {
+			log.Warnf("[JoinRequestPoller] %s", err)
+			time.Sleep(time.Second)
+			continue
+		}
+
+		for _, update := range updates {
+			p.LastUpdateID = update.ID
+			if update.ChatJoinRequest != nil {
+				go p.Handler(update.ChatJoinRequest)
+				continue
+			}
+			dest <- update.Update
+		}
+	}
+}
+
+func (p *JoinRequestPoller) getUpdates(b *tb.Bot) ([]joinRequestUpdate, error) {
+	params := map[string]string{
+		"offset":  strconv.Itoa(p.LastUpdateID + 1),
+		"timeout": strconv.Itoa(int(p.Timeout / time.Second)),
+	}
+	if p.Limit != 0 {
+		params["limit"] = strconv.Itoa(p.Limit)
+	}
+	if len(p.AllowedUpdates) > 0 {
+		data, _ := json.Marshal(p.AllowedUpdates)
+		params["allowed_updates"] = string(data)
+	}
+	data, err := b.Raw("getUpdates", params)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Result []joinRequestUpdate
+	}
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Result, nil
+}
@@ -0,0 +1,111 @@
+package telegram
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// fakeTelegram is a minimal Telegram Bot API that answers getMe and getUpdates
+// and records the parameters of every other request.
+type fakeTelegram struct {
+	mu       sync.Mutex
+	updates  []string
+	requests map[string][]map[string]string
+}
+
+func (f *fakeTelegram) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	method := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	params := map[string]string{}
+	_ = json.NewDecoder(r.Body).Decode(&params)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests[method] = append(f.requests[method], params)
+	switch method {
+	case "getMe":
+		w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"Bot","username":"test_bot"}}`))
+	case "getUpdates":
+		result := "[]"
+		if len(f.updates) > 0 {
+			result, f.updates = f.updates[0], f.updates[1:]
+		}
+		w.Write([]byte(`{"ok":true,"result":` + result + `}`))
+	default:
+		w.Write([]byte(`{"ok":true,"result":true}`))
+	}
+}
+
+func (f *fakeTelegram) params(method string) []map[string]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.requests[method]
+}
+
+func newFakeTelegramBot(t *testing.T, updates ...string) (*tb.Bot, *fakeTelegram) {
+	fake := &fakeTelegram{updates: updates, requests: make(map[string][]map[string]string)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	b, err := tb.NewBot(tb.Settings{URL: server.URL, Token: "token", Synchronous: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b, fake
+}
+
+func TestJoinRequestPoller_Poll(t *testing.T) {
+	b, fake := newFakeTelegramBot(t, `[
+		{"update_id":1,"message":{"message_id":5,"text":"hi","chat":{"id":-100,"type":"supergroup"}}},
+		{"update_id":2,"chat_join_request":{"chat":{"id":-100,"type":"supergroup","title":"Group"},"from":{"id":42,"first_name":"Alice"},"date":1}}
+	]`)
+	requests := make(chan *ChatJoinRequest, 1)
+	poller := NewJoinRequestPoller(&tb.LongPoller{}, func(r *ChatJoinRequest) { requests <- r })
+	updates := make(chan tb.Update, 1)
+	stop := make(chan struct{})
+	go poller.Poll(b, updates, stop)
+	defer close(stop)
+
+	select {
+	case upd := <-updates:
+		if upd.Message == nil || upd.Message.Text != "hi" {
+			t.Errorf("Poll() passed on %+v, want the message", upd)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Poll() did not pass on the message")
+	}
+	select {
+	case r := <-requests:
+		if r.From.ID != 42 || r.Chat.ID != -100 || r.Chat.Title != "Group" {
+			t.Errorf("Poll() handled join request %+v", r)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Poll() did not handle the join request")
+	}
+	// the next poll must confirm both updates
+	for start := time.Now(); time.Since(start) < time.Second; time.Sleep(10 * time.Millisecond) {
+		if calls := fake.params("getUpdates"); len(calls) > 1 {
+			if offset := calls[1]["offset"]; offset != "3" {
+				t.Errorf("getUpdates offset = %s, want 3", offset)
+			}
+			return
+		}
+	}
+	t.Error("Poll() did not poll again")
+}
+
+func TestTipBot_approveChatJoinRequest(t *testing.T) {
+	b, fake := newFakeTelegramBot(t)
+	bot := TipBot{Telegram: b}
+	if err := bot.approveChatJoinRequest(-100, 42); err != nil {
+		t.Fatal(err)
+	}
+	calls := fake.params("approveChatJoinRequest")
+	if len(calls) != 1 || calls[0]["chat_id"] != "-100" || calls[0]["user_id"] != "42" {
+		t.Errorf("approveChatJoinRequest sent %v", calls)
+	}
+}
@@ -0,0 +1,158 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	log "github.com/sirupsen/logrus"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	rainDefaultUsers   = 10
+	rainMaxUsers       = 50
+	rainDefaultMinutes = 60
+)
+
+func helpRainUsage(ctx context.Context, errormsg string) string {
+	if len(errormsg) > 0 {
+		return fmt.Sprintf(Translate(ctx, "rainHelpText"), fmt.Sprintf("%s", errormsg))
+	} else {
+		return fmt.Sprintf(Translate(ctx, "rainHelpText"), "")
+	}
+}
+
+// getRainArguments parses the optional number of users and time window of
+// the command "/rain <amount> [<n>] [<minutes>]"
+func getRainArguments(text string) (nUsers int, window time.Duration, err error) {
+	nUsers = rainDefaultUsers
+	minutes := rainDefaultMinutes
+	if arg, err := getArgumentFromCommand(text, 2); err == nil {
+		nUsers, err = strconv.Atoi(arg)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	if arg, err := getArgumentFromCommand(text, 3); err == nil {
+		minutes, err = strconv.Atoi(arg)
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+	if nUsers < 1 || nUsers > rainMaxUsers {
+		return 0, 0, fmt.Errorf("number of users must be between 1 and %d", rainMaxUsers)
+	}
+	window = time.Duration(minutes) * time.Minute
+	if minutes < 1 || window > maxActivityAge {
+		return 0, 0, fmt.Errorf("time window must be between 1 and %d minutes", int(maxActivityAge.Minutes()))
+	}
+	return nUsers, window, nil
+}
+
+// rainHandler invoked on "/rain <amount> [<n>] [<minutes>]" command.
+// It splits the amount among the last n users that were active in the chat.
+func (bot *TipBot) rainHandler(ctx context.Context, m *tb.Message) {
+	// delete the rain message after a few seconds, this is default behaviour
+	defer NewMessage(m, WithDuration(time.Second*time.Duration(internal.Configuration.Telegram.MessageDisposeDuration), bot))
+	bot.anyTextHandler(ctx, m)
+	from := LoadUser(ctx)
+	if from.Wallet == nil {
+		return
+	}
+	if m.Private() {
+		bot.trySendMessage(m.Sender, helpRainUsage(ctx, Translate(ctx, "rainHelpRainInGroup")))
+		return
+	}
+	amount, err := decodeAmountFromCommand(m.Text)
+	if err != nil || amount < 1 {
+		bot.trySendMessage(m.Sender, helpRainUsage(ctx, Translate(ctx, "rainValidAmountMessage")))
+		return
+	}
+	nUsers, window, err := getRainArguments(m.Text)
+	if err != nil {
+		log.Warnf("[/rain] %s", err)
+		bot.trySendMessage(m.Sender, helpRainUsage(ctx, fmt.Sprintf(Translate(ctx, "rainInvalidArgumentsMessage"), rainMaxUsers, int(maxActivityAge.Minutes()))))
+		return
+	}
+
+	// large rains wait for the PIN
+	if bot.requirePinForCommand(ctx, from, amount, m) {
+		return
+	}
+	recipients := bot.Activity.Recent(m.Chat.ID, nUsers, window, m.Sender.ID, bot.Telegram.Me.ID)
+	if len(recipients) == 0 {
+		bot.trySendMessage(m.Sender, Translate(ctx, "rainNoActiveUsersMessage"))
+		return
+	}
+	perUserAmount := amount / len(recipients)
+	if perUserAmount < 1 {
+		bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "rainAmountTooSmallMessage"), len(recipients)))
+		return
+	}
+
+	fromUserStr := GetUserStr(from.Telegram)
+	balance, err := bot.GetUserBalance(from)
+	if err != nil {
+		log.Errorf("[/rain] Error fetching %s's balance: %s", fromUserStr, err)
+		bot.trySendMessage(m.Sender, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	if balance < perUserAmount*len(recipients) {
+		bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "insufficientFundsMessage"), balance, perUserAmount*len(recipients)))
+		return
+	}
+
+	// pay every recipient, the payouts are summarized in a single message
+	paid := make([]*lnbits.User, 0, len(recipients))
+	userNeedsWallet := false
+	for _, recipient := range recipients {
+		toUserStr := GetUserStr(recipient)
+		to, exists := bot.UserExists(recipient)
+		if !exists {
+			log.Infof("[/rain] User %s has no wallet.", toUserStr)
+			to, err = bot.CreateWalletForTelegramUser(recipient)
+			if err != nil {
+				log.Errorf("[/rain] Error: Could not create wallet for %s", toUserStr)
+				continue
+			}
+		}
+		t := NewTransaction(bot, from, to, perUserAmount, TransactionType("rain"), TransactionChat(m.Chat), TransactionConfirmed())
+		t.Memo = fmt.Sprintf("Rain from %s to %s (%d sat).", fromUserStr, toUserStr, perUserAmount)
+		success, err := t.Send()
+		if !success {
+			log.Warnf("[/rain] Transaction from %s to %s failed: %s", fromUserStr, toUserStr, err)
+			continue
+		}
+		if !to.Initialized {
+			userNeedsWallet = true
+		}
+		paid = append(paid, to)
+	}
+	if len(paid) == 0 {
+		bot.trySendMessage(m.Sender, Translate(ctx, "rainErrorMessage"))
+		return
+	}
+	log.Infof("[/rain] %s rained %d sat on %d users in %s (%d).", fromUserStr, perUserAmount*len(paid), len(paid), m.Chat.Title, m.Chat.ID)
+
+	paidUserStrs := make([]string, len(paid))
+	for i, u := range paid {
+		paidUserStrs[i] = GetUserStrMd(u.Telegram)
+	}
+	rainMessage := fmt.Sprintf(
+		Translate(ctx, "rainMessage"),
+		GetUserStrMd(from.Telegram),
+		perUserAmount*len(paid),
+		len(paid),
+		perUserAmount,
+		strings.Join(paidUserStrs, ", "),
+	)
+	if userNeedsWallet {
+		rainMessage += "\n\n" + fmt.Sprintf(Translate(ctx, "rainCreateWalletMessage"), GetUserStrMd(bot.Telegram.Me))
+	}
+	bot.trySendMessage(m.Chat, rainMessage, tb.Silent)
+}
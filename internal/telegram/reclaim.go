@@ -0,0 +1,151 @@
+package telegram
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal"
+	"github.com/LightningTipBot/LightningTipBot/internal/i18n"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
+	"github.com/LightningTipBot/LightningTipBot/internal/scheduler"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/buntdb"
+	"github.com/tidwall/gjson"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	reclaimJob         = "reclaim-uninitialized"
+	reclaimInterval    = 24 * time.Hour
+	reclaimTransaction = "reclaim"
+)
+
+// reclaimShare is the part of a reclaimed wallet that is returned to one tipper
+type reclaimShare struct {
+	FromId int
+	Amount int
+}
+
+// reclaimJobHandler returns the funds of wallets that were created for tip recipients
+// who never started the bot. Only funds received more than ReclaimDays ago are returned.
+func (bot *TipBot) reclaimJobHandler(job *scheduler.Job) error {
+	days := internal.Configuration.Bot.ReclaimDays
+	if days < 1 {
+		return nil
+	}
+	cutoff := time.Now().AddDate(0, 0, -days)
+	var users []*lnbits.User
+	tx := bot.Database.Where("initialized = ? AND created_at < ?", false, cutoff).Find(&users)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	botUser, err := bot.GetBotUser()
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
+		if user.Wallet == nil || user.Telegram == nil {
+			continue
+		}
+		bot.reclaimWallet(user, botUser.Telegram.ID, cutoff)
+	}
+	return nil
+}
+
+// reclaimWallet returns the funds of an uninitialized wallet to the original senders pro rata
+func (bot *TipBot) reclaimWallet(user *lnbits.User, botId int, cutoff time.Time) {
+	userStr := GetUserStr(user.Telegram)
+	balance, err := bot.GetUserBalance(user)
+	if err != nil || balance < 1 {
+		return
+	}
+	// funds that were received before the last reclaim were already returned
+	var lastReclaim Transaction
+	since := time.Time{}
+	if bot.logger.Where("from_id = ? AND type = ? AND success = ?", user.Telegram.ID, reclaimTransaction, true).Order("time desc").First(&lastReclaim).Error == nil {
+		since = lastReclaim.Time
+	}
+	var received []reclaimShare
+	tx := bot.logger.Model(&Transaction{}).
+		Select("from_id, sum(amount) as amount").
+		Where("to_id = ? AND success = ? AND time > ? AND time < ? AND from_id NOT IN ?", user.Telegram.ID, true, since, cutoff, []int{botId, user.Telegram.ID}).
+		Group("from_id").Order("from_id").Scan(&received)
+	if tx.Error != nil {
+		log.Errorf("[reclaim] Could not load the transactions of %s: %s", userStr, tx.Error)
+		return
+	}
+	shares := getReclaimShares(received, balance)
+	if len(shares) == 0 {
+		return
+	}
+	returned := 0
+	for _, share := range shares {
+		tipper, err := GetLnbitsUser(&tb.User{ID: share.FromId}, *bot)
+		if err != nil || tipper.Wallet == nil {
+			continue
+		}
+		t := NewTransaction(bot, user, tipper, share.Amount, TransactionType(reclaimTransaction), TransactionWithoutLimits())
+		t.Memo = fmt.Sprintf("Unclaimed tips of %s returned to %s (%d sat).", userStr, GetUserStr(tipper.Telegram), share.Amount)
+		success, err := t.Send()
+		if !success {
+			log.Errorf("[reclaim] Could not return %d sat of %s to %s: %s", share.Amount, userStr, GetUserStr(tipper.Telegram), err)
+			continue
+		}
+		returned += share.Amount
+		bot.trySendMessage(tipper.Telegram, fmt.Sprintf(i18n.Translate(tipper.Telegram.LanguageCode, "reclaimReturnedMessage"), share.Amount, GetUserStrMd(user.Telegram), internal.Configuration.Bot.ReclaimDays))
+	}
+	if returned > 0 {
+		log.Infof("[reclaim] Returned %d sat of uninitialized wallet %s to %d tippers", returned, userStr, len(shares))
+		tipTooltipReclaimedHandler(user.Telegram, bot)
+	}
+}
+
+// getReclaimShares splits the balance among the senders in proportion to the amounts they sent.
+// Funds that were spent already are deducted proportionally.
+func getReclaimShares(received []reclaimShare, balance int) []reclaimShare {
+	total := 0
+	for _, r := range received {
+		total += r.Amount
+	}
+	if total < 1 {
+		return nil
+	}
+	payable := total
+	if balance < payable {
+		payable = balance
+	}
+	shares := make([]reclaimShare, 0, len(received))
+	for _, r := range received {
+		amount := r.Amount * payable / total
+		if amount > 0 {
+			shares = append(shares, reclaimShare{FromId: r.FromId, Amount: amount})
+		}
+	}
+	return shares
+}
+
+// tipTooltipReclaimedHandler updates the tooltips of a user whose tips were returned
+func tipTooltipReclaimedHandler(user *tb.User, bot *TipBot) {
+	tooltips := make([]*TipTooltip, 0)
+	runtime.IgnoreError(bot.Bunt.View(func(tx *buntdb.Tx) error {
+		return tx.Ascend(MessageOrderedByReplyToFrom, func(key, value string) bool {
+			if gjson.Get(value, MessageOrderedByReplyToFrom).String() == strconv.Itoa(user.ID) {
+				ttt := &TipTooltip{}
+				if err := json.Unmarshal([]byte(value), ttt); err == nil && !ttt.Reclaimed {
+					tooltips = append(tooltips, ttt)
+				}
+			}
+			return true
+		})
+	}))
+	for _, ttt := range tooltips {
+		ttt.Reclaimed = true
+		if err := ttt.editTooltip(bot, true); err != nil {
+			log.Errorf("[tipTooltipReclaimedHandler] could not edit tooltip: %s", err.Error())
+		}
+		runtime.IgnoreError(bot.Bunt.Set(ttt))
+	}
+}
@@ -0,0 +1,30 @@
+package telegram
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_getReclaimShares(t *testing.T) {
+	received := []reclaimShare{{FromId: 1, Amount: 300}, {FromId: 2, Amount: 100}}
+	tests := []struct {
+		name    string
+		balance int
+		want    []reclaimShare
+	}{
+		{"full balance", 400, []reclaimShare{{FromId: 1, Amount: 300}, {FromId: 2, Amount: 100}}},
+		{"more than received", 1000, []reclaimShare{{FromId: 1, Amount: 300}, {FromId: 2, Amount: 100}}},
+		{"partly spent", 200, []reclaimShare{{FromId: 1, Amount: 150}, {FromId: 2, Amount: 50}}},
+		{"rounded down", 3, []reclaimShare{{FromId: 1, Amount: 2}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := getReclaimShares(received, tt.balance); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("getReclaimShares() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	if got := getReclaimShares(nil, 100); got != nil {
+		t.Errorf("getReclaimShares() = %v without transactions", got)
+	}
+}
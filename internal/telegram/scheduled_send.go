@@ -0,0 +1,244 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/i18n"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
+	"github.com/LightningTipBot/LightningTipBot/internal/scheduler"
+	"github.com/LightningTipBot/LightningTipBot/internal/storage/transaction"
+	"github.com/LightningTipBot/LightningTipBot/internal/str"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/buntdb"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	// executeScheduledSendsInterval is how often due scheduled sends are executed
+	executeScheduledSendsInterval = time.Minute
+	executeScheduledSendsJob      = "execute-scheduled-sends"
+	scheduledSendKeyBase          = "scheduled-send-"
+)
+
+var (
+	scheduledSendsMenu     = &tb.ReplyMarkup{ResizeReplyKeyboard: false}
+	btnCancelScheduledSend = scheduledSendsMenu.Data("🚫", "cancel_scheduled_send")
+)
+
+// getScheduleFromCommand parses a trailing "at 2026-12-24 18:00" or "in 3h" of a /send command.
+// Dates are in the time zone loc. It returns the zero time if the command is not scheduled
+// and the command without the schedule.
+func getScheduleFromCommand(command string, loc *time.Location, now time.Time) (time.Time, string, error) {
+	arguments := strings.Split(command, " ")
+	n := len(arguments)
+	// the schedule follows at least "/send <amount> <user>"
+	if n >= 6 && strings.ToLower(arguments[n-3]) == "at" {
+		at, err := time.ParseInLocation(userTimeFormat, arguments[n-2]+" "+arguments[n-1], loc)
+		if err == nil {
+			if !at.After(now) {
+				return time.Time{}, command, fmt.Errorf("scheduled time %s is in the past", at)
+			}
+			return at, strings.Join(arguments[:n-3], " "), nil
+		}
+	}
+	if n >= 5 && strings.ToLower(arguments[n-2]) == "in" {
+		duration, err := getDuration(arguments[n-1])
+		if err == nil {
+			if duration <= 0 {
+				return time.Time{}, command, fmt.Errorf("duration %s is not positive", duration)
+			}
+			return now.Add(duration), strings.Join(arguments[:n-2], " "), nil
+		}
+	}
+	// not a schedule, "at" and "in" might be part of the memo
+	return time.Time{}, command, nil
+}
+
+// scheduleSend stores a confirmed scheduled send for the job runner
+func (bot *TipBot) scheduleSend(ctx context.Context, c *tb.Callback, sendData *SendData) {
+	from := LoadUser(ctx)
+	id := fmt.Sprintf("%s%d-%d-%s", scheduledSendKeyBase, from.Telegram.ID, sendData.Amount, RandStringRunes(5))
+	scheduledSend := *sendData
+	scheduledSend.Base = transaction.New(transaction.ID(id))
+	scheduledSend.From = from.Ref()
+	runtime.IgnoreError(scheduledSend.Set(scheduledSend, bot.Bunt))
+	// the confirmation is done
+	sendData.Active = false
+
+	log.Infof("[send] %s scheduled %d sat to @%s at %s", GetUserStr(from.Telegram), sendData.Amount, sendData.ToTelegramUser, sendData.ScheduledAt)
+	scheduledMessage := fmt.Sprintf(i18n.Translate(sendData.LanguageCode, "sendScheduledMessage"), sendData.Amount, str.MarkdownEscape("@"+sendData.ToTelegramUser), formatUserTime(from, sendData.ScheduledAt))
+	if c.Message.Private() {
+		bot.tryEditMessage(c.Message, scheduledMessage, &tb.ReplyMarkup{})
+		return
+	}
+	// only the sender needs to know when the payment will be made
+	bot.tryDeleteMessage(c.Message)
+	bot.trySendMessage(c.Sender, scheduledMessage)
+}
+
+// getScheduledSends returns the pending scheduled sends of a user, or of all users if
+// the user is nil, in the order they are due.
+func (bot *TipBot) getScheduledSends(user *lnbits.User) []*SendData {
+	pattern := scheduledSendKeyBase + "*"
+	if user != nil {
+		pattern = fmt.Sprintf("%s%d-*", scheduledSendKeyBase, user.Telegram.ID)
+	}
+	scheduledSends := make([]*SendData, 0)
+	runtime.IgnoreError(bot.Bunt.View(func(tx *buntdb.Tx) error {
+		return tx.AscendKeys(pattern, func(key, value string) bool {
+			sendData := &SendData{}
+			if json.Unmarshal([]byte(value), sendData) != nil || sendData.Base == nil {
+				return true
+			}
+			if sendData.Active {
+				scheduledSends = append(scheduledSends, sendData)
+			}
+			return true
+		})
+	}))
+	sort.Slice(scheduledSends, func(i, j int) bool {
+		return scheduledSends[i].ScheduledAt.Before(scheduledSends[j].ScheduledAt)
+	})
+	return scheduledSends
+}
+
+// scheduledHandler invoked on "/scheduled" lists the pending scheduled sends of the user
+func (bot *TipBot) scheduledHandler(ctx context.Context, m *tb.Message) {
+	bot.anyTextHandler(ctx, m)
+	user := LoadUser(ctx)
+	if user.Wallet == nil {
+		return
+	}
+	if !m.Private() {
+		NewMessage(m, WithDuration(0, bot))
+	}
+	message, keyboard := bot.makeScheduledSendsMessage(ctx, user)
+	bot.trySendMessage(m.Sender, message, keyboard)
+}
+
+func (bot *TipBot) makeScheduledSendsMessage(ctx context.Context, user *lnbits.User) (string, *tb.ReplyMarkup) {
+	scheduledSends := bot.getScheduledSends(user)
+	if len(scheduledSends) == 0 {
+		return TranslateUser(ctx, "scheduledSendsEmptyMessage"), &tb.ReplyMarkup{}
+	}
+	lines := make([]string, len(scheduledSends))
+	rows := make([]tb.Row, len(scheduledSends))
+	for i, s := range scheduledSends {
+		lines[i] = fmt.Sprintf(TranslateUser(ctx, "scheduledSendsEntryMessage"), i+1, formatUserTime(user, s.ScheduledAt), s.Amount, str.MarkdownEscape("@"+s.ToTelegramUser))
+		if len(s.Memo) > 0 {
+			lines[i] += fmt.Sprintf(" ✉️ %s", str.MarkdownEscape(s.Memo))
+		}
+		cancelButton := scheduledSendsMenu.Data(fmt.Sprintf(TranslateUser(ctx, "scheduledSendsCancelButtonMessage"), i+1), "cancel_scheduled_send", s.ID)
+		rows[i] = scheduledSendsMenu.Row(cancelButton)
+	}
+	scheduledSendsMenu.Inline(rows...)
+	return fmt.Sprintf(TranslateUser(ctx, "scheduledSendsMessage"), userLocation(user).String(), strings.Join(lines, "\n")), scheduledSendsMenu
+}
+
+// cancelScheduledSendHandler invoked when the sender cancels a pending scheduled send
+func (bot *TipBot) cancelScheduledSendHandler(ctx context.Context, c *tb.Callback) {
+	user := LoadUser(ctx)
+	if user.Wallet == nil {
+		return
+	}
+	tx := &SendData{Base: transaction.New(transaction.ID(c.Data))}
+	sn, err := tx.Get(tx, bot.Bunt)
+	if err != nil {
+		log.Errorf("[cancelScheduledSendHandler] %s", err)
+		return
+	}
+	sendData := sn.(*SendData)
+	if sendData.From.TelegramID != c.Sender.ID {
+		return
+	}
+	err = sendData.Lock(sendData, bot.Bunt)
+	if err != nil {
+		log.Errorf("[cancelScheduledSendHandler] %s", err)
+		return
+	}
+	if sendData.Active {
+		sendData.Active = false
+		log.Infof("[send] %s cancelled the scheduled send of %d sat to @%s", GetUserStr(c.Sender), sendData.Amount, sendData.ToTelegramUser)
+		bot.trySendMessage(c.Sender, fmt.Sprintf(TranslateUser(ctx, "scheduledSendCancelledMessage"), sendData.Amount, str.MarkdownEscape("@"+sendData.ToTelegramUser)))
+	}
+	// release before the list is loaded again
+	runtime.IgnoreError(sendData.Release(sendData, bot.Bunt))
+	message, keyboard := bot.makeScheduledSendsMessage(ctx, user)
+	bot.tryEditMessage(c.Message, message, keyboard)
+}
+
+// executeScheduledSendsJobHandler executes all due scheduled sends
+func (bot *TipBot) executeScheduledSendsJobHandler(job *scheduler.Job) error {
+	bot.executeScheduledSends(time.Now())
+	return nil
+}
+
+func (bot *TipBot) executeScheduledSends(now time.Time) {
+	for _, s := range bot.getScheduledSends(nil) {
+		if s.ScheduledAt.After(now) {
+			// sorted by due date
+			return
+		}
+		// a locked send is being cancelled or executed
+		if !s.InTransaction {
+			bot.executeScheduledSend(s.ID)
+		}
+	}
+}
+
+func (bot *TipBot) executeScheduledSend(id string) {
+	tx := &SendData{Base: transaction.New(transaction.ID(id))}
+	sn, err := tx.Get(tx, bot.Bunt)
+	if err != nil {
+		log.Errorf("[executeScheduledSend] %s", err)
+		return
+	}
+	sendData := sn.(*SendData)
+	err = sendData.Lock(sendData, bot.Bunt)
+	if err != nil {
+		log.Errorf("[executeScheduledSend] %s", err)
+		return
+	}
+	defer sendData.Release(sendData, bot.Bunt)
+	if !sendData.Active {
+		return
+	}
+	// inactivate before paying so that a send is never executed twice, not even after a crash
+	err = sendData.Inactivate(sendData, bot.Bunt)
+	if err != nil {
+		log.Errorf("[executeScheduledSend] %s", err)
+		return
+	}
+
+	from, err := bot.loadUser(sendData.From)
+	if err != nil {
+		return
+	}
+	to, err := GetLnbitsUser(&tb.User{ID: sendData.ToTelegramId, Username: sendData.ToTelegramUser}, *bot)
+	if err != nil || to.Wallet == nil {
+		bot.trySendMessage(from.Telegram, fmt.Sprintf(i18n.Translate(from.Telegram.LanguageCode, "scheduledSendFailedMessage"), sendData.Amount, str.MarkdownEscape("@"+sendData.ToTelegramUser)))
+		return
+	}
+	fromUserStr := GetUserStr(from.Telegram)
+	toUserStr := GetUserStr(to.Telegram)
+	t := NewTransaction(bot, from, to, int(sendData.Amount), TransactionType("scheduled send"), TransactionConfirmed())
+	t.Memo = fmt.Sprintf("Scheduled send from %s to %s (%d sat).", fromUserStr, toUserStr, sendData.Amount)
+	success, err := t.Send()
+	if !success {
+		log.Warnf("[send] Scheduled send from %s to %s failed: %s", fromUserStr, toUserStr, err)
+		bot.trySendMessage(from.Telegram, fmt.Sprintf(i18n.Translate(from.Telegram.LanguageCode, "scheduledSendFailedMessage"), sendData.Amount, GetUserStrMd(to.Telegram)))
+		return
+	}
+	log.Infof("[send] Scheduled transaction sent from %s to %s (%d sat).", fromUserStr, toUserStr, sendData.Amount)
+	bot.trySendMessage(to.Telegram, fmt.Sprintf(i18n.Translate(to.Telegram.LanguageCode, "sendReceivedMessage"), GetUserStrMd(from.Telegram), sendData.Amount))
+	bot.trySendMessage(from.Telegram, fmt.Sprintf(i18n.Translate(from.Telegram.LanguageCode, "sendSentMessage"), sendData.Amount, GetUserStrMd(to.Telegram)))
+	if len(sendData.Memo) > 0 {
+		bot.trySendMessage(to.Telegram, fmt.Sprintf("✉️ %s", str.MarkdownEscape(sendData.Memo)))
+	}
+}
@@ -0,0 +1,44 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_getScheduleFromCommand(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name        string
+		command     string
+		loc         *time.Location
+		wantAt      time.Time
+		wantCommand string
+		wantErr     bool
+	}{
+		{"in", "/send 1000 @bob in 3h", time.UTC, now.Add(3 * time.Hour), "/send 1000 @bob", false},
+		{"in days", "/send 1000 @bob rent in 2d", time.UTC, now.Add(48 * time.Hour), "/send 1000 @bob rent", false},
+		{"at", "/send 1000 @bob at 2026-12-24 18:00", time.UTC, time.Date(2026, 12, 24, 18, 0, 0, 0, time.UTC), "/send 1000 @bob", false},
+		{"at in time zone", "/send 1000 @bob Merry Christmas at 2026-12-24 18:00", berlin, time.Date(2026, 12, 24, 17, 0, 0, 0, time.UTC), "/send 1000 @bob Merry Christmas", false},
+		{"at in the past", "/send 1000 @bob at 2026-01-01 00:00", time.UTC, time.Time{}, "/send 1000 @bob at 2026-01-01 00:00", true},
+		{"memo", "/send 1000 @bob see you in Berlin", time.UTC, time.Time{}, "/send 1000 @bob see you in Berlin", false},
+		{"not scheduled", "/send 1000 @bob", time.UTC, time.Time{}, "/send 1000 @bob", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			at, command, err := getScheduleFromCommand(tt.command, tt.loc, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getScheduleFromCommand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !at.Equal(tt.wantAt) {
+				t.Errorf("getScheduleFromCommand() at = %s, want %s", at, tt.wantAt)
+			}
+			if command != tt.wantCommand {
+				t.Errorf("getScheduleFromCommand() command = %q, want %q", command, tt.wantCommand)
+			}
+		})
+	}
+}
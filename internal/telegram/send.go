@@ -5,7 +5,9 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
+	"github.com/LightningTipBot/LightningTipBot/internal"
 	"github.com/LightningTipBot/LightningTipBot/internal/i18n"
 	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
 	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
@@ -40,13 +42,14 @@ func (bot *TipBot) SendCheckSyntax(ctx context.Context, m *tb.Message) (bool, st
 
 type SendData struct {
 	*transaction.Base
-	From           *lnbits.User `json:"from"`
-	ToTelegramId   int          `json:"to_telegram_id"`
-	ToTelegramUser string       `json:"to_telegram_user"`
-	Memo           string       `json:"memo"`
-	Message        string       `json:"message"`
-	Amount         int64        `json:"amount"`
-	LanguageCode   string       `json:"languagecode"`
+	From           lnbits.UserRef `json:"from"`
+	ToTelegramId   int            `json:"to_telegram_id"`
+	ToTelegramUser string         `json:"to_telegram_user"`
+	Memo           string         `json:"memo"`
+	Message        string         `json:"message"`
+	Amount         int64          `json:"amount"`
+	LanguageCode   string         `json:"languagecode"`
+	ScheduledAt    time.Time      `json:"scheduled_at"`
 }
 
 // sendHandler invoked on "/send 123 @user" command
@@ -74,6 +77,16 @@ func (bot *TipBot) sendHandler(ctx context.Context, m *tb.Message) {
 		return
 	}
 
+	// scheduled send: /send 100 @user [<memo>] <at 2026-12-24 18:00|in 3h>
+	scheduledAt, command, err := getScheduleFromCommand(m.Text, userLocation(user), time.Now())
+	if err != nil {
+		NewMessage(m, WithDuration(0, bot))
+		bot.trySendMessage(m.Sender, helpSendUsage(ctx, Translate(ctx, "sendScheduleInPastMessage")))
+		return
+	}
+	scheduled := !scheduledAt.IsZero()
+	m.Text = command
+
 	// get send amount, returns 0 if no amount is given
 	amount, err := decodeAmountFromCommand(m.Text)
 	// info: /send 10 <user> DEMANDS an amount, while /send <ln@address.com> also works without
@@ -88,6 +101,11 @@ func (bot *TipBot) sendHandler(ctx context.Context, m *tb.Message) {
 	}
 	if err == nil {
 		if lightning.IsLightningAddress(arg) {
+			if scheduled {
+				NewMessage(m, WithDuration(0, bot))
+				bot.trySendMessage(m.Sender, helpSendUsage(ctx, Translate(ctx, "sendScheduleOnlyUsersMessage")))
+				return
+			}
 			// lightning address, send to that address
 			err = bot.sendToLightningAddress(ctx, m, arg, amount)
 			if err != nil {
@@ -101,7 +119,7 @@ func (bot *TipBot) sendHandler(ctx context.Context, m *tb.Message) {
 	// todo: this error might have been overwritten by the functions above
 	// we should only check for a valid amount here, instead of error and amount
 	amount, err = decodeAmountFromCommand(m.Text)
-	if (err != nil || amount < 1) && m.Chat.Type == tb.ChatPrivate {
+	if (err != nil || amount < 1) && m.Chat.Type == tb.ChatPrivate && !scheduled {
 		bot.askForAmount(ctx, "", "CreateSendState", 0, 0, m.Text)
 		return
 	}
@@ -116,6 +134,17 @@ func (bot *TipBot) sendHandler(ctx context.Context, m *tb.Message) {
 		return
 	}
 
+	// send to several users at once: /send 100 @alice @bob [<memo>]
+	if usernames, _ := getUsernamesFromCommand(m.Text); len(usernames) > 1 {
+		if scheduled {
+			NewMessage(m, WithDuration(0, bot))
+			bot.trySendMessage(m.Sender, helpSendUsage(ctx, Translate(ctx, "sendScheduleOnlyUsersMessage")))
+			return
+		}
+		bot.batchSendHandler(ctx, m, "send")
+		return
+	}
+
 	// SEND COMMAND IS VALID
 	// check for memo in command
 	sendMemo := GetMemoFromCommand(m.Text, 3)
@@ -137,34 +166,45 @@ func (bot *TipBot) sendHandler(ctx context.Context, m *tb.Message) {
 		toUserStrWithoutAt = strings.TrimPrefix(toUserStrWithoutAt, "@")
 	}
 
-	err = bot.parseCmdDonHandler(ctx, m)
-	if err == nil {
-		return
+	if !scheduled {
+		err = bot.parseCmdDonHandler(ctx, m)
+		if err == nil {
+			return
+		}
 	}
 
+	// users who have not started the bot yet receive a pending claim
+	toTelegramId := 0
+	confirmText := fmt.Sprintf(Translate(ctx, "confirmPendingClaimMessage"), str.MarkdownEscape(toUserStrMention), amount, internal.Configuration.Bot.PendingClaimDays)
 	toUserDb, err := GetUserByTelegramUsername(toUserStrWithoutAt, *bot)
-	if err != nil {
+	if err == nil {
+		toTelegramId = toUserDb.Telegram.ID
+		confirmText = fmt.Sprintf(Translate(ctx, "confirmSendMessage"), str.MarkdownEscape(toUserStrMention), amount)
+	} else if scheduled || !isTelegramUsername(toUserStrWithoutAt) {
 		NewMessage(m, WithDuration(0, bot))
 		bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "sendUserHasNoWalletMessage"), toUserStrMention))
 		return
 	}
 
 	// entire text of the inline object
-	confirmText := fmt.Sprintf(Translate(ctx, "confirmSendMessage"), str.MarkdownEscape(toUserStrMention), amount)
 	if len(sendMemo) > 0 {
 		confirmText = confirmText + fmt.Sprintf(Translate(ctx, "confirmSendAppendMemo"), str.MarkdownEscape(sendMemo))
 	}
+	if scheduled {
+		confirmText = confirmText + fmt.Sprintf(Translate(ctx, "confirmSendAppendSchedule"), formatUserTime(user, scheduledAt))
+	}
 	// object that holds all information about the send payment
 	id := fmt.Sprintf("send-%d-%d-%s", m.Sender.ID, amount, RandStringRunes(5))
 	sendData := SendData{
-		From:           user,
+		From:           user.Ref(),
 		Base:           transaction.New(transaction.ID(id)),
 		Amount:         int64(amount),
-		ToTelegramId:   toUserDb.Telegram.ID,
+		ToTelegramId:   toTelegramId,
 		ToTelegramUser: toUserStrWithoutAt,
 		Memo:           sendMemo,
 		Message:        confirmText,
 		LanguageCode:   ctx.Value("publicLanguageCode").(string),
+		ScheduledAt:    scheduledAt,
 	}
 	// save persistent struct
 	runtime.IgnoreError(sendData.Set(sendData, bot.Bunt))
@@ -206,7 +246,7 @@ func (bot *TipBot) confirmSendHandler(ctx context.Context, c *tb.Callback) {
 	}
 	sendData := sn.(*SendData)
 	// onnly the correct user can press
-	if sendData.From.Telegram.ID != c.Sender.ID {
+	if sendData.From.TelegramID != c.Sender.ID {
 		return
 	}
 	// immediatelly set intransaction to block duplicate calls
@@ -229,8 +269,23 @@ func (bot *TipBot) confirmSendHandler(ctx context.Context, c *tb.Callback) {
 	// decode callback data
 	// log.Debug("[send] Callback: %s", c.Data)
 	from := LoadUser(ctx)
+	// large payments wait for the PIN
+	if bot.requirePinForCallback(ctx, from, int(sendData.Amount), "send", c) {
+		return
+	}
 	ResetUserState(from, bot) // we don't need to check the statekey anymore like we did earlier
 
+	if !sendData.ScheduledAt.IsZero() {
+		// the payment is made later by the job runner
+		bot.scheduleSend(ctx, c, sendData)
+		return
+	}
+	if sendData.ToTelegramId == 0 {
+		// the recipient has not started the bot yet
+		bot.createPendingClaim(ctx, c, sendData)
+		return
+	}
+
 	// information about the send
 	toId := sendData.ToTelegramId
 	toUserStrWithoutAt := sendData.ToTelegramUser
@@ -250,7 +305,7 @@ func (bot *TipBot) confirmSendHandler(ctx context.Context, c *tb.Callback) {
 	fromUserStr := GetUserStr(from.Telegram)
 
 	transactionMemo := fmt.Sprintf("Send from %s to %s (%d sat).", fromUserStr, toUserStr, amount)
-	t := NewTransaction(bot, from, to, int(amount), TransactionType("send"))
+	t := NewTransaction(bot, from, to, int(amount), TransactionType("send"), TransactionConfirmed())
 	t.Memo = transactionMemo
 
 	success, err := t.Send()
@@ -297,7 +352,7 @@ func (bot *TipBot) cancelSendHandler(ctx context.Context, c *tb.Callback) {
 	}
 	sendData := sn.(*SendData)
 	// onnly the correct user can press
-	if sendData.From.Telegram.ID != c.Sender.ID {
+	if sendData.From.TelegramID != c.Sender.ID {
 		return
 	}
 	// remove buttons from confirmation message
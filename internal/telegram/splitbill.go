@@ -0,0 +1,365 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/errors"
+	"github.com/LightningTipBot/LightningTipBot/internal/i18n"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
+	"github.com/LightningTipBot/LightningTipBot/internal/storage/transaction"
+	"github.com/LightningTipBot/LightningTipBot/internal/str"
+	log "github.com/sirupsen/logrus"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+var (
+	splitbillMenu          = &tb.ReplyMarkup{ResizeReplyKeyboard: false}
+	btnCancelSplitbill     = splitbillMenu.Data("🚫", "cancel_splitbill")
+	btnRemindSplitbill     = splitbillMenu.Data("🔔", "remind_splitbill")
+	btnAcceptSplitbill     = splitbillMenu.Data("💸 Pay", "confirm_splitbill")
+	splitbillRemindTimeout = 30 * time.Minute
+)
+
+type SplitbillParticipant struct {
+	TelegramId   int    `json:"telegram_id"`
+	TelegramUser string `json:"telegram_user"`
+	Share        int    `json:"share"`
+	Paid         bool   `json:"paid"`
+}
+
+type Splitbill struct {
+	*transaction.Base
+	Message      string                  `json:"splitbill_message"`
+	Amount       int                     `json:"splitbill_amount"`
+	PaidAmount   int                     `json:"splitbill_paidamount"`
+	To           lnbits.UserRef          `json:"splitbill_to"`
+	Participants []*SplitbillParticipant `json:"splitbill_participants"`
+	Memo         string                  `json:"splitbill_memo"`
+	ChatTitle    string                  `json:"splitbill_chattitle"`
+	LastReminder time.Time               `json:"splitbill_lastreminder"`
+	LanguageCode string                  `json:"languagecode"`
+}
+
+type splitbillShare struct {
+	Username string
+	Share    int // 0 if the participant pays an equal share
+}
+
+// getSplitbillShares parses the participants of a command like
+// "/splitbill 1000 @alice @bob:300 @carol [<memo>]" and returns them
+// together with the index of the word at which the memo starts.
+func getSplitbillShares(text string) (shares []splitbillShare, memoStart int, err error) {
+	arguments := strings.Split(text, " ")
+	memoStart = 2
+	if len(arguments) <= memoStart {
+		return nil, memoStart, nil
+	}
+	for _, argument := range arguments[2:] {
+		if !strings.HasPrefix(argument, "@") || len(argument) < 2 {
+			break
+		}
+		memoStart++
+		share := splitbillShare{Username: strings.TrimPrefix(argument, "@")}
+		if i := strings.Index(share.Username, ":"); i > 0 {
+			share.Share, err = getAmount(share.Username[i+1:])
+			if err != nil {
+				return nil, memoStart, err
+			}
+			share.Username = share.Username[:i]
+		}
+		for _, s := range shares {
+			if strings.EqualFold(s.Username, share.Username) {
+				return nil, memoStart, fmt.Errorf("duplicate participant @%s", share.Username)
+			}
+		}
+		shares = append(shares, share)
+	}
+	return shares, memoStart, nil
+}
+
+// splitAmount assigns every participant without a custom share an equal part
+// of what remains of the total. Leftover sats go to the first participants.
+func splitAmount(total int, shares []splitbillShare) ([]int, error) {
+	amounts := make([]int, len(shares))
+	remaining := total
+	nEqual := 0
+	for i, s := range shares {
+		if s.Share > 0 {
+			amounts[i] = s.Share
+			remaining -= s.Share
+		} else {
+			nEqual++
+		}
+	}
+	if remaining < 0 || (nEqual == 0 && remaining != 0) || (nEqual > 0 && remaining < nEqual) {
+		return nil, fmt.Errorf("shares do not add up to %d sat", total)
+	}
+	if nEqual == 0 {
+		return amounts, nil
+	}
+	equalShare := remaining / nEqual
+	leftover := remaining % nEqual
+	for i, s := range shares {
+		if s.Share > 0 {
+			continue
+		}
+		amounts[i] = equalShare
+		if leftover > 0 {
+			amounts[i]++
+			leftover--
+		}
+	}
+	return amounts, nil
+}
+
+func (bot TipBot) createSplitbill(ctx context.Context, m *tb.Message) (*Splitbill, error) {
+	amount, err := decodeAmountFromCommand(m.Text)
+	if err != nil {
+		return nil, errors.New(errors.DecodeAmountError, err)
+	}
+	shares, memoStart, err := getSplitbillShares(m.Text)
+	if err != nil {
+		return nil, errors.New(errors.InvalidSharesError, err)
+	}
+	if len(shares) == 0 {
+		return nil, errors.New(errors.NoParticipantsError, fmt.Errorf("no participants"))
+	}
+	amounts, err := splitAmount(amount, shares)
+	if err != nil {
+		return nil, errors.New(errors.InvalidSharesError, err)
+	}
+	participants := make([]*SplitbillParticipant, len(shares))
+	for i, share := range shares {
+		user, err := GetUserByTelegramUsername(share.Username, bot)
+		if err != nil || user.Telegram.ID == m.Sender.ID {
+			return nil, errors.New(errors.UserNoWalletError, fmt.Errorf("@%s", share.Username))
+		}
+		participants[i] = &SplitbillParticipant{
+			TelegramId:   user.Telegram.ID,
+			TelegramUser: share.Username,
+			Share:        amounts[i],
+		}
+	}
+	id := fmt.Sprintf("splitbill-%d-%d-%s", m.Sender.ID, amount, RandStringRunes(5))
+	splitbill := &Splitbill{
+		Base:         transaction.New(transaction.ID(id)),
+		Amount:       amount,
+		To:           LoadUser(ctx).Ref(),
+		Participants: participants,
+		Memo:         GetMemoFromCommand(m.Text, memoStart),
+		ChatTitle:    m.Chat.Title,
+		LanguageCode: ctx.Value("publicLanguageCode").(string),
+	}
+	splitbill.Message = splitbill.makeMessage(LoadUser(ctx))
+	return splitbill, nil
+}
+
+// makeMessage renders the current state of the bill
+func (splitbill *Splitbill) makeMessage(to *lnbits.User) string {
+	nPaid := 0
+	lines := make([]string, len(splitbill.Participants))
+	for i, p := range splitbill.Participants {
+		status := "⏳"
+		if p.Paid {
+			status = "✅"
+			nPaid++
+		}
+		lines[i] = fmt.Sprintf("%s %s: %d sat", status, str.MarkdownEscape("@"+p.TelegramUser), p.Share)
+	}
+	var message string
+	if nPaid == len(splitbill.Participants) {
+		message = fmt.Sprintf(
+			i18n.Translate(splitbill.LanguageCode, "splitbillEndedMessage"),
+			GetUserStrMd(to.Telegram),
+			splitbill.Amount,
+			strings.Join(lines, "\n"),
+		)
+	} else {
+		message = fmt.Sprintf(
+			i18n.Translate(splitbill.LanguageCode, "splitbillMessage"),
+			GetUserStrMd(to.Telegram),
+			splitbill.Amount,
+			strings.Join(lines, "\n"),
+			splitbill.PaidAmount,
+			splitbill.Amount,
+			nPaid,
+			len(splitbill.Participants),
+			MakeProgressbar(splitbill.PaidAmount, splitbill.Amount),
+		)
+	}
+	if len(splitbill.Memo) > 0 {
+		message = message + fmt.Sprintf(i18n.Translate(splitbill.LanguageCode, "splitbillAppendMemo"), str.MarkdownEscape(splitbill.Memo))
+	}
+	return message
+}
+
+func (bot TipBot) makeSplitbillKeyboard(ctx context.Context, splitbill *Splitbill) *tb.ReplyMarkup {
+	acceptButton := splitbillMenu.Data(Translate(ctx, "payReceiveButtonMessage"), "confirm_splitbill", splitbill.ID)
+	remindButton := splitbillMenu.Data(Translate(ctx, "remindButtonEmoji"), "remind_splitbill", splitbill.ID)
+	cancelButton := splitbillMenu.Data(Translate(ctx, "cancelButtonEmoji"), "cancel_splitbill", splitbill.ID)
+	splitbillMenu.Inline(
+		splitbillMenu.Row(acceptButton, remindButton, cancelButton))
+	return splitbillMenu
+}
+
+// splitbillHandler invoked on "/splitbill <total> @user [@user:<share> ...] [<memo>]"
+func (bot TipBot) splitbillHandler(ctx context.Context, m *tb.Message) {
+	bot.anyTextHandler(ctx, m)
+	if m.Private() {
+		bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "splitbillHelpText"), Translate(ctx, "splitbillHelpInGroup")))
+		return
+	}
+	splitbill, err := bot.createSplitbill(ctx, m)
+	if err != nil {
+		log.Errorf("[splitbill] %s", err)
+		errmsg := ""
+		switch err.(errors.TipBotError).Code {
+		case errors.DecodeAmountError:
+			errmsg = Translate(ctx, "splitbillInvalidAmountMessage")
+		case errors.InvalidSharesError:
+			errmsg = Translate(ctx, "splitbillInvalidSharesMessage")
+		case errors.UserNoWalletError:
+			errmsg = fmt.Sprintf(Translate(ctx, "sendUserHasNoWalletMessage"), str.MarkdownEscape(err.(errors.TipBotError).Message))
+		}
+		bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "splitbillHelpText"), errmsg))
+		bot.tryDeleteMessage(m)
+		return
+	}
+	bot.trySendMessage(m.Chat, splitbill.Message, bot.makeSplitbillKeyboard(ctx, splitbill))
+	log.Infof("[splitbill] %s created splitbill %s: %d sat (%d users)", GetUserStr(m.Sender), splitbill.ID, splitbill.Amount, len(splitbill.Participants))
+	runtime.IgnoreError(splitbill.Set(splitbill, bot.Bunt))
+}
+
+func (bot *TipBot) acceptSplitbillHandler(ctx context.Context, c *tb.Callback) {
+	from := LoadUser(ctx)
+	if from.Wallet == nil {
+		return
+	}
+	tx := &Splitbill{Base: transaction.New(transaction.ID(c.Data))}
+	sn, err := tx.Get(tx, bot.Bunt)
+	if err != nil {
+		log.Errorf("[splitbill] %s", err)
+		return
+	}
+	splitbill := sn.(*Splitbill)
+	err = splitbill.Lock(splitbill, bot.Bunt)
+	if err != nil {
+		log.Errorf("[splitbill] LockSplitbill %s error: %s", splitbill.ID, err)
+		return
+	}
+	// release splitbill no matter what
+	defer splitbill.Release(splitbill, bot.Bunt)
+	if !splitbill.Active {
+		log.Errorf("[splitbill] splitbill %s inactive.", splitbill.ID)
+		return
+	}
+
+	var participant *SplitbillParticipant
+	for _, p := range splitbill.Participants {
+		if p.TelegramId == from.Telegram.ID {
+			participant = p
+		}
+	}
+	if participant == nil || participant.Paid {
+		return
+	}
+	// large shares wait for the PIN
+	if bot.requirePinForCallback(ctx, from, participant.Share, "splitbill", c) {
+		return
+	}
+	to, err := bot.loadUser(splitbill.To)
+	if err != nil {
+		log.Errorf("[splitbill] %s", err)
+		return
+	}
+	toUserStr := GetUserStr(to.Telegram)
+	fromUserStr := GetUserStr(from.Telegram)
+	t := NewTransaction(bot, from, to, participant.Share, TransactionType("splitbill"), TransactionChat(c.Message.Chat), TransactionConfirmed())
+	t.Memo = fmt.Sprintf("Splitbill from %s to %s (%d sat).", fromUserStr, toUserStr, participant.Share)
+	success, err := t.Send()
+	if !success {
+		bot.trySendMessage(from.Telegram, Translate(ctx, "sendErrorMessage"))
+		log.Errorf("[splitbill] Transaction failed: %s", err)
+		return
+	}
+	log.Infof("[splitbill] splitbill %s: %d sat from %s to %s", splitbill.ID, participant.Share, fromUserStr, toUserStr)
+	participant.Paid = true
+	splitbill.PaidAmount += participant.Share
+
+	bot.trySendMessage(to.Telegram, fmt.Sprintf(i18n.Translate(to.Telegram.LanguageCode, "splitbillReceivedMessage"), GetUserStrMd(from.Telegram), participant.Share))
+	bot.trySendMessage(from.Telegram, fmt.Sprintf(i18n.Translate(from.Telegram.LanguageCode, "splitbillSentMessage"), participant.Share, GetUserStrMd(to.Telegram)))
+
+	splitbill.Message = splitbill.makeMessage(to)
+	if splitbill.PaidAmount >= splitbill.Amount {
+		// everyone has paid
+		bot.tryEditMessage(c.Message, splitbill.Message, &tb.ReplyMarkup{})
+		splitbill.Active = false
+		return
+	}
+	bot.tryEditMessage(c.Message, splitbill.Message, bot.makeSplitbillKeyboard(ctx, splitbill))
+}
+
+// remindSplitbillHandler lets the creator of the bill remind everyone who hasn't paid yet
+func (bot *TipBot) remindSplitbillHandler(ctx context.Context, c *tb.Callback) {
+	tx := &Splitbill{Base: transaction.New(transaction.ID(c.Data))}
+	sn, err := tx.Get(tx, bot.Bunt)
+	if err != nil {
+		log.Errorf("[remindSplitbillHandler] %s", err)
+		return
+	}
+	splitbill := sn.(*Splitbill)
+	if c.Sender.ID != splitbill.To.TelegramID || !splitbill.Active {
+		return
+	}
+	if time.Since(splitbill.LastReminder) < splitbillRemindTimeout {
+		bot.trySendMessage(c.Sender, fmt.Sprintf(TranslateUser(ctx, "splitbillReminderTooSoonMessage"), int(splitbillRemindTimeout.Minutes())))
+		return
+	}
+	to := LoadUser(ctx)
+	nReminded := 0
+	for _, p := range splitbill.Participants {
+		if p.Paid {
+			continue
+		}
+		participant, err := GetLnbitsUser(&tb.User{ID: p.TelegramId, Username: p.TelegramUser}, *bot)
+		if err != nil {
+			log.Errorln(err)
+			continue
+		}
+		reminder := fmt.Sprintf(
+			i18n.Translate(participant.Telegram.LanguageCode, "splitbillReminderMessage"),
+			GetUserStrMd(to.Telegram),
+			p.Share,
+			str.MarkdownEscape(splitbill.ChatTitle),
+		)
+		if len(splitbill.Memo) > 0 {
+			reminder = reminder + fmt.Sprintf(i18n.Translate(participant.Telegram.LanguageCode, "splitbillAppendMemo"), str.MarkdownEscape(splitbill.Memo))
+		}
+		bot.trySendMessage(participant.Telegram, reminder)
+		nReminded++
+	}
+	splitbill.LastReminder = time.Now()
+	runtime.IgnoreError(splitbill.Set(splitbill, bot.Bunt))
+	bot.trySendMessage(c.Sender, fmt.Sprintf(TranslateUser(ctx, "splitbillReminderSentMessage"), nReminded))
+}
+
+func (bot *TipBot) cancelSplitbillHandler(ctx context.Context, c *tb.Callback) {
+	tx := &Splitbill{Base: transaction.New(transaction.ID(c.Data))}
+	sn, err := tx.Get(tx, bot.Bunt)
+	if err != nil {
+		log.Errorf("[cancelSplitbillHandler] %s", err)
+		return
+	}
+	splitbill := sn.(*Splitbill)
+	if c.Sender.ID == splitbill.To.TelegramID {
+		bot.tryEditMessage(c.Message, i18n.Translate(splitbill.LanguageCode, "splitbillCancelledMessage"), &tb.ReplyMarkup{})
+		// set the splitbill inactive
+		splitbill.Active = false
+		splitbill.InTransaction = false
+		runtime.IgnoreError(splitbill.Set(splitbill, bot.Bunt))
+	}
+}
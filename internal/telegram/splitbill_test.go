@@ -0,0 +1,49 @@
+package telegram
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitAmount(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   int
+		shares  []splitbillShare
+		want    []int
+		wantErr bool
+	}{
+		{name: "equal", total: 300, shares: []splitbillShare{{}, {}, {}}, want: []int{100, 100, 100}},
+		{name: "leftover", total: 100, shares: []splitbillShare{{}, {}, {}}, want: []int{34, 33, 33}},
+		{name: "custom", total: 1000, shares: []splitbillShare{{Share: 600}, {}, {}}, want: []int{600, 200, 200}},
+		{name: "all custom", total: 500, shares: []splitbillShare{{Share: 200}, {Share: 300}}, want: []int{200, 300}},
+		{name: "all custom mismatch", total: 600, shares: []splitbillShare{{Share: 200}, {Share: 300}}, wantErr: true},
+		{name: "custom exceeds total", total: 100, shares: []splitbillShare{{Share: 200}, {}}, wantErr: true},
+		{name: "nothing left", total: 200, shares: []splitbillShare{{Share: 200}, {}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := splitAmount(tt.total, tt.shares)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("splitAmount() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitAmount() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetSplitbillShares(t *testing.T) {
+	shares, memoStart, err := getSplitbillShares("/splitbill 3k @alice @bob:1k pizza night")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []splitbillShare{{Username: "alice"}, {Username: "bob", Share: 1000}}
+	if !reflect.DeepEqual(shares, want) || memoStart != 4 {
+		t.Errorf("getSplitbillShares() = %v, %d, want %v, 4", shares, memoStart, want)
+	}
+	if _, _, err := getSplitbillShares("/splitbill 1000 @alice @Alice"); err == nil {
+		t.Error("getSplitbillShares() accepted a duplicate participant")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/LightningTipBot/LightningTipBot/internal"
@@ -34,6 +35,12 @@ func (bot TipBot) startHandler(ctx context.Context, m *tb.Message) {
 	}
 	bot.tryDeleteMessage(walletCreationMsg)
 	ctx = context.WithValue(ctx, "user", user)
+	// sends to the username of the user before they started the bot
+	bot.creditPendingClaims(user)
+	// start links of vouchers: t.me/<bot>?start=v_<code>
+	if strings.HasPrefix(m.Payload, voucherStartPrefix) {
+		bot.redeemVoucher(ctx, user, strings.TrimPrefix(m.Payload, voucherStartPrefix))
+	}
 	bot.helpHandler(ctx, m)
 	bot.trySendMessage(m.Sender, Translate(ctx, "startWalletReadyMessage"))
 	bot.balanceHandler(ctx, m)
@@ -0,0 +1,305 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/i18n"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/scheduler"
+	"github.com/LightningTipBot/LightningTipBot/internal/str"
+	log "github.com/sirupsen/logrus"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	// paySubscriptionsInterval is how often due subscriptions are paid
+	paySubscriptionsInterval = time.Minute
+	paySubscriptionsJob      = "pay-subscriptions"
+	// subscriptionMaxFailures is the number of failed runs in a row after which a subscription is stopped
+	subscriptionMaxFailures = 3
+)
+
+var (
+	subscriptionsMenu     = &tb.ReplyMarkup{ResizeReplyKeyboard: false}
+	btnCancelSubscription = subscriptionsMenu.Data("🚫", "cancel_subscription")
+	subscriptionIntervals = []string{"daily", "weekly", "monthly"}
+)
+
+// Subscription is a standing order that pays Amount from one user to another in every Interval.
+// Subscriptions are stored in the users database so that they survive restarts.
+type Subscription struct {
+	ID        uint      `gorm:"primarykey"`
+	FromId    int       `json:"from_id" gorm:"index"`
+	ToId      int       `json:"to_id" gorm:"index"`
+	FromUser  string    `json:"from_user"`
+	ToUser    string    `json:"to_user"`
+	Amount    int       `json:"amount"`
+	Interval  string    `json:"interval"`
+	Memo      string    `json:"memo"`
+	Active    bool      `json:"active" gorm:"index"`
+	StartAt   time.Time `json:"start_at"`
+	NextRun   time.Time `json:"next_run" gorm:"index"`
+	Runs      int       `json:"runs"`
+	Failures  int       `json:"failures"`
+	CreatedAt time.Time `json:"created"`
+	UpdatedAt time.Time `json:"updated"`
+}
+
+// run returns the time of the nth run. All runs are computed from the start, so that
+// monthly runs on the 31st return to the 31st after shorter months.
+func (s Subscription) run(n int) time.Time {
+	start := s.StartAt
+	if start.IsZero() {
+		// subscriptions created before the start was stored
+		start = s.CreatedAt.UTC()
+	}
+	switch s.Interval {
+	case "daily":
+		return start.AddDate(0, 0, n)
+	case "weekly":
+		return start.AddDate(0, 0, 7*n)
+	default:
+		return addMonths(start, n)
+	}
+}
+
+// addMonths adds months to t. Days that the target month doesn't have become its last day.
+func addMonths(t time.Time, months int) time.Time {
+	year, month, day := t.Date()
+	first := time.Date(year, month+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+	if last := first.AddDate(0, 1, -1).Day(); day > last {
+		day = last
+	}
+	return first.AddDate(0, 0, day-1)
+}
+
+func helpSubscribeUsage(ctx context.Context, errormsg string) string {
+	return fmt.Sprintf(Translate(ctx, "subscribeHelpText"), errormsg)
+}
+
+// subscribeHandler invoked on "/subscribe <amount> @user <daily|weekly|monthly> [<memo>]"
+func (bot *TipBot) subscribeHandler(ctx context.Context, m *tb.Message) {
+	bot.anyTextHandler(ctx, m)
+	from := LoadUser(ctx)
+	if from.Wallet == nil {
+		return
+	}
+	if !m.Private() {
+		NewMessage(m, WithDuration(0, bot))
+	}
+	amount, err := decodeAmountFromCommand(m.Text)
+	if err != nil || amount < 1 {
+		bot.trySendMessage(m.Sender, helpSubscribeUsage(ctx, Translate(ctx, "subscribeInvalidAmountMessage")))
+		return
+	}
+	username, err := getArgumentFromCommand(m.Text, 2)
+	if err != nil || !strings.HasPrefix(username, "@") {
+		bot.trySendMessage(m.Sender, helpSubscribeUsage(ctx, ""))
+		return
+	}
+	interval, err := getArgumentFromCommand(m.Text, 3)
+	interval = strings.ToLower(interval)
+	if err != nil || !containsString(subscriptionIntervals, interval) {
+		bot.trySendMessage(m.Sender, helpSubscribeUsage(ctx, Translate(ctx, "subscribeInvalidIntervalMessage")))
+		return
+	}
+	to, err := GetUserByTelegramUsername(strings.TrimPrefix(username, "@"), *bot)
+	if err != nil {
+		bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "sendUserHasNoWalletMessage"), str.MarkdownEscape(username)))
+		return
+	}
+	if to.Telegram.ID == from.Telegram.ID {
+		bot.trySendMessage(m.Sender, Translate(ctx, "sendYourselfMessage"))
+		return
+	}
+	// the payments of large subscriptions are confirmed with the PIN once
+	if bot.requirePinForCommand(ctx, from, amount, m) {
+		return
+	}
+	subscription := &Subscription{
+		FromId:   from.Telegram.ID,
+		ToId:     to.Telegram.ID,
+		FromUser: GetUserStr(from.Telegram),
+		ToUser:   GetUserStr(to.Telegram),
+		Amount:   amount,
+		Interval: interval,
+		Memo:     GetMemoFromCommand(m.Text, 4),
+		Active:   true,
+		StartAt:  time.Now().UTC(),
+	}
+	// the first payment is made right away
+	subscription.NextRun = subscription.StartAt
+	tx := bot.Database.Create(subscription)
+	if tx.Error != nil {
+		log.Errorf("[/subscribe] Could not save subscription: %s", tx.Error)
+		bot.trySendMessage(m.Sender, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	log.Infof("[/subscribe] %s subscribed to %s: %d sat %s", subscription.FromUser, subscription.ToUser, amount, interval)
+	bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "subscribeCreatedMessage"), amount, GetUserStrMd(to.Telegram), interval))
+}
+
+// subscriptionsHandler invoked on "/subscriptions" lists all subscriptions of the user
+func (bot *TipBot) subscriptionsHandler(ctx context.Context, m *tb.Message) {
+	bot.anyTextHandler(ctx, m)
+	user := LoadUser(ctx)
+	if user.Wallet == nil {
+		return
+	}
+	if !m.Private() {
+		NewMessage(m, WithDuration(0, bot))
+	}
+	message, keyboard := bot.makeSubscriptionsMessage(ctx, user)
+	bot.trySendMessage(m.Sender, message, keyboard)
+}
+
+func (bot *TipBot) makeSubscriptionsMessage(ctx context.Context, user *lnbits.User) (string, *tb.ReplyMarkup) {
+	var subscriptions []Subscription
+	bot.Database.Where("active = ? AND (from_id = ? OR to_id = ?)", true, user.Telegram.ID, user.Telegram.ID).Order("id").Find(&subscriptions)
+	if len(subscriptions) == 0 {
+		return TranslateUser(ctx, "subscriptionsEmptyMessage"), &tb.ReplyMarkup{}
+	}
+	lines := make([]string, len(subscriptions))
+	rows := make([]tb.Row, len(subscriptions))
+	for i, s := range subscriptions {
+		if s.FromId == user.Telegram.ID {
+			lines[i] = fmt.Sprintf(TranslateUser(ctx, "subscriptionsOutgoingMessage"), s.ID, s.Amount, str.MarkdownEscape(s.ToUser), s.Interval)
+		} else {
+			lines[i] = fmt.Sprintf(TranslateUser(ctx, "subscriptionsIncomingMessage"), s.ID, s.Amount, str.MarkdownEscape(s.FromUser), s.Interval)
+		}
+		if len(s.Memo) > 0 {
+			lines[i] += fmt.Sprintf(" ✉️ %s", str.MarkdownEscape(s.Memo))
+		}
+		cancelButton := subscriptionsMenu.Data(fmt.Sprintf(TranslateUser(ctx, "subscriptionsCancelButtonMessage"), s.ID), "cancel_subscription", strconv.Itoa(int(s.ID)))
+		rows[i] = subscriptionsMenu.Row(cancelButton)
+	}
+	subscriptionsMenu.Inline(rows...)
+	return fmt.Sprintf(TranslateUser(ctx, "subscriptionsMessage"), strings.Join(lines, "\n")), subscriptionsMenu
+}
+
+// cancelSubscriptionHandler stops a subscription. Both the payer and the recipient can cancel it.
+func (bot *TipBot) cancelSubscriptionHandler(ctx context.Context, c *tb.Callback) {
+	user := LoadUser(ctx)
+	if user.Wallet == nil {
+		return
+	}
+	id, err := strconv.Atoi(c.Data)
+	if err != nil {
+		return
+	}
+	subscription := &Subscription{}
+	tx := bot.Database.Where("id = ? AND active = ? AND (from_id = ? OR to_id = ?)", id, true, c.Sender.ID, c.Sender.ID).First(subscription)
+	if tx.Error != nil {
+		log.Errorf("[cancelSubscriptionHandler] %s", tx.Error)
+		return
+	}
+	tx = bot.Database.Model(subscription).Update("active", false)
+	if tx.Error != nil {
+		log.Errorf("[cancelSubscriptionHandler] Could not cancel subscription %d: %s", subscription.ID, tx.Error)
+		bot.trySendMessage(c.Sender, TranslateUser(ctx, "errorTryLaterMessage"))
+		return
+	}
+	log.Infof("[subscription] %s cancelled subscription %d", GetUserStr(c.Sender), subscription.ID)
+
+	// notify the other party
+	otherID, otherStr := subscription.ToId, subscription.ToUser
+	if subscription.ToId == c.Sender.ID {
+		otherID, otherStr = subscription.FromId, subscription.FromUser
+	}
+	if other, err := GetLnbitsUser(&tb.User{ID: otherID}, *bot); err == nil {
+		bot.trySendMessage(other.Telegram, fmt.Sprintf(i18n.Translate(other.Telegram.LanguageCode, "subscriptionCancelledByMessage"), GetUserStrMd(c.Sender), subscription.Amount, subscription.Interval))
+	}
+	message, keyboard := bot.makeSubscriptionsMessage(ctx, user)
+	bot.tryEditMessage(c.Message, message, keyboard)
+	bot.trySendMessage(c.Sender, fmt.Sprintf(TranslateUser(ctx, "subscriptionCancelledMessage"), subscription.Amount, str.MarkdownEscape(otherStr), subscription.Interval))
+}
+
+// paySubscriptionsJobHandler pays all due subscriptions
+func (bot *TipBot) paySubscriptionsJobHandler(job *scheduler.Job) error {
+	return bot.payDueSubscriptions(time.Now().UTC())
+}
+
+func (bot *TipBot) payDueSubscriptions(now time.Time) error {
+	var subscriptions []Subscription
+	tx := bot.Database.Where("active = ? AND next_run <= ?", true, now).Find(&subscriptions)
+	if tx.Error != nil {
+		return tx.Error
+	}
+	for _, s := range subscriptions {
+		if bot.claimSubscriptionRun(&s, now) {
+			bot.paySubscription(&s)
+		}
+	}
+	return nil
+}
+
+// claimSubscriptionRun moves the next run of the subscription into the future before it is paid.
+// The update only succeeds if nobody else claimed this run, and a crash after claiming a
+// run skips the payment instead of paying it twice.
+func (bot *TipBot) claimSubscriptionRun(s *Subscription, now time.Time) bool {
+	// runs missed during a downtime are not paid
+	var next time.Time
+	for n := 1; !next.After(now); n++ {
+		next = s.run(n)
+	}
+	tx := bot.Database.Model(&Subscription{}).
+		Where("id = ? AND runs = ?", s.ID, s.Runs).
+		Updates(map[string]interface{}{"runs": s.Runs + 1, "next_run": next})
+	if tx.Error != nil || tx.RowsAffected != 1 {
+		return false
+	}
+	s.Runs++
+	s.NextRun = next
+	return true
+}
+
+func (bot *TipBot) paySubscription(s *Subscription) {
+	from, err := GetLnbitsUser(&tb.User{ID: s.FromId}, *bot)
+	if err != nil || from.Wallet == nil {
+		return
+	}
+	to, err := GetLnbitsUser(&tb.User{ID: s.ToId}, *bot)
+	if err != nil || to.Wallet == nil {
+		return
+	}
+	t := NewTransaction(bot, from, to, s.Amount, TransactionType("subscription"), TransactionConfirmed())
+	t.Memo = fmt.Sprintf("Subscription from %s to %s (%d sat %s).", s.FromUser, s.ToUser, s.Amount, s.Interval)
+	success, err := t.Send()
+	if !success {
+		log.Warnf("[subscription] Subscription %d from %s to %s failed: %s", s.ID, s.FromUser, s.ToUser, err)
+		s.Failures++
+		updates := map[string]interface{}{"failures": s.Failures}
+		if s.Failures >= subscriptionMaxFailures {
+			updates["active"] = false
+		}
+		bot.Database.Model(&Subscription{}).Where("id = ?", s.ID).Updates(updates)
+		bot.trySendMessage(from.Telegram, fmt.Sprintf(i18n.Translate(from.Telegram.LanguageCode, "subscriptionFailedMessage"), s.Amount, GetUserStrMd(to.Telegram), s.Interval))
+		bot.trySendMessage(to.Telegram, fmt.Sprintf(i18n.Translate(to.Telegram.LanguageCode, "subscriptionFailedRecipientMessage"), GetUserStrMd(from.Telegram), s.Amount, s.Interval))
+		if s.Failures >= subscriptionMaxFailures {
+			bot.trySendMessage(from.Telegram, fmt.Sprintf(i18n.Translate(from.Telegram.LanguageCode, "subscriptionStoppedMessage"), s.Amount, GetUserStrMd(to.Telegram), s.Failures))
+		}
+		return
+	}
+	log.Infof("[subscription] Subscription %d: %d sat from %s to %s", s.ID, s.Amount, s.FromUser, s.ToUser)
+	if s.Failures > 0 {
+		bot.Database.Model(&Subscription{}).Where("id = ?", s.ID).Update("failures", 0)
+	}
+	bot.trySendMessage(from.Telegram, fmt.Sprintf(i18n.Translate(from.Telegram.LanguageCode, "subscriptionPaidMessage"), s.Amount, GetUserStrMd(to.Telegram), s.Interval))
+	bot.trySendMessage(to.Telegram, fmt.Sprintf(i18n.Translate(to.Telegram.LanguageCode, "subscriptionReceivedMessage"), GetUserStrMd(from.Telegram), s.Amount, s.Interval))
+	if len(s.Memo) > 0 {
+		bot.trySendMessage(to.Telegram, fmt.Sprintf("✉️ %s", str.MarkdownEscape(s.Memo)))
+	}
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
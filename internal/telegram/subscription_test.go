@@ -0,0 +1,61 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestTipBot_claimSubscriptionRun(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&Subscription{}); err != nil {
+		t.Fatal(err)
+	}
+	bot := &TipBot{Database: db}
+	now := time.Date(2021, 10, 10, 12, 0, 0, 0, time.UTC)
+	s := Subscription{Amount: 100, Interval: "weekly", Active: true, StartAt: now.AddDate(0, 0, -15), NextRun: now.AddDate(0, 0, -1)}
+	db.Create(&s)
+
+	// a copy that was loaded before the run was claimed
+	stale := s
+	if !bot.claimSubscriptionRun(&s, now) {
+		t.Fatal("claimSubscriptionRun() = false, want true")
+	}
+	if want := now.AddDate(0, 0, 6); !s.NextRun.Equal(want) {
+		t.Errorf("NextRun = %s, want %s", s.NextRun, want)
+	}
+	if bot.claimSubscriptionRun(&stale, now) {
+		t.Error("claimSubscriptionRun() claimed the same run twice")
+	}
+
+	var due []Subscription
+	db.Where("active = ? AND next_run <= ?", true, now).Find(&due)
+	if len(due) != 0 {
+		t.Errorf("%d subscriptions due after the run was claimed", len(due))
+	}
+}
+
+func TestSubscription_run(t *testing.T) {
+	start := time.Date(2021, 1, 31, 9, 0, 0, 0, time.UTC)
+	s := Subscription{Interval: "monthly", StartAt: start}
+	for n, want := range []time.Time{
+		start,
+		time.Date(2021, 2, 28, 9, 0, 0, 0, time.UTC),
+		time.Date(2021, 3, 31, 9, 0, 0, 0, time.UTC),
+		time.Date(2021, 4, 30, 9, 0, 0, 0, time.UTC),
+		time.Date(2021, 5, 31, 9, 0, 0, 0, time.UTC),
+	} {
+		if got := s.run(n); !got.Equal(want) {
+			t.Errorf("run(%d) = %s, want %s", n, got, want)
+		}
+	}
+	s.Interval = "weekly"
+	if got, want := s.run(2), start.AddDate(0, 0, 14); !got.Equal(want) {
+		t.Errorf("weekly run(2) = %s, want %s", got, want)
+	}
+}
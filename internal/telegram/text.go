@@ -21,6 +21,12 @@ func (bot TipBot) anyTextHandler(ctx context.Context, m *tb.Message) {
 		return
 	}
 
+	// the PIN of a payment is entered as a reply
+	if user.StateKey == lnbits.UserEnterPin {
+		bot.enterPinHandler(ctx, m)
+		return
+	}
+
 	// could be an invoice
 	anyText := strings.ToLower(m.Text)
 	if lightning.IsInvoice(anyText) {
@@ -0,0 +1,61 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"time"
+	// embed the time zone database so that /timezone works on hosts without one
+	_ "time/tzdata"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/str"
+	log "github.com/sirupsen/logrus"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+// userTimeFormat is how dates are entered and shown to users
+const userTimeFormat = "2006-01-02 15:04"
+
+// userLocation returns the time zone of the user, UTC if none is set
+func userLocation(user *lnbits.User) *time.Location {
+	if loc, err := time.LoadLocation(user.TimeZone); err == nil {
+		return loc
+	}
+	return time.UTC
+}
+
+// formatUserTime formats t in the time zone of the user
+func formatUserTime(user *lnbits.User, t time.Time) string {
+	return t.In(userLocation(user)).Format(userTimeFormat + " MST")
+}
+
+// timezoneHandler invoked on "/timezone [<zone>]" shows or sets the time zone of the user
+func (bot *TipBot) timezoneHandler(ctx context.Context, m *tb.Message) {
+	bot.anyTextHandler(ctx, m)
+	user := LoadUser(ctx)
+	if user.Wallet == nil {
+		return
+	}
+	if !m.Private() {
+		NewMessage(m, WithDuration(0, bot))
+	}
+	zone, err := getArgumentFromCommand(m.Text, 1)
+	if err != nil {
+		bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "timezoneMessage"), userLocation(user).String(), formatUserTime(user, time.Now())))
+		return
+	}
+	loc, err := time.LoadLocation(zone)
+	// Local is the time zone of the server
+	if err != nil || zone == "Local" {
+		bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "timezoneInvalidMessage"), str.MarkdownEscape(zone)))
+		return
+	}
+	user.TimeZone = loc.String()
+	err = UpdateUserRecord(user, *bot)
+	if err != nil {
+		log.Errorf("[/timezone] %s", err)
+		bot.trySendMessage(m.Sender, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "timezoneSetMessage"), user.TimeZone, formatUserTime(user, time.Now())))
+}
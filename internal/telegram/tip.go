@@ -7,7 +7,7 @@ import (
 	"time"
 
 	"github.com/LightningTipBot/LightningTipBot/internal"
-	"github.com/LightningTipBot/LightningTipBot/internal/str"
+	"github.com/LightningTipBot/LightningTipBot/internal/events"
 
 	"github.com/LightningTipBot/LightningTipBot/internal/i18n"
 	log "github.com/sirupsen/logrus"
@@ -40,6 +40,12 @@ func (bot *TipBot) tipHandler(ctx context.Context, m *tb.Message) {
 		return
 	}
 
+	// tip several users at once: /tip 100 @alice @bob [<memo>]
+	if usernames, _ := getUsernamesFromCommand(m.Text); !m.IsReply() && len(usernames) > 0 {
+		bot.batchSendHandler(ctx, m, "tip")
+		return
+	}
+
 	// only if message is a reply
 	if !m.IsReply() {
 		bot.tryDeleteMessage(m)
@@ -79,9 +85,12 @@ func (bot *TipBot) tipHandler(ctx context.Context, m *tb.Message) {
 		bot.trySendMessage(m.Sender, Translate(ctx, "tipYourselfMessage"))
 		return
 	}
+	// large tips wait for the PIN
+	if bot.requirePinForCommand(ctx, from, amount, m) {
+		return
+	}
 
 	toUserStrMd := GetUserStrMd(to.Telegram)
-	fromUserStrMd := GetUserStrMd(from.Telegram)
 	toUserStr := GetUserStr(to.Telegram)
 	fromUserStr := GetUserStr(from.Telegram)
 
@@ -107,7 +116,7 @@ func (bot *TipBot) tipHandler(ctx context.Context, m *tb.Message) {
 
 	// todo: user new get username function to get userStrings
 	transactionMemo := fmt.Sprintf("Tip from %s to %s (%d sat).", fromUserStr, toUserStr, amount)
-	t := NewTransaction(bot, from, to, amount, TransactionType("tip"), TransactionChat(m.Chat))
+	t := NewTransaction(bot, from, to, amount, TransactionType("tip"), TransactionChat(m.Chat), TransactionConfirmed())
 	t.Memo = transactionMemo
 	success, err := t.Send()
 	if !success {
@@ -121,24 +130,21 @@ func (bot *TipBot) tipHandler(ctx context.Context, m *tb.Message) {
 	// update tooltip if necessary
 	messageHasTip := tipTooltipHandler(m, bot, amount, to.Initialized)
 
-	log.Infof("[tip] Transaction sent from %s to %s (%d sat).", fromUserStr, toUserStr, amount)
-
-	// notify users
-	_, err = bot.Telegram.Send(from.Telegram, fmt.Sprintf(i18n.Translate(from.Telegram.LanguageCode, "tipSentMessage"), amount, toUserStrMd))
+	// notify the sender
+	tipSentMessage, err := bot.Telegram.Send(from.Telegram, fmt.Sprintf(i18n.Translate(from.Telegram.LanguageCode, "tipSentMessage"), amount, toUserStrMd), bot.tipUndoOptions(from, t)...)
 	if err != nil {
-		errmsg := fmt.Errorf("[/tip] Error: Send message to %s: %s", toUserStr, err)
+		errmsg := fmt.Errorf("[/tip] Error: Send message to %s: %s", fromUserStr, err)
 		log.Errorln(errmsg)
-		return
+	} else {
+		bot.createTipUndo(t, tipSentMessage)
 	}
 
 	// forward tipped message to user once
 	if !messageHasTip {
 		bot.tryForwardMessage(to.Telegram, m.ReplyTo, tb.Silent)
 	}
-	bot.trySendMessage(to.Telegram, fmt.Sprintf(i18n.Translate(to.Telegram.LanguageCode, "tipReceivedMessage"), fromUserStrMd, amount))
-
-	if len(tipMemo) > 0 {
-		bot.trySendMessage(to.Telegram, fmt.Sprintf("✉️ %s", str.MarkdownEscape(tipMemo)))
-	}
+	payment := transactionPayment(events.Tip, t)
+	payment.Memo = tipMemo
+	bot.Events.Publish(payment)
 	return
 }
@@ -0,0 +1,174 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal"
+	"github.com/LightningTipBot/LightningTipBot/internal/i18n"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
+	"github.com/LightningTipBot/LightningTipBot/internal/scheduler"
+	"github.com/LightningTipBot/LightningTipBot/internal/storage/transaction"
+	log "github.com/sirupsen/logrus"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	expireTipUndoJob    = "expire-tip-undo"
+	reversalTransaction = "reversal"
+	tipUndoKeyBase      = "undo-"
+)
+
+var (
+	tipUndoMenu = &tb.ReplyMarkup{ResizeReplyKeyboard: false}
+	btnUndoTip  = tipUndoMenu.Data("↩️ Undo", "undo_tip")
+)
+
+// TipUndo allows the sender of a tip to reverse it for a few seconds
+type TipUndo struct {
+	*transaction.Base
+	TransactionID uint             `json:"undo_transaction_id"`
+	From          lnbits.UserRef   `json:"undo_from"`
+	To            lnbits.UserRef   `json:"undo_to"`
+	Amount        int              `json:"undo_amount"`
+	Time          time.Time        `json:"undo_time"`
+	ExpiresAt     time.Time        `json:"undo_expires"`
+	Message       tb.StoredMessage `json:"undo_message"`
+}
+
+func tipUndoID(transactionID uint) string {
+	return fmt.Sprintf("%s%d", tipUndoKeyBase, transactionID)
+}
+
+func tipUndoEnabled() bool {
+	return internal.Configuration.Bot.TipUndoSeconds > 0
+}
+
+// tipUndoOptions returns the undo button for the message that confirms a tip to the sender
+func (bot *TipBot) tipUndoOptions(from *lnbits.User, t *Transaction) []interface{} {
+	if !tipUndoEnabled() || t.ID == 0 {
+		return nil
+	}
+	undoButton := tipUndoMenu.Data(fmt.Sprintf(i18n.Translate(from.Telegram.LanguageCode, "tipUndoButtonMessage"), internal.Configuration.Bot.TipUndoSeconds), "undo_tip", tipUndoID(t.ID))
+	tipUndoMenu.Inline(tipUndoMenu.Row(undoButton))
+	return []interface{}{tipUndoMenu}
+}
+
+// createTipUndo stores the undo of a tip, the button is removed when the window closes
+func (bot *TipBot) createTipUndo(t *Transaction, sent *tb.Message) {
+	if !tipUndoEnabled() || t.ID == 0 {
+		return
+	}
+	tipUndo := &TipUndo{
+		Base:          transaction.New(transaction.ID(tipUndoID(t.ID))),
+		TransactionID: t.ID,
+		From:          t.From.Ref(),
+		To:            t.To.Ref(),
+		Amount:        t.Amount,
+		Time:          t.Time,
+		ExpiresAt:     t.Time.Add(time.Duration(internal.Configuration.Bot.TipUndoSeconds) * time.Second),
+		Message:       storedMessage(sent),
+	}
+	runtime.IgnoreError(tipUndo.Set(tipUndo, bot.Bunt))
+	_, err := bot.Scheduler.Schedule(expireTipUndoJob, tipUndo.ExpiresAt, tipUndo.ID)
+	if err != nil {
+		log.Errorf("[tip] Could not schedule expiry of %s: %s", tipUndo.ID, err)
+	}
+}
+
+// undoTipHandler reverses a tip if the window is still open and the recipient hasn't spent the funds
+func (bot *TipBot) undoTipHandler(ctx context.Context, c *tb.Callback) {
+	tx := &TipUndo{Base: transaction.New(transaction.ID(c.Data))}
+	sn, err := tx.Get(tx, bot.Bunt)
+	if err != nil {
+		log.Errorf("[undoTipHandler] %s", err)
+		return
+	}
+	tipUndo := sn.(*TipUndo)
+	if tipUndo.From.TelegramID != c.Sender.ID {
+		return
+	}
+	err = tipUndo.Lock(tipUndo, bot.Bunt)
+	if err != nil {
+		log.Errorf("[undoTipHandler] %s", err)
+		return
+	}
+	defer tipUndo.Release(tipUndo, bot.Bunt)
+	if !tipUndo.Active {
+		return
+	}
+	to, err := bot.loadUser(tipUndo.To)
+	if err != nil {
+		log.Errorf("[undoTipHandler] %s", err)
+		return
+	}
+	toUserStrMd := GetUserStrMd(to.Telegram)
+	if time.Now().After(tipUndo.ExpiresAt) {
+		tipUndo.Active = false
+		bot.tryEditMessage(c.Message, fmt.Sprintf(TranslateUser(ctx, "tipSentMessage"), tipUndo.Amount, toUserStrMd), &tb.ReplyMarkup{})
+		return
+	}
+	if !bot.tipUnspent(tipUndo, to) {
+		bot.trySendMessage(c.Sender, fmt.Sprintf(TranslateUser(ctx, "tipUndoSpentMessage"), toUserStrMd))
+		return
+	}
+	t := NewTransaction(bot, to, LoadUser(ctx), tipUndo.Amount, TransactionType(reversalTransaction), TransactionLink(tipUndo.TransactionID), TransactionWithoutLimits())
+	t.Memo = fmt.Sprintf("Reversal of tip %d from %s to %s (%d sat).", tipUndo.TransactionID, GetUserStr(c.Sender), GetUserStr(to.Telegram), tipUndo.Amount)
+	success, err := t.Send()
+	if !success {
+		log.Warnf("[undoTipHandler] Reversal of tip %d failed: %s", tipUndo.TransactionID, err)
+		bot.trySendMessage(c.Sender, fmt.Sprintf(TranslateUser(ctx, "tipUndoSpentMessage"), toUserStrMd))
+		return
+	}
+	tipUndo.Active = false
+	log.Infof("[tip] %s reversed tip %d of %d sat to %s", GetUserStr(c.Sender), tipUndo.TransactionID, tipUndo.Amount, GetUserStr(to.Telegram))
+	bot.tryEditMessage(c.Message, fmt.Sprintf(TranslateUser(ctx, "tipUndoneMessage"), tipUndo.Amount, toUserStrMd), &tb.ReplyMarkup{})
+	bot.trySendMessage(to.Telegram, fmt.Sprintf(i18n.Translate(to.Telegram.LanguageCode, "tipUndoneRecipientMessage"), GetUserStrMd(c.Sender), tipUndo.Amount))
+}
+
+// tipUnspent checks that the recipient has neither sent anything since the tip nor spent the tipped amount
+func (bot *TipBot) tipUnspent(tipUndo *TipUndo, to *lnbits.User) bool {
+	var sent int64
+	bot.logger.Model(&Transaction{}).Where("from_id = ? AND success = ? AND time >= ?", tipUndo.To.TelegramID, true, tipUndo.Time).Count(&sent)
+	if sent > 0 {
+		return false
+	}
+	balance, err := bot.GetUserBalance(to)
+	return err == nil && balance >= tipUndo.Amount
+}
+
+// expireTipUndoJobHandler removes the undo button when the window is closed
+func (bot *TipBot) expireTipUndoJobHandler(job *scheduler.Job) error {
+	var id string
+	if err := job.Decode(&id); err != nil {
+		log.Errorf("[expireTipUndoJobHandler] %s", err)
+		return nil
+	}
+	tx := &TipUndo{Base: transaction.New(transaction.ID(id))}
+	sn, err := tx.Get(tx, bot.Bunt)
+	if err != nil {
+		return err
+	}
+	tipUndo := sn.(*TipUndo)
+	err = tipUndo.Lock(tipUndo, bot.Bunt)
+	if err != nil {
+		return err
+	}
+	defer tipUndo.Release(tipUndo, bot.Bunt)
+	if !tipUndo.Active {
+		return nil
+	}
+	from, err := bot.loadUser(tipUndo.From)
+	if err != nil {
+		return err
+	}
+	to, err := bot.loadUser(tipUndo.To)
+	if err != nil {
+		return err
+	}
+	tipUndo.Active = false
+	bot.tryEditMessage(tipUndo.Message, fmt.Sprintf(i18n.Translate(from.Telegram.LanguageCode, "tipSentMessage"), tipUndo.Amount, GetUserStrMd(to.Telegram)), &tb.ReplyMarkup{})
+	return nil
+}
@@ -0,0 +1,367 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/errors"
+	"github.com/LightningTipBot/LightningTipBot/internal/i18n"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
+	"github.com/LightningTipBot/LightningTipBot/internal/scheduler"
+	"github.com/LightningTipBot/LightningTipBot/internal/storage/transaction"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/buntdb"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	tipjarMinDeadline = time.Minute
+	tipjarMaxDeadline = 30 * 24 * time.Hour
+	// expireTipjarsInterval is how often expired crowdfunding tipjars are refunded
+	expireTipjarsInterval = time.Minute
+	expireTipjarsJob      = "expire-tipjars"
+	tipjarKeyPattern      = "inl-tipjar-*"
+)
+
+// isGoal returns true if the tipjar is a crowdfunding tipjar with a deadline.
+// Contributions to these tipjars are held by the bot until the goal is reached.
+func (inlineTipjar *InlineTipjar) isGoal() bool {
+	return !inlineTipjar.Deadline.IsZero()
+}
+
+// goalReached checks whether the contributions are paid out to the owner
+func (inlineTipjar *InlineTipjar) goalReached() bool {
+	return inlineTipjar.GivenAmount >= inlineTipjar.Amount
+}
+
+// refundDue checks whether the contributions to the tipjar are refunded at now. A tipjar
+// that reached its goal is inactive, unless its payout failed.
+func (inlineTipjar *InlineTipjar) refundDue(now time.Time) bool {
+	return inlineTipjar.Active && inlineTipjar.isGoal() && now.After(inlineTipjar.Deadline)
+}
+
+// createGoalTipjar is called by createTipjar for commands like
+// "/tipjar <goal> <deadline> [<memo>]"
+func (bot TipBot) createGoalTipjar(ctx context.Context, text string, sender *tb.User, amount int, deadline time.Duration) (*InlineTipjar, error) {
+	if amount < 1 {
+		return nil, errors.New(errors.InvalidAmountError, fmt.Errorf("invalid goal"))
+	}
+	if deadline < tipjarMinDeadline || deadline > tipjarMaxDeadline {
+		return nil, errors.New(errors.InvalidDeadlineError, fmt.Errorf("invalid deadline %s", deadline))
+	}
+	id := fmt.Sprintf("inl-tipjar-%d-%d-%s", sender.ID, amount, RandStringRunes(5))
+	inlineTipjar := &InlineTipjar{
+		Base:         transaction.New(transaction.ID(id)),
+		Amount:       amount,
+		To:           LoadUser(ctx).Ref(),
+		Memo:         GetMemoFromCommand(text, 3),
+		Deadline:     time.Now().Add(deadline),
+		LanguageCode: ctx.Value("publicLanguageCode").(string),
+	}
+	inlineTipjar.Message = inlineTipjar.makeGoalMessage(LoadUser(ctx))
+	return inlineTipjar, nil
+}
+
+func (inlineTipjar *InlineTipjar) makeGoalMessage(to *lnbits.User) string {
+	message := fmt.Sprintf(
+		i18n.Translate(inlineTipjar.LanguageCode, "inlineTipjarGoalMessage"),
+		GetUserStr(to.Telegram),
+		inlineTipjar.Amount,
+		inlineTipjar.Deadline.UTC().Format("2006-01-02 15:04 MST"),
+		inlineTipjar.GivenAmount,
+		inlineTipjar.Amount,
+		inlineTipjar.NGiven,
+		MakeTipjarbar(inlineTipjar.GivenAmount, inlineTipjar.Amount),
+	)
+	if len(inlineTipjar.Memo) > 0 {
+		message = message + fmt.Sprintf(i18n.Translate(inlineTipjar.LanguageCode, "inlineTipjarAppendMemo"), inlineTipjar.Memo)
+	}
+	return message
+}
+
+// getGoalTipjarContributions returns the amounts offered as buttons: 1%, 5% and 10% of the goal
+func getGoalTipjarContributions(goal int) []int {
+	contributions := make([]int, 0, 3)
+	for _, percent := range []int{1, 5, 10} {
+		contribution := goal * percent / 100
+		if contribution < 1 {
+			contribution = 1
+		}
+		if len(contributions) > 0 && contributions[len(contributions)-1] == contribution {
+			continue
+		}
+		contributions = append(contributions, contribution)
+	}
+	return contributions
+}
+
+func (bot TipBot) makeGoalTipjarKeyboard(ctx context.Context, inlineTipjar *InlineTipjar) *tb.ReplyMarkup {
+	buttons := make([]tb.Btn, 0)
+	for _, contribution := range getGoalTipjarContributions(inlineTipjar.Amount) {
+		buttons = append(buttons, inlineTipjarMenu.Data(fmt.Sprintf("💸 %d", contribution), "contribute_tipjar_inline", inlineTipjar.ID, strconv.Itoa(contribution)))
+	}
+	buttons = append(buttons, inlineTipjarMenu.Data(Translate(ctx, "cancelButtonEmoji"), "cancel_tipjar_inline", inlineTipjar.ID))
+	inlineTipjarMenu.Inline(
+		inlineTipjarMenu.Row(buttons...))
+	return inlineTipjarMenu
+}
+
+// contributeTipjarHandler is invoked when a user presses one of the amount buttons of a
+// crowdfunding tipjar. The button data is "<tipjar id>|<amount>".
+func (bot *TipBot) contributeTipjarHandler(ctx context.Context, c *tb.Callback) {
+	from := LoadUser(ctx)
+	if from.Wallet == nil {
+		return
+	}
+	data := strings.Split(c.Data, "|")
+	if len(data) != 2 {
+		return
+	}
+	amount, err := strconv.Atoi(data[1])
+	if err != nil || amount < 1 {
+		return
+	}
+	tx := &InlineTipjar{Base: transaction.New(transaction.ID(data[0]))}
+	fn, err := tx.Get(tx, bot.Bunt)
+	if err != nil {
+		log.Errorf("[tipjar] %s", err)
+		return
+	}
+	inlineTipjar := fn.(*InlineTipjar)
+	err = inlineTipjar.Lock(inlineTipjar, bot.Bunt)
+	if err != nil {
+		log.Errorf("[tipjar] LockTipjar %s error: %s", inlineTipjar.ID, err)
+		return
+	}
+	// release tipjar no matter what
+	defer inlineTipjar.Release(inlineTipjar, bot.Bunt)
+	if !inlineTipjar.Active || !inlineTipjar.isGoal() || inlineTipjar.refundDue(time.Now()) {
+		log.Errorf("[tipjar] tipjar %s inactive.", inlineTipjar.ID)
+		return
+	}
+
+	to, err := bot.loadUser(inlineTipjar.To)
+	if err != nil {
+		log.Errorf("[tipjar] %s", err)
+		return
+	}
+	if from.Telegram.ID == to.Telegram.ID {
+		bot.trySendMessage(from.Telegram, Translate(ctx, "sendYourselfMessage"))
+		return
+	}
+	// the last contribution only fills up the tipjar
+	remaining := inlineTipjar.Amount - inlineTipjar.GivenAmount
+	if remaining < 1 {
+		return
+	}
+	if amount > remaining {
+		amount = remaining
+	}
+	// large contributions wait for the PIN
+	if bot.requirePinForCallback(ctx, from, amount, "goal", c) {
+		return
+	}
+	escrow, err := bot.GetBotUser()
+	if err != nil {
+		log.Errorf("[tipjar] Could not load bot wallet: %s", err)
+		bot.trySendMessage(from.Telegram, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	fromUserStr := GetUserStr(from.Telegram)
+	toUserStr := GetUserStr(to.Telegram)
+	t := NewTransaction(bot, from, escrow, amount, TransactionType("tipjar"), TransactionConfirmed())
+	t.Memo = fmt.Sprintf("Tipjar from %s to %s (%d sat).", fromUserStr, toUserStr, amount)
+	success, err := t.Send()
+	if !success {
+		bot.trySendMessage(from.Telegram, Translate(ctx, "sendErrorMessage"))
+		log.Errorf("[tipjar] Transaction failed: %s", err)
+		return
+	}
+	log.Infof("[tipjar] tipjar %s: %d sat from %s to %s held until the goal is reached", inlineTipjar.ID, amount, fromUserStr, toUserStr)
+
+	inlineTipjar.EditMessage = storedMessage(c.Message)
+	inlineTipjar.GivenAmount += amount
+	isNew := true
+	for i, contributor := range inlineTipjar.From {
+		if contributor.TelegramID == from.Telegram.ID {
+			inlineTipjar.FromAmounts[i] += amount
+			isNew = false
+		}
+	}
+	if isNew {
+		inlineTipjar.From = append(inlineTipjar.From, from.Ref())
+		inlineTipjar.FromAmounts = append(inlineTipjar.FromAmounts, amount)
+		inlineTipjar.NGiven += 1
+	}
+	bot.trySendMessage(from.Telegram, fmt.Sprintf(i18n.Translate(from.Telegram.LanguageCode, "inlineTipjarContributedMessage"), amount, GetUserStrMd(to.Telegram)))
+
+	if inlineTipjar.goalReached() {
+		bot.payoutGoalTipjar(inlineTipjar, to)
+		return
+	}
+	inlineTipjar.Message = inlineTipjar.makeGoalMessage(to)
+	bot.tryEditMessage(c.Message, inlineTipjar.Message, bot.makeTipjarKeyboard(ctx, inlineTipjar))
+}
+
+// payoutGoalTipjar sends all contributions to the owner of a tipjar that reached its goal.
+// The tipjar must be locked by the caller.
+func (bot *TipBot) payoutGoalTipjar(inlineTipjar *InlineTipjar, to *lnbits.User) {
+	escrow, err := bot.GetBotUser()
+	if err != nil {
+		log.Errorf("[tipjar] Could not load bot wallet: %s", err)
+		return
+	}
+	t := NewTransaction(bot, escrow, to, inlineTipjar.GivenAmount, TransactionType("tipjar payout"))
+	t.Memo = fmt.Sprintf("Tipjar payout to %s (%d sat).", GetUserStr(to.Telegram), inlineTipjar.GivenAmount)
+	success, err := t.Send()
+	if !success {
+		// the contributions stay with the bot and are refunded after the deadline
+		log.Errorf("[tipjar] Payout of tipjar %s failed: %s", inlineTipjar.ID, err)
+		return
+	}
+	log.Infof("[tipjar] tipjar %s reached its goal: %d sat to %s", inlineTipjar.ID, inlineTipjar.GivenAmount, GetUserStr(to.Telegram))
+	inlineTipjar.Active = false
+
+	contributors := make([]string, len(inlineTipjar.From))
+	for i, ref := range inlineTipjar.From {
+		// the list is only informative, users that can't be loaded are shown by their ID
+		contributor, _ := bot.loadUser(ref)
+		contributors[i] = fmt.Sprintf("%s: %d sat", GetUserStrMd(contributor.Telegram), inlineTipjar.FromAmounts[i])
+	}
+	bot.trySendMessage(to.Telegram, fmt.Sprintf(
+		i18n.Translate(to.Telegram.LanguageCode, "inlineTipjarGoalReachedMessage"),
+		inlineTipjar.GivenAmount,
+		inlineTipjar.NGiven,
+		strings.Join(contributors, "\n"),
+	))
+	inlineTipjar.Message = fmt.Sprintf(
+		i18n.Translate(inlineTipjar.LanguageCode, "inlineTipjarEndedMessage"),
+		GetUserStr(to.Telegram),
+		inlineTipjar.GivenAmount,
+		inlineTipjar.NGiven,
+	)
+	bot.tryEditMessage(inlineTipjar.EditMessage, inlineTipjar.Message, &tb.ReplyMarkup{})
+}
+
+// refundGoalTipjar sends every contribution back. Contributors that were refunded are removed
+// from the tipjar so that a failed refund can be repeated. The tipjar must be locked by the caller.
+func (bot *TipBot) refundGoalTipjar(inlineTipjar *InlineTipjar, to *lnbits.User) bool {
+	escrow, err := bot.GetBotUser()
+	if err != nil {
+		log.Errorf("[tipjar] Could not load bot wallet: %s", err)
+		return false
+	}
+	toUserStrMd := GetUserStrMd(to.Telegram)
+	for i := len(inlineTipjar.From) - 1; i >= 0; i-- {
+		amount := inlineTipjar.FromAmounts[i]
+		contributor, err := bot.loadUser(inlineTipjar.From[i])
+		if err != nil {
+			log.Errorf("[tipjar] Could not load contributor of tipjar %s: %s", inlineTipjar.ID, err)
+			continue
+		}
+		t := NewTransaction(bot, escrow, contributor, amount, TransactionType("tipjar refund"))
+		t.Memo = fmt.Sprintf("Tipjar refund to %s (%d sat).", GetUserStr(contributor.Telegram), amount)
+		success, err := t.Send()
+		if !success {
+			log.Errorf("[tipjar] Refund of %d sat to %s failed: %s", amount, GetUserStr(contributor.Telegram), err)
+			continue
+		}
+		inlineTipjar.From = append(inlineTipjar.From[:i], inlineTipjar.From[i+1:]...)
+		inlineTipjar.FromAmounts = append(inlineTipjar.FromAmounts[:i], inlineTipjar.FromAmounts[i+1:]...)
+		inlineTipjar.GivenAmount -= amount
+		bot.trySendMessage(contributor.Telegram, fmt.Sprintf(i18n.Translate(contributor.Telegram.LanguageCode, "inlineTipjarRefundedMessage"), amount, toUserStrMd))
+	}
+	runtime.IgnoreError(inlineTipjar.Set(inlineTipjar, bot.Bunt))
+	return len(inlineTipjar.From) == 0
+}
+
+func (bot *TipBot) cancelGoalTipjarHandler(ctx context.Context, c *tb.Callback, inlineTipjar *InlineTipjar) {
+	if c.Sender.ID != inlineTipjar.To.TelegramID {
+		return
+	}
+	err := inlineTipjar.Lock(inlineTipjar, bot.Bunt)
+	if err != nil {
+		log.Errorf("[tipjar] LockTipjar %s error: %s", inlineTipjar.ID, err)
+		return
+	}
+	defer inlineTipjar.Release(inlineTipjar, bot.Bunt)
+	if !inlineTipjar.Active {
+		return
+	}
+	to, err := bot.loadUser(inlineTipjar.To)
+	if err != nil {
+		log.Errorf("[tipjar] %s", err)
+		return
+	}
+	if !bot.refundGoalTipjar(inlineTipjar, to) {
+		// remaining refunds are repeated after the deadline
+		bot.trySendMessage(c.Sender, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	bot.tryEditMessage(c.Message, i18n.Translate(inlineTipjar.LanguageCode, "inlineTipjarCancelledMessage"), &tb.ReplyMarkup{})
+	inlineTipjar.Active = false
+}
+
+// expireTipjarsJobHandler refunds crowdfunding tipjars that missed their goal
+func (bot *TipBot) expireTipjarsJobHandler(job *scheduler.Job) error {
+	bot.expireTipjars(time.Now())
+	return nil
+}
+
+func (bot *TipBot) expireTipjars(now time.Time) {
+	ids := make([]string, 0)
+	runtime.IgnoreError(bot.Bunt.View(func(tx *buntdb.Tx) error {
+		return tx.AscendKeys(tipjarKeyPattern, func(key, value string) bool {
+			inlineTipjar := &InlineTipjar{}
+			if json.Unmarshal([]byte(value), inlineTipjar) != nil {
+				return true
+			}
+			if inlineTipjar.refundDue(now) {
+				ids = append(ids, key)
+			}
+			return true
+		})
+	}))
+	for _, id := range ids {
+		bot.expireTipjar(id)
+	}
+}
+
+func (bot *TipBot) expireTipjar(id string) {
+	tx := &InlineTipjar{Base: transaction.New(transaction.ID(id))}
+	fn, err := tx.Get(tx, bot.Bunt)
+	if err != nil {
+		log.Errorf("[tipjar] %s", err)
+		return
+	}
+	inlineTipjar := fn.(*InlineTipjar)
+	// a locked tipjar is expired on the next run
+	if inlineTipjar.Lock(inlineTipjar, bot.Bunt) != nil {
+		return
+	}
+	defer inlineTipjar.Release(inlineTipjar, bot.Bunt)
+	if !inlineTipjar.Active {
+		return
+	}
+	to, err := bot.loadUser(inlineTipjar.To)
+	if err != nil {
+		log.Errorf("[tipjar] %s", err)
+		return
+	}
+	nGiven := inlineTipjar.NGiven
+	if !bot.refundGoalTipjar(inlineTipjar, to) {
+		return
+	}
+	log.Infof("[tipjar] tipjar %s missed its goal, %d contributors refunded", inlineTipjar.ID, nGiven)
+	inlineTipjar.Active = false
+	inlineTipjar.Message = fmt.Sprintf(i18n.Translate(inlineTipjar.LanguageCode, "inlineTipjarExpiredMessage"), GetUserStr(to.Telegram), inlineTipjar.Amount, nGiven)
+	if inlineTipjar.EditMessage.MessageID != "" {
+		bot.tryEditMessage(inlineTipjar.EditMessage, inlineTipjar.Message, &tb.ReplyMarkup{})
+	}
+	bot.trySendMessage(to.Telegram, fmt.Sprintf(i18n.Translate(to.Telegram.LanguageCode, "inlineTipjarExpiredMessage"), GetUserStr(to.Telegram), inlineTipjar.Amount, nGiven))
+}
@@ -0,0 +1,155 @@
+package telegram
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/storage"
+	"github.com/LightningTipBot/LightningTipBot/internal/storage/transaction"
+	"github.com/eko/gocache/store"
+	gocache "github.com/patrickmn/go-cache"
+	tb "gopkg.in/tucnak/telebot.v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// fakeLNbits is a minimal LNbits API with unlimited balances. It counts the invoices
+// per invoice key, invoices of the keys in failing can't be created.
+type fakeLNbits struct {
+	mu       sync.Mutex
+	failing  map[string]bool
+	invoices map[string]int
+}
+
+func (f *fakeLNbits) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.Header.Get("X-Api-Key")
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Method == http.MethodGet {
+		w.Write([]byte(`{"id":"wallet","balance":1000000000}`))
+		return
+	}
+	params := lnbits.InvoiceParams{}
+	_ = json.NewDecoder(r.Body).Decode(&params)
+	if params.Out {
+		w.Write([]byte(`{"payment_hash":"hash"}`))
+		return
+	}
+	if f.failing[key] {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"message":"wallet unavailable"}`))
+		return
+	}
+	f.invoices[key]++
+	w.Write([]byte(`{"payment_hash":"hash","payment_request":"lnbc1"}`))
+}
+
+// newFakeLNbitsBot returns a bot on fake Telegram and LNbits APIs. The bot itself is user 1.
+func newFakeLNbitsBot(t *testing.T) (*TipBot, *fakeLNbits) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&lnbits.User{}, &Transaction{}); err != nil {
+		t.Fatal(err)
+	}
+	fake := &fakeLNbits{failing: make(map[string]bool), invoices: make(map[string]int)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	telegram, _ := newFakeTelegramBot(t)
+	bot := &TipBot{
+		Database: db,
+		logger:   db,
+		Bunt:     storage.NewBunt(":memory:"),
+		Telegram: telegram,
+		Client:   lnbits.NewClient("admin", server.URL),
+		Cache:    Cache{GoCacheStore: store.NewGoCache(gocache.New(time.Minute, time.Minute), nil)},
+	}
+	newFakeLNbitsUser(t, bot, 1)
+	return bot, fake
+}
+
+// newFakeLNbitsUser creates a user whose wallet keys are "in-<id>" and "admin-<id>"
+func newFakeLNbitsUser(t *testing.T, bot *TipBot, id int) *lnbits.User {
+	name := strconv.Itoa(id)
+	user := &lnbits.User{
+		Name:     name,
+		Telegram: &tb.User{ID: id, Username: "user" + name},
+		Wallet:   &lnbits.Wallet{ID: "wallet-" + name, Inkey: lnbits.WalletKey("in-" + name), Adminkey: lnbits.WalletKey("admin-" + name)},
+	}
+	if err := bot.Database.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestInlineTipjar_goal(t *testing.T) {
+	now := time.Now()
+	for _, test := range []struct {
+		name        string
+		tipjar      InlineTipjar
+		goalReached bool
+		refundDue   bool
+	}{
+		{"open", InlineTipjar{Base: &transaction.Base{Active: true}, Amount: 100, GivenAmount: 50, Deadline: now.Add(time.Hour)}, false, false},
+		{"reached", InlineTipjar{Base: &transaction.Base{}, Amount: 100, GivenAmount: 100, Deadline: now.Add(time.Hour)}, true, false},
+		{"expired", InlineTipjar{Base: &transaction.Base{Active: true}, Amount: 100, GivenAmount: 50, Deadline: now.Add(-time.Second)}, false, true},
+		// the contributions of a failed payout are refunded after the deadline
+		{"payout failed", InlineTipjar{Base: &transaction.Base{Active: true}, Amount: 100, GivenAmount: 100, Deadline: now.Add(-time.Second)}, true, true},
+		{"paid out", InlineTipjar{Base: &transaction.Base{}, Amount: 100, GivenAmount: 100, Deadline: now.Add(-time.Second)}, true, false},
+		{"cancelled", InlineTipjar{Base: &transaction.Base{}, Amount: 100, GivenAmount: 50, Deadline: now.Add(-time.Second)}, false, false},
+		{"without goal", InlineTipjar{Base: &transaction.Base{Active: true}, Amount: 100}, false, false},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			if got := test.tipjar.goalReached(); got != test.goalReached {
+				t.Errorf("goalReached() = %v, want %v", got, test.goalReached)
+			}
+			if got := test.tipjar.refundDue(now); got != test.refundDue {
+				t.Errorf("refundDue() = %v, want %v", got, test.refundDue)
+			}
+		})
+	}
+}
+
+func TestTipBot_refundGoalTipjar(t *testing.T) {
+	bot, fake := newFakeLNbitsBot(t)
+	owner := newFakeLNbitsUser(t, bot, 2)
+	alice, bob := newFakeLNbitsUser(t, bot, 3), newFakeLNbitsUser(t, bot, 4)
+	inlineTipjar := &InlineTipjar{
+		Base:        transaction.New(transaction.ID("inl-tipjar-2-100-abcde")),
+		Amount:      100,
+		GivenAmount: 50,
+		To:          owner.Ref(),
+		From:        []lnbits.UserRef{alice.Ref(), bob.Ref()},
+		FromAmounts: []int{20, 30},
+		NGiven:      2,
+		Deadline:    time.Now().Add(-time.Second),
+	}
+
+	// the refund of bob fails, only alice is refunded
+	fake.failing["in-4"] = true
+	if bot.refundGoalTipjar(inlineTipjar, owner) {
+		t.Fatalf("refundGoalTipjar() = true although a refund failed")
+	}
+	if len(inlineTipjar.From) != 1 || inlineTipjar.From[0] != bob.Ref() || inlineTipjar.FromAmounts[0] != 30 || inlineTipjar.GivenAmount != 30 {
+		t.Fatalf("contributors after the first refund = %v %v (%d sat)", inlineTipjar.From, inlineTipjar.FromAmounts, inlineTipjar.GivenAmount)
+	}
+
+	// the repeated refund skips alice
+	fake.failing["in-4"] = false
+	if !bot.refundGoalTipjar(inlineTipjar, owner) {
+		t.Fatalf("refundGoalTipjar() = false, want true")
+	}
+	if fake.invoices["in-3"] != 1 || fake.invoices["in-4"] != 1 {
+		t.Errorf("refund invoices = %v, want one per contributor", fake.invoices)
+	}
+	if len(inlineTipjar.From) != 0 || inlineTipjar.GivenAmount != 0 {
+		t.Errorf("contributors after the refund = %v (%d sat)", inlineTipjar.From, inlineTipjar.GivenAmount)
+	}
+}
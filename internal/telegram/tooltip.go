@@ -7,6 +7,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/LightningTipBot/LightningTipBot/internal"
 	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
 	"github.com/tidwall/buntdb"
 	"github.com/tidwall/gjson"
@@ -17,7 +18,9 @@ import (
 )
 
 const (
-	tooltipChatWithBotMessage  = "🗑 Chat with %s 👈 to manage your wallet."
+	tooltipChatWithBotMessage  = "🗑 Chat with %s to manage your wallet."
+	tooltipReclaimDaysMessage  = " Unclaimed tips are returned after %d days."
+	tooltipReclaimedMessage    = "♻️ Unclaimed tips were returned to the tippers."
 	tooltipAndOthersMessage    = " ... and others"
 	tooltipMultipleTipsMessage = "%s (%d tips by %s)"
 	tooltipSingleTipMessage    = "%s (by %s)"
@@ -30,6 +33,7 @@ type TipTooltip struct {
 	Ntips     int        `json:"ntips"`
 	LastTip   time.Time  `json:"last_tip"`
 	Tippers   []*tb.User `json:"tippers"`
+	Reclaimed bool       `json:"reclaimed"`
 }
 
 const maxNamesInTipperMessage = 5
@@ -71,12 +75,23 @@ func (ttt TipTooltip) getUpdatedTipTooltipMessage(botUserName string, notInitial
 		tipToolTipMessage = fmt.Sprintf(tooltipSingleTipMessage, tipToolTipMessage, tippersStr)
 	}
 
-	if notInitializedWallet {
-		tipToolTipMessage = tipToolTipMessage + fmt.Sprintf("\n%s", fmt.Sprintf(tooltipChatWithBotMessage, botUserName))
+	if ttt.Reclaimed {
+		tipToolTipMessage = tipToolTipMessage + fmt.Sprintf("\n%s", tooltipReclaimedMessage)
+	} else if notInitializedWallet {
+		tipToolTipMessage = tipToolTipMessage + fmt.Sprintf("\n%s", getChatWithBotMessage(botUserName))
 	}
 	return tipToolTipMessage
 }
 
+// getChatWithBotMessage asks recipients without a wallet to start the bot
+func getChatWithBotMessage(botUserName string) string {
+	message := fmt.Sprintf(tooltipChatWithBotMessage, botUserName)
+	if days := internal.Configuration.Bot.ReclaimDays; days > 0 {
+		message += fmt.Sprintf(tooltipReclaimDaysMessage, days)
+	}
+	return message
+}
+
 // getTippersString joins all tippers username or Telegram id's as mentions (@username or [inline mention of a user](tg://user?id=123456789))
 func getTippersString(tippers []*tb.User) string {
 	var tippersStr string
@@ -127,7 +142,7 @@ func tipTooltipHandler(m *tb.Message, bot *TipBot, amount int, initializedWallet
 		tipmsg = fmt.Sprintf(tooltipSingleTipMessage, tipmsg, userStr)
 
 		if !initializedWallet {
-			tipmsg = tipmsg + fmt.Sprintf("\n%s", fmt.Sprintf(tooltipChatWithBotMessage, GetUserStrMd(bot.Telegram.Me)))
+			tipmsg = tipmsg + fmt.Sprintf("\n%s", getChatWithBotMessage(GetUserStrMd(bot.Telegram.Me)))
 		}
 		msg, err := bot.Telegram.Reply(m.ReplyTo, tipmsg, tb.Silent)
 		if err != nil {
@@ -147,6 +162,8 @@ func tipTooltipHandler(m *tb.Message, bot *TipBot, amount int, initializedWallet
 func (ttt *TipTooltip) updateTooltip(bot *TipBot, user *tb.User, amount int, notInitializedWallet bool) error {
 	ttt.TipAmount += amount
 	ttt.Ntips += 1
+	// new tips can be claimed again
+	ttt.Reclaimed = false
 	ttt.Tippers = appendUinqueUsersToSlice(ttt.Tippers, user)
 	ttt.LastTip = time.Now()
 	err := ttt.editTooltip(bot, notInitializedWallet)
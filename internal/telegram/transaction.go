@@ -30,6 +30,15 @@ type Transaction struct {
 	ToWallet     string       `json:"to_wallet"`
 	FromLNbitsID string       `json:"from_lnbits"`
 	ToLNbitsID   string       `json:"to_lnbits"`
+	BatchID      string       `json:"batch_id"`
+	LinkedID     uint         `json:"linked_id"`
+	// fromWallet and toWallet replace the active wallets of the users
+	fromWallet *lnbits.Wallet
+	toWallet   *lnbits.Wallet
+	// unlimited transactions are not initiated by the sender and skip the spending limits
+	unlimited bool
+	// confirmed transactions were confirmed by the sender, with the PIN if they need one
+	confirmed bool
 }
 
 type TransactionOption func(t *Transaction)
@@ -47,6 +56,43 @@ func TransactionType(transactionType string) TransactionOption {
 	}
 }
 
+// TransactionBatch links transactions that were sent with a single command
+func TransactionBatch(batchID string) TransactionOption {
+	return func(t *Transaction) {
+		t.BatchID = batchID
+	}
+}
+
+// TransactionLink refers to an earlier transaction, for example the one that is reversed
+func TransactionLink(id uint) TransactionOption {
+	return func(t *Transaction) {
+		t.LinkedID = id
+	}
+}
+
+// TransactionWallets sends between other wallets than the active wallets of the users
+func TransactionWallets(from, to *lnbits.Wallet) TransactionOption {
+	return func(t *Transaction) {
+		t.fromWallet = from
+		t.toWallet = to
+	}
+}
+
+// TransactionWithoutLimits skips the spending limits of the sender, for example for reversals
+func TransactionWithoutLimits() TransactionOption {
+	return func(t *Transaction) {
+		t.unlimited = true
+	}
+}
+
+// TransactionConfirmed marks a payment that the sender confirmed, after requirePin or when
+// a faucet, an inline send or a subscription was created. Payments that need the PIN fail without it.
+func TransactionConfirmed() TransactionOption {
+	return func(t *Transaction) {
+		t.confirmed = true
+	}
+}
+
 func NewTransaction(bot *TipBot, from *lnbits.User, to *lnbits.User, amount int, opts ...TransactionOption) *Transaction {
 	t := &Transaction{
 		Bot:      bot,
@@ -97,10 +143,23 @@ func (t *Transaction) SendTransaction(bot *TipBot, from *lnbits.User, to *lnbits
 	fromUserStr := GetUserStr(from.Telegram)
 	toUserStr := GetUserStr(to.Telegram)
 
-	t.FromWallet = from.Wallet.ID
+	fromWallet, toWallet := from.Wallet, to.Wallet
+	if t.fromWallet != nil {
+		fromWallet = t.fromWallet
+	}
+	if t.toWallet != nil {
+		toWallet = t.toWallet
+	}
+	t.FromWallet = fromWallet.ID
 	t.FromLNbitsID = from.ID
 	// check if fromUser has balance
-	balance, err := bot.GetUserBalance(from)
+	var balance int
+	var err error
+	if t.fromWallet != nil {
+		balance, err = bot.GetWalletBalance(fromWallet)
+	} else {
+		balance, err = bot.GetUserBalance(from)
+	}
 	if err != nil {
 		errmsg := fmt.Sprintf("could not get balance of user %s", fromUserStr)
 		log.Errorln(errmsg)
@@ -112,12 +171,27 @@ func (t *Transaction) SendTransaction(bot *TipBot, from *lnbits.User, to *lnbits
 		log.Warnf("Balance of user %s too low", fromUserStr)
 		return false, fmt.Errorf(errmsg)
 	}
+	// moves between own wallets and payouts of the bot are not limited
+	limited := !t.unlimited && from.Telegram.ID != to.Telegram.ID && from.Telegram.ID != bot.Telegram.Me.ID
+	recipient := telegramRecipient(to.Telegram)
+	var spendingDay string
+	if limited {
+		if !t.confirmed && bot.PinRequired(from, amount) {
+			log.Warnf("[SendTransaction] %s: payment of %d sat without PIN", fromUserStr, amount)
+			return false, errPinRequired
+		}
+		spendingDay, err = bot.reserveSpending(from, recipient, amount)
+		if err != nil {
+			log.Warnf("[SendTransaction] %s: %s", fromUserStr, err)
+			return false, err
+		}
+	}
 
-	t.ToWallet = to.ID
+	t.ToWallet = toWallet.ID
 	t.ToLNbitsID = to.ID
 
 	// generate invoice
-	invoice, err := to.Wallet.Invoice(
+	invoice, err := toWallet.Invoice(
 		lnbits.InvoiceParams{
 			Amount: int64(amount),
 			Out:    false,
@@ -126,13 +200,19 @@ func (t *Transaction) SendTransaction(bot *TipBot, from *lnbits.User, to *lnbits
 	if err != nil {
 		errmsg := fmt.Sprintf("[SendTransaction] Error: Could not create invoice for user %s", toUserStr)
 		log.Errorln(errmsg)
+		if limited {
+			bot.releaseSpending(from, spendingDay, recipient, amount)
+		}
 		return false, err
 	}
 	// pay invoice
-	_, err = from.Wallet.Pay(lnbits.PaymentParams{Out: true, Bolt11: invoice.PaymentRequest}, bot.Client)
+	_, err = fromWallet.Pay(lnbits.PaymentParams{Out: true, Bolt11: invoice.PaymentRequest}, bot.Client)
 	if err != nil {
 		errmsg := fmt.Sprintf("[SendTransaction] Error: Payment from %s to %s of %d sat failed", fromUserStr, toUserStr, amount)
 		log.Errorln(errmsg)
+		if limited {
+			bot.releaseSpending(from, spendingDay, recipient, amount)
+		}
 		return false, err
 	}
 	return true, err
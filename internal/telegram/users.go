@@ -93,6 +93,30 @@ func (bot *TipBot) GetUserBalance(user *lnbits.User) (amount int, err error) {
 	return
 }
 
+// loadUser loads a user that an object in BuntDB references, including the wallet keys
+func (bot *TipBot) loadUser(ref lnbits.UserRef) (*lnbits.User, error) {
+	user, err := GetLnbitsUser(&tb.User{ID: ref.TelegramID}, *bot)
+	if err != nil {
+		return user, err
+	}
+	if user.Wallet == nil {
+		return user, fmt.Errorf("%s has no wallet", GetUserStr(user.Telegram))
+	}
+	return user, nil
+}
+
+// GetWalletBalance returns the balance of any wallet of a user in sat
+func (bot *TipBot) GetWalletBalance(wallet *lnbits.Wallet) (amount int, err error) {
+	info, err := bot.Client.Info(*wallet)
+	if err != nil {
+		log.Errorf("[GetWalletBalance] Error: Couldn't fetch wallet %s from LNbits: %s", wallet.ID, err.Error())
+		return
+	}
+	wallet.Balance = info.Balance
+	// msat to sat
+	return int(info.Balance) / 1000, nil
+}
+
 func (bot *TipBot) CreateWalletForTelegramUser(tbUser *tb.User) (*lnbits.User, error) {
 	user := &lnbits.User{Telegram: tbUser}
 	userStr := GetUserStr(tbUser)
@@ -118,3 +142,9 @@ func (bot *TipBot) UserExists(user *tb.User) (*lnbits.User, bool) {
 	}
 	return lnbitUser, true
 }
+
+// GetBotUser returns the wallet of the bot itself. It holds funds in escrow,
+// for example for tipjars with a goal or bounties.
+func (bot *TipBot) GetBotUser() (*lnbits.User, error) {
+	return GetLnbitsUser(bot.Telegram.Me, *bot)
+}
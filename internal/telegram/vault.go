@@ -0,0 +1,217 @@
+package telegram
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal"
+	"github.com/LightningTipBot/LightningTipBot/internal/i18n"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
+	"github.com/LightningTipBot/LightningTipBot/internal/scheduler"
+	"github.com/LightningTipBot/LightningTipBot/internal/storage/transaction"
+	log "github.com/sirupsen/logrus"
+	"github.com/tidwall/buntdb"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	// vaultWalletName is the name of the sub-wallet that holds locked funds. It is hidden from /wallets.
+	vaultWalletName  = "vault"
+	vaultKeyBase     = "vault-"
+	vaultMaxDuration = 5 * 365 * 24 * time.Hour
+	unlockVaultJob   = "unlock-vault"
+)
+
+// VaultLock is an amount in the vault wallet of a user that can't be spent until UnlockAt
+type VaultLock struct {
+	*transaction.Base
+	Owner    lnbits.UserRef `json:"vault_owner"`
+	Amount   int            `json:"vault_amount"`
+	UnlockAt time.Time      `json:"vault_unlock_at"`
+}
+
+func isVaultWallet(wallet lnbits.Wallet) bool {
+	return strings.EqualFold(wallet.Name, vaultWalletName)
+}
+
+// getVaultWallet returns the vault wallet of a user and creates it on first use
+func (bot *TipBot) getVaultWallet(user *lnbits.User) (*lnbits.Wallet, error) {
+	wallets, err := bot.Client.Wallets(*user)
+	if err != nil {
+		return nil, err
+	}
+	for i := range wallets {
+		if isVaultWallet(wallets[i]) {
+			return &wallets[i], nil
+		}
+	}
+	wallet, err := bot.Client.CreateWallet(user.ID, vaultWalletName, internal.Configuration.Lnbits.AdminId)
+	if err != nil {
+		return nil, err
+	}
+	bot.storeWalletOwners(user, wallet)
+	return &wallet, nil
+}
+
+// getVaultLocks returns the locked amounts of a user in the order they unlock
+func (bot *TipBot) getVaultLocks(user *lnbits.User) []*VaultLock {
+	locks := make([]*VaultLock, 0)
+	runtime.IgnoreError(bot.Bunt.View(func(tx *buntdb.Tx) error {
+		return tx.AscendKeys(fmt.Sprintf("%s%d-*", vaultKeyBase, user.Telegram.ID), func(key, value string) bool {
+			lock := &VaultLock{}
+			if json.Unmarshal([]byte(value), lock) != nil || lock.Base == nil {
+				return true
+			}
+			if lock.Active {
+				locks = append(locks, lock)
+			}
+			return true
+		})
+	}))
+	sort.Slice(locks, func(i, j int) bool {
+		return locks[i].UnlockAt.Before(locks[j].UnlockAt)
+	})
+	return locks
+}
+
+// getVaultBalance returns the total locked amount of a user
+func (bot *TipBot) getVaultBalance(user *lnbits.User) int {
+	locked := 0
+	for _, lock := range bot.getVaultLocks(user) {
+		locked += lock.Amount
+	}
+	return locked
+}
+
+// vaultHandler invoked on "/vault [lock <amount> <duration>]" lists or locks savings
+func (bot *TipBot) vaultHandler(ctx context.Context, m *tb.Message) {
+	bot.anyTextHandler(ctx, m)
+	user := LoadUser(ctx)
+	if user.Wallet == nil {
+		return
+	}
+	if !m.Private() {
+		NewMessage(m, WithDuration(0, bot))
+	}
+	action, err := getArgumentFromCommand(m.Text, 1)
+	if err != nil {
+		bot.trySendMessage(m.Sender, bot.makeVaultMessage(ctx, user))
+		return
+	}
+	amountStr, amountErr := getArgumentFromCommand(m.Text, 2)
+	durationStr, durationErr := getArgumentFromCommand(m.Text, 3)
+	if strings.ToLower(action) != "lock" || amountErr != nil || durationErr != nil {
+		bot.trySendMessage(m.Sender, Translate(ctx, "vaultHelpText"))
+		return
+	}
+	amount, err := getAmount(amountStr)
+	if err != nil || amount < 1 {
+		bot.trySendMessage(m.Sender, Translate(ctx, "vaultHelpText"))
+		return
+	}
+	duration, err := getDuration(durationStr)
+	if err != nil || duration <= 0 || duration > vaultMaxDuration {
+		bot.trySendMessage(m.Sender, Translate(ctx, "vaultInvalidDurationMessage"))
+		return
+	}
+	vaultWallet, err := bot.getVaultWallet(user)
+	if err != nil {
+		log.Errorf("[/vault] Could not load the vault wallet of %s: %s", GetUserStr(user.Telegram), err)
+		bot.trySendMessage(m.Sender, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	id := fmt.Sprintf("%s%d-%s", vaultKeyBase, user.Telegram.ID, RandStringRunes(5))
+	lock := &VaultLock{
+		Base:     transaction.New(transaction.ID(id)),
+		Owner:    user.Ref(),
+		Amount:   amount,
+		UnlockAt: time.Now().Add(duration),
+	}
+	// the unlock is scheduled before the funds are moved, so that locked funds always have an unlock
+	if err = lock.Set(lock, bot.Bunt); err == nil {
+		_, err = bot.Scheduler.Schedule(unlockVaultJob, lock.UnlockAt, lock.ID)
+	}
+	if err != nil {
+		log.Errorf("[/vault] Could not schedule unlock of %s: %s", lock.ID, err)
+		bot.trySendMessage(m.Sender, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	t := NewTransaction(bot, user, user, amount, TransactionType("vault lock"), TransactionWallets(user.Wallet, vaultWallet))
+	t.Memo = fmt.Sprintf("Vault lock of %d sat by %s.", amount, GetUserStr(user.Telegram))
+	success, err := t.Send()
+	if !success {
+		// the scheduled unlock finds the lock inactive and does nothing
+		runtime.IgnoreError(lock.Inactivate(lock, bot.Bunt))
+		log.Warnf("[/vault] Lock of %s failed: %s", GetUserStr(user.Telegram), err)
+		bot.trySendMessage(m.Sender, fmt.Sprintf("%s %s", Translate(ctx, "vaultErrorMessage"), err))
+		return
+	}
+	runtime.IgnoreError(bot.Cache.Delete(fmt.Sprintf("%s_balance", user.Name)))
+	log.Infof("[/vault] %s locked %d sat until %s", GetUserStr(user.Telegram), amount, lock.UnlockAt)
+	bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "vaultLockedMessage"), amount, formatUserTime(user, lock.UnlockAt)))
+}
+
+func (bot *TipBot) makeVaultMessage(ctx context.Context, user *lnbits.User) string {
+	locks := bot.getVaultLocks(user)
+	if len(locks) == 0 {
+		return Translate(ctx, "vaultEmptyMessage")
+	}
+	total := 0
+	lines := make([]string, len(locks))
+	for i, lock := range locks {
+		total += lock.Amount
+		lines[i] = fmt.Sprintf(Translate(ctx, "vaultEntryMessage"), lock.Amount, formatUserTime(user, lock.UnlockAt))
+	}
+	return fmt.Sprintf(Translate(ctx, "vaultMessage"), total, strings.Join(lines, "\n"))
+}
+
+// unlockVaultJobHandler moves unlocked funds back to the active wallet of the user
+func (bot *TipBot) unlockVaultJobHandler(job *scheduler.Job) error {
+	var id string
+	if err := job.Decode(&id); err != nil {
+		log.Errorf("[unlockVaultJobHandler] %s", err)
+		return nil
+	}
+	tx := &VaultLock{Base: transaction.New(transaction.ID(id))}
+	sn, err := tx.Get(tx, bot.Bunt)
+	if err != nil {
+		return err
+	}
+	lock := sn.(*VaultLock)
+	err = lock.Lock(lock, bot.Bunt)
+	if err != nil {
+		return err
+	}
+	defer lock.Release(lock, bot.Bunt)
+	if !lock.Active {
+		return nil
+	}
+	owner, err := bot.loadUser(lock.Owner)
+	if err != nil {
+		return err
+	}
+	vaultWallet, err := bot.getVaultWallet(owner)
+	if err != nil {
+		return err
+	}
+	// the lock is inactivated before the payment so that it can never be paid twice
+	if err = lock.Inactivate(lock, bot.Bunt); err != nil {
+		return err
+	}
+	t := NewTransaction(bot, owner, owner, lock.Amount, TransactionType("vault unlock"), TransactionWallets(vaultWallet, owner.Wallet))
+	t.Memo = fmt.Sprintf("Vault unlock of %d sat for %s.", lock.Amount, GetUserStr(owner.Telegram))
+	success, err := t.Send()
+	if !success {
+		lock.Active = true
+		return fmt.Errorf("unlock of %s failed: %v", lock.ID, err)
+	}
+	runtime.IgnoreError(bot.Cache.Delete(fmt.Sprintf("%s_balance", owner.Name)))
+	log.Infof("[vault] Unlocked %d sat of %s", lock.Amount, GetUserStr(owner.Telegram))
+	bot.trySendMessage(owner.Telegram, fmt.Sprintf(i18n.Translate(owner.Telegram.LanguageCode, "vaultUnlockedMessage"), lock.Amount))
+	return nil
+}
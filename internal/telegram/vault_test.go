@@ -0,0 +1,43 @@
+package telegram
+
+import (
+	"testing"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
+	"github.com/LightningTipBot/LightningTipBot/internal/storage"
+	"github.com/LightningTipBot/LightningTipBot/internal/storage/transaction"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+func TestTipBot_getVaultLocks(t *testing.T) {
+	bot := &TipBot{Bunt: storage.NewBunt(":memory:")}
+	user := &lnbits.User{Telegram: &tb.User{ID: 1}}
+	other := &lnbits.User{Telegram: &tb.User{ID: 11}}
+	now := time.Now()
+	for _, l := range []struct {
+		id     string
+		owner  *lnbits.User
+		amount int
+		unlock time.Duration
+		active bool
+	}{
+		{"vault-1-a", user, 100, 2 * time.Hour, true},
+		{"vault-1-b", user, 200, time.Hour, true},
+		{"vault-1-c", user, 400, time.Hour, false},
+		{"vault-11-a", other, 800, time.Hour, true},
+	} {
+		lock := &VaultLock{Base: transaction.New(transaction.ID(l.id)), Owner: l.owner.Ref(), Amount: l.amount, UnlockAt: now.Add(l.unlock)}
+		lock.Active = l.active
+		runtime.IgnoreError(lock.Set(lock, bot.Bunt))
+	}
+
+	locks := bot.getVaultLocks(user)
+	if len(locks) != 2 || locks[0].ID != "vault-1-b" || locks[1].ID != "vault-1-a" {
+		t.Fatalf("getVaultLocks() returned %d locks, want vault-1-b and vault-1-a", len(locks))
+	}
+	if locked := bot.getVaultBalance(user); locked != 300 {
+		t.Errorf("getVaultBalance() = %d, want 300", locked)
+	}
+}
@@ -0,0 +1,268 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/i18n"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
+	"github.com/LightningTipBot/LightningTipBot/internal/scheduler"
+	"github.com/LightningTipBot/LightningTipBot/internal/storage/transaction"
+	"github.com/LightningTipBot/LightningTipBot/internal/str"
+	log "github.com/sirupsen/logrus"
+	"github.com/skip2/go-qrcode"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	// voucherExpiry is the time after which unredeemed vouchers are refunded
+	voucherExpiry      = 30 * 24 * time.Hour
+	voucherMaxCount    = 20
+	voucherKeyBase     = "voucher-"
+	voucherStartPrefix = "v_"
+	expireVoucherJob   = "expire-voucher"
+)
+
+// Voucher is a bearer voucher. Its amount is held in the bot wallet until
+// anyone redeems the code or it expires and is refunded to the creator.
+type Voucher struct {
+	*transaction.Base
+	Code      string         `json:"voucher_code"`
+	Amount    int            `json:"voucher_amount"`
+	Creator   lnbits.UserRef `json:"voucher_creator"`
+	ExpiresAt time.Time      `json:"voucher_expires"`
+}
+
+// newVoucherCode returns a random code that can be typed in any case and used in a start link
+func newVoucherCode() (string, error) {
+	b := make([]byte, 10)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b), nil
+}
+
+func voucherID(code string) string {
+	return voucherKeyBase + strings.ToUpper(code)
+}
+
+func (bot *TipBot) voucherLink(code string) string {
+	return fmt.Sprintf("https://t.me/%s?start=%s%s", bot.Telegram.Me.Username, voucherStartPrefix, code)
+}
+
+func helpVoucherUsage(ctx context.Context, errormsg string) string {
+	return fmt.Sprintf(Translate(ctx, "voucherHelpText"), errormsg, voucherMaxCount)
+}
+
+// voucherHandler invoked on "/voucher <amount> [<count>]" creates vouchers and sends them as QR codes
+func (bot *TipBot) voucherHandler(ctx context.Context, m *tb.Message) {
+	bot.anyTextHandler(ctx, m)
+	user := LoadUser(ctx)
+	if user.Wallet == nil {
+		return
+	}
+	if !m.Private() {
+		// codes posted in a group could be redeemed by anyone
+		NewMessage(m, WithDuration(0, bot))
+		bot.trySendMessage(m.Sender, helpVoucherUsage(ctx, Translate(ctx, "voucherPrivateMessage")))
+		return
+	}
+	amount, err := decodeAmountFromCommand(m.Text)
+	if err != nil || amount < 1 {
+		bot.trySendMessage(m.Sender, helpVoucherUsage(ctx, Translate(ctx, "voucherInvalidAmountMessage")))
+		return
+	}
+	count := 1
+	if countStr, err := getArgumentFromCommand(m.Text, 2); err == nil {
+		count, err = getAmount(countStr)
+		if err != nil || count < 1 || count > voucherMaxCount {
+			bot.trySendMessage(m.Sender, helpVoucherUsage(ctx, Translate(ctx, "voucherInvalidCountMessage")))
+			return
+		}
+	}
+	total := amount * count
+	balance, err := bot.GetUserBalance(user)
+	if err != nil || balance < total {
+		bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "voucherBalanceTooLowMessage"), total))
+		return
+	}
+	// large vouchers wait for the PIN
+	if bot.requirePinForCommand(ctx, user, total, m) {
+		return
+	}
+	vouchers := make([]*Voucher, count)
+	for i := range vouchers {
+		code, err := newVoucherCode()
+		if err != nil {
+			log.Errorf("[/voucher] Could not create a voucher code: %s", err)
+			bot.trySendMessage(m.Sender, Translate(ctx, "errorTryLaterMessage"))
+			return
+		}
+		vouchers[i] = &Voucher{
+			Base:      transaction.New(transaction.ID(voucherID(code))),
+			Code:      code,
+			Amount:    amount,
+			Creator:   user.Ref(),
+			ExpiresAt: time.Now().Add(voucherExpiry),
+		}
+	}
+
+	// the vouchers are held in escrow by the bot
+	escrow, err := bot.GetBotUser()
+	if err != nil {
+		log.Errorf("[/voucher] Could not load bot wallet: %s", err)
+		bot.trySendMessage(m.Sender, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	t := NewTransaction(bot, user, escrow, total, TransactionType("voucher"), TransactionConfirmed())
+	t.Memo = fmt.Sprintf("%d vouchers of %d sat by %s.", count, amount, GetUserStr(user.Telegram))
+	success, err := t.Send()
+	if !success {
+		log.Warnf("[/voucher] Escrow from %s failed: %s", GetUserStr(user.Telegram), err)
+		bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "voucherBalanceTooLowMessage"), total))
+		return
+	}
+	for _, voucher := range vouchers {
+		runtime.IgnoreError(voucher.Set(voucher, bot.Bunt))
+		_, err := bot.Scheduler.Schedule(expireVoucherJob, voucher.ExpiresAt, voucher.ID)
+		if err != nil {
+			log.Errorf("[/voucher] Could not schedule expiry of %s: %s", voucher.ID, err)
+		}
+	}
+	log.Infof("[/voucher] %s created %d vouchers of %d sat", GetUserStr(user.Telegram), count, amount)
+	bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "voucherCreatedMessage"), count, amount, formatUserTime(user, vouchers[0].ExpiresAt)))
+	for _, voucher := range vouchers {
+		bot.sendVoucher(ctx, m.Sender, voucher)
+	}
+}
+
+// sendVoucher sends a printable QR code of the start link of the voucher
+func (bot *TipBot) sendVoucher(ctx context.Context, to *tb.User, voucher *Voucher) {
+	link := bot.voucherLink(voucher.Code)
+	caption := fmt.Sprintf(Translate(ctx, "voucherMessage"), voucher.Amount, voucher.Code, str.MarkdownEscape(link))
+	qr, err := qrcode.Encode(link, qrcode.Medium, 256)
+	if err != nil {
+		log.Errorf("[/voucher] Failed to create QR code for voucher: %s", err)
+		bot.trySendMessage(to, caption, tb.NoPreview)
+		return
+	}
+	bot.trySendMessage(to, &tb.Photo{File: tb.File{FileReader: bytes.NewReader(qr)}, Caption: caption})
+}
+
+// redeemHandler invoked on "/redeem <code>"
+func (bot *TipBot) redeemHandler(ctx context.Context, m *tb.Message) {
+	bot.anyTextHandler(ctx, m)
+	user := LoadUser(ctx)
+	if user.Wallet == nil {
+		return
+	}
+	if !m.Private() {
+		NewMessage(m, WithDuration(0, bot))
+	}
+	code, err := getArgumentFromCommand(m.Text, 1)
+	if err != nil {
+		bot.trySendMessage(m.Sender, helpVoucherUsage(ctx, ""))
+		return
+	}
+	bot.redeemVoucher(ctx, user, code)
+}
+
+// redeemVoucher pays the amount of a voucher to the user. Codes are either entered
+// with /redeem or passed by a start link.
+func (bot *TipBot) redeemVoucher(ctx context.Context, user *lnbits.User, code string) {
+	tx := &Voucher{Base: transaction.New(transaction.ID(voucherID(code)))}
+	sn, err := tx.Get(tx, bot.Bunt)
+	if err != nil {
+		log.Warnf("[voucher] %s tried to redeem unknown voucher %s", GetUserStr(user.Telegram), code)
+		bot.trySendMessage(user.Telegram, TranslateUser(ctx, "voucherUnknownMessage"))
+		return
+	}
+	voucher := sn.(*Voucher)
+	err = voucher.Lock(voucher, bot.Bunt)
+	if err != nil {
+		log.Errorf("[voucher] %s", err)
+		return
+	}
+	defer voucher.Release(voucher, bot.Bunt)
+	if !voucher.Active {
+		bot.trySendMessage(user.Telegram, TranslateUser(ctx, "voucherInvalidMessage"))
+		return
+	}
+	creator, err := bot.loadUser(voucher.Creator)
+	if err != nil {
+		log.Errorf("[voucher] %s", err)
+		bot.trySendMessage(user.Telegram, TranslateUser(ctx, "errorTryLaterMessage"))
+		return
+	}
+	if !bot.payVoucher(voucher, creator, user, "voucher redemption") {
+		bot.trySendMessage(user.Telegram, TranslateUser(ctx, "errorTryLaterMessage"))
+		return
+	}
+	log.Infof("[voucher] %s redeemed %s of %d sat by %s", GetUserStr(user.Telegram), voucher.ID, voucher.Amount, GetUserStr(creator.Telegram))
+	bot.trySendMessage(user.Telegram, fmt.Sprintf(TranslateUser(ctx, "voucherRedeemedMessage"), voucher.Amount))
+	if user.Telegram.ID != creator.Telegram.ID {
+		bot.trySendMessage(creator.Telegram, fmt.Sprintf(i18n.Translate(creator.Telegram.LanguageCode, "voucherRedeemedByMessage"), GetUserStrMd(user.Telegram), voucher.Amount))
+	}
+}
+
+// payVoucher pays out the escrow of a locked voucher. The voucher is inactivated before
+// the payment so that it can never be paid twice, and reactivated if the payment fails.
+func (bot *TipBot) payVoucher(voucher *Voucher, creator, to *lnbits.User, transactionType string) bool {
+	escrow, err := bot.GetBotUser()
+	if err != nil {
+		log.Errorf("[voucher] Could not load bot wallet: %s", err)
+		return false
+	}
+	if voucher.Inactivate(voucher, bot.Bunt) != nil {
+		return false
+	}
+	t := NewTransaction(bot, escrow, to, voucher.Amount, TransactionType(transactionType))
+	t.Memo = fmt.Sprintf("Voucher of %d sat by %s to %s.", voucher.Amount, GetUserStr(creator.Telegram), GetUserStr(to.Telegram))
+	success, err := t.Send()
+	if !success {
+		log.Errorf("[voucher] Payout of %s to %s failed: %s", voucher.ID, GetUserStr(to.Telegram), err)
+		voucher.Active = true
+		return false
+	}
+	return true
+}
+
+// expireVoucherJobHandler refunds a voucher that was not redeemed in time
+func (bot *TipBot) expireVoucherJobHandler(job *scheduler.Job) error {
+	var id string
+	if err := job.Decode(&id); err != nil {
+		log.Errorf("[expireVoucherJobHandler] %s", err)
+		return nil
+	}
+	tx := &Voucher{Base: transaction.New(transaction.ID(id))}
+	sn, err := tx.Get(tx, bot.Bunt)
+	if err != nil {
+		return err
+	}
+	voucher := sn.(*Voucher)
+	err = voucher.Lock(voucher, bot.Bunt)
+	if err != nil {
+		return err
+	}
+	defer voucher.Release(voucher, bot.Bunt)
+	if !voucher.Active {
+		// redeemed or already refunded
+		return nil
+	}
+	creator, err := bot.loadUser(voucher.Creator)
+	if err != nil {
+		return err
+	}
+	if !bot.payVoucher(voucher, creator, creator, "voucher refund") {
+		return fmt.Errorf("refund of %s failed", voucher.ID)
+	}
+	log.Infof("[voucher] %s of %d sat expired and was refunded to %s", voucher.ID, voucher.Amount, GetUserStr(creator.Telegram))
+	bot.trySendMessage(creator.Telegram, fmt.Sprintf(i18n.Translate(creator.Telegram.LanguageCode, "voucherRefundedMessage"), voucher.Code, voucher.Amount))
+	return nil
+}
@@ -0,0 +1,27 @@
+package telegram
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_newVoucherCode(t *testing.T) {
+	codes := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		code, err := newVoucherCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(code) != 16 || strings.ToUpper(code) != code {
+			t.Errorf("newVoucherCode() = %s, want 16 upper case characters", code)
+		}
+		if codes[code] {
+			t.Errorf("newVoucherCode() returned %s twice", code)
+		}
+		codes[code] = true
+		// codes can be typed in lower case
+		if voucherID(strings.ToLower(code)) != voucherID(code) {
+			t.Errorf("voucherID() depends on the case of %s", code)
+		}
+	}
+}
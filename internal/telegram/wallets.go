@@ -0,0 +1,287 @@
+package telegram
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/LightningTipBot/LightningTipBot/internal"
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+	"github.com/LightningTipBot/LightningTipBot/internal/runtime"
+	"github.com/LightningTipBot/LightningTipBot/internal/str"
+	log "github.com/sirupsen/logrus"
+	tb "gopkg.in/tucnak/telebot.v2"
+)
+
+const (
+	walletMaxCount     = 10
+	walletOwnerKeyBase = "walletowner-"
+)
+
+var walletNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,20}$`)
+
+// WalletOwner maps an LNbits wallet to the user it belongs to, so that deposits to wallets
+// that are neither the active nor the default wallet can be credited to the right user
+type WalletOwner struct {
+	WalletID string `json:"wallet_id"`
+	UserID   string `json:"user_id"`
+}
+
+func (o *WalletOwner) Key() string {
+	return walletOwnerKeyBase + o.WalletID
+}
+
+// storeWalletOwners remembers the owner of each wallet
+func (bot *TipBot) storeWalletOwners(user *lnbits.User, wallets ...lnbits.Wallet) {
+	for _, wallet := range wallets {
+		if err := bot.Bunt.Set(&WalletOwner{WalletID: wallet.ID, UserID: user.ID}); err != nil {
+			log.Errorf("[wallets] Could not store owner of wallet %s: %s", wallet.ID, err)
+		}
+	}
+}
+
+// getWallets returns the wallets of a user that can be used with /wallets and /move
+func (bot *TipBot) getWallets(user *lnbits.User) ([]lnbits.Wallet, error) {
+	wallets, err := bot.Client.Wallets(*user)
+	if err != nil {
+		return nil, err
+	}
+	bot.storeWalletOwners(user, wallets...)
+	spendable := make([]lnbits.Wallet, 0, len(wallets))
+	for _, wallet := range wallets {
+		// locked funds can't be spent or moved
+		if !isVaultWallet(wallet) {
+			spendable = append(spendable, wallet)
+		}
+	}
+	return spendable, nil
+}
+
+// findUserWallet returns the wallet of a user with the ID, including its keys
+func (bot *TipBot) findUserWallet(user *lnbits.User, walletID string) (*lnbits.Wallet, error) {
+	wallets, err := bot.Client.Wallets(*user)
+	if err != nil {
+		return nil, err
+	}
+	for i := range wallets {
+		if wallets[i].ID == walletID {
+			return &wallets[i], nil
+		}
+	}
+	return nil, fmt.Errorf("wallet %s does not belong to %s", walletID, GetUserStr(user.Telegram))
+}
+
+// isValidWalletName checks that name can be used for a new wallet
+func isValidWalletName(name string) bool {
+	return walletNameRegex.MatchString(name) && !strings.EqualFold(name, vaultWalletName)
+}
+
+// findWallet returns the wallet with the name or the number in the /wallets list
+func findWallet(wallets []lnbits.Wallet, nameOrNumber string) *lnbits.Wallet {
+	if i, err := strconv.Atoi(nameOrNumber); err == nil && i > 0 && i <= len(wallets) {
+		return &wallets[i-1]
+	}
+	for i := range wallets {
+		if strings.EqualFold(wallets[i].Name, nameOrNumber) {
+			return &wallets[i]
+		}
+	}
+	return nil
+}
+
+// walletsHandler invoked on "/wallets [new|rename|use|default] ..." lists and manages the wallets of a user
+func (bot *TipBot) walletsHandler(ctx context.Context, m *tb.Message) {
+	bot.anyTextHandler(ctx, m)
+	user := LoadUser(ctx)
+	if user.Wallet == nil {
+		return
+	}
+	if !m.Private() {
+		NewMessage(m, WithDuration(0, bot))
+	}
+	wallets, err := bot.getWallets(user)
+	if err != nil || len(wallets) == 0 {
+		log.Errorf("[/wallets] Could not load wallets of %s: %s", GetUserStr(user.Telegram), err)
+		bot.trySendMessage(m.Sender, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	action, err := getArgumentFromCommand(m.Text, 1)
+	if err != nil {
+		bot.trySendMessage(m.Sender, bot.makeWalletsMessage(ctx, user, wallets))
+		return
+	}
+	name, _ := getArgumentFromCommand(m.Text, 2)
+	switch strings.ToLower(action) {
+	case "new":
+		bot.createSubWallet(ctx, user, wallets, name)
+		return
+	case "rename":
+		newName, _ := getArgumentFromCommand(m.Text, 3)
+		bot.renameSubWallet(ctx, user, wallets, name, newName)
+		return
+	case "use", "default":
+		wallet := findWallet(wallets, name)
+		if wallet == nil {
+			bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "walletsUnknownMessage"), str.MarkdownEscape(name)))
+			return
+		}
+		if strings.ToLower(action) == "use" {
+			bot.useSubWallet(ctx, user, wallet)
+		} else {
+			bot.setDefaultSubWallet(ctx, user, wallet)
+		}
+		return
+	}
+	bot.trySendMessage(m.Sender, Translate(ctx, "walletsHelpText"))
+}
+
+// makeWalletsMessage lists the wallets with their balances
+func (bot *TipBot) makeWalletsMessage(ctx context.Context, user *lnbits.User, wallets []lnbits.Wallet) string {
+	var lines []string
+	for i := range wallets {
+		wallet := &wallets[i]
+		line := fmt.Sprintf("%d. *%s*", i+1, str.MarkdownEscape(wallet.Name))
+		if balance, err := bot.GetWalletBalance(wallet); err == nil {
+			line += fmt.Sprintf(": %d sat", balance)
+		}
+		if wallet.ID == user.Wallet.ID {
+			line += " ▶️"
+		}
+		if wallet.ID == user.LightningAddressWallet().ID {
+			line += " ⚡️"
+		}
+		lines = append(lines, line)
+	}
+	return fmt.Sprintf(Translate(ctx, "walletsMessage"), strings.Join(lines, "\n"))
+}
+
+// createSubWallet creates another LNbits wallet of the user
+func (bot *TipBot) createSubWallet(ctx context.Context, user *lnbits.User, wallets []lnbits.Wallet, name string) {
+	if !isValidWalletName(name) || findWallet(wallets, name) != nil {
+		bot.trySendMessage(user.Telegram, Translate(ctx, "walletsInvalidNameMessage"))
+		return
+	}
+	if len(wallets) >= walletMaxCount {
+		bot.trySendMessage(user.Telegram, fmt.Sprintf(Translate(ctx, "walletsTooManyMessage"), walletMaxCount))
+		return
+	}
+	wallet, err := bot.Client.CreateWallet(user.ID, name, internal.Configuration.Lnbits.AdminId)
+	if err != nil {
+		log.Errorf("[/wallets] Could not create wallet %s of %s: %s", name, GetUserStr(user.Telegram), err)
+		bot.trySendMessage(user.Telegram, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	bot.storeWalletOwners(user, wallet)
+	log.Infof("[/wallets] %s created wallet %s", GetUserStr(user.Telegram), name)
+	bot.trySendMessage(user.Telegram, fmt.Sprintf(Translate(ctx, "walletsCreatedMessage"), str.MarkdownEscape(name)))
+}
+
+// renameSubWallet renames a wallet of the user
+func (bot *TipBot) renameSubWallet(ctx context.Context, user *lnbits.User, wallets []lnbits.Wallet, name, newName string) {
+	wallet := findWallet(wallets, name)
+	if wallet == nil {
+		bot.trySendMessage(user.Telegram, fmt.Sprintf(Translate(ctx, "walletsUnknownMessage"), str.MarkdownEscape(name)))
+		return
+	}
+	if existing := findWallet(wallets, newName); !isValidWalletName(newName) || (existing != nil && existing.ID != wallet.ID) {
+		bot.trySendMessage(user.Telegram, Translate(ctx, "walletsInvalidNameMessage"))
+		return
+	}
+	_, err := bot.Client.RenameWallet(*wallet, newName)
+	if err != nil {
+		log.Errorf("[/wallets] Could not rename wallet %s of %s: %s", wallet.ID, GetUserStr(user.Telegram), err)
+		bot.trySendMessage(user.Telegram, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	// the stored copies carry the name as well
+	if user.Wallet.ID == wallet.ID {
+		user.Wallet.Name = newName
+	}
+	if user.DefaultWallet != nil && user.DefaultWallet.ID == wallet.ID {
+		user.DefaultWallet.Name = newName
+	}
+	runtime.IgnoreError(UpdateUserRecord(user, *bot))
+	bot.trySendMessage(user.Telegram, fmt.Sprintf(Translate(ctx, "walletsRenamedMessage"), str.MarkdownEscape(wallet.Name), str.MarkdownEscape(newName)))
+}
+
+// useSubWallet switches the active wallet of the user. Tips, sends and invoices use the active wallet.
+func (bot *TipBot) useSubWallet(ctx context.Context, user *lnbits.User, wallet *lnbits.Wallet) {
+	if user.DefaultWallet == nil || len(user.DefaultWallet.ID) == 0 {
+		// the Lightning address keeps crediting the wallet it credited so far
+		defaultWallet := *user.Wallet
+		user.DefaultWallet = &defaultWallet
+	}
+	user.Wallet = wallet
+	err := UpdateUserRecord(user, *bot)
+	if err != nil {
+		log.Errorf("[/wallets] %s", err)
+		bot.trySendMessage(user.Telegram, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	runtime.IgnoreError(bot.Cache.Delete(fmt.Sprintf("%s_balance", user.Name)))
+	log.Infof("[/wallets] %s switched to wallet %s", GetUserStr(user.Telegram), wallet.Name)
+	bot.trySendMessage(user.Telegram, fmt.Sprintf(Translate(ctx, "walletsActiveMessage"), str.MarkdownEscape(wallet.Name)))
+}
+
+// setDefaultSubWallet sets the wallet that receives payments to the Lightning address
+func (bot *TipBot) setDefaultSubWallet(ctx context.Context, user *lnbits.User, wallet *lnbits.Wallet) {
+	user.DefaultWallet = wallet
+	err := UpdateUserRecord(user, *bot)
+	if err != nil {
+		log.Errorf("[/wallets] %s", err)
+		bot.trySendMessage(user.Telegram, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	bot.trySendMessage(user.Telegram, fmt.Sprintf(Translate(ctx, "walletsDefaultMessage"), str.MarkdownEscape(wallet.Name)))
+}
+
+// moveHandler invoked on "/move <amount> <from> <to>" transfers funds between the wallets of a user
+func (bot *TipBot) moveHandler(ctx context.Context, m *tb.Message) {
+	bot.anyTextHandler(ctx, m)
+	user := LoadUser(ctx)
+	if user.Wallet == nil {
+		return
+	}
+	if !m.Private() {
+		NewMessage(m, WithDuration(0, bot))
+	}
+	amount, err := decodeAmountFromCommand(m.Text)
+	fromName, fromErr := getArgumentFromCommand(m.Text, 2)
+	toName, toErr := getArgumentFromCommand(m.Text, 3)
+	if err != nil || amount < 1 || fromErr != nil || toErr != nil {
+		bot.trySendMessage(m.Sender, Translate(ctx, "moveHelpText"))
+		return
+	}
+	wallets, err := bot.getWallets(user)
+	if err != nil {
+		log.Errorf("[/move] Could not load wallets of %s: %s", GetUserStr(user.Telegram), err)
+		bot.trySendMessage(m.Sender, Translate(ctx, "errorTryLaterMessage"))
+		return
+	}
+	from, to := findWallet(wallets, fromName), findWallet(wallets, toName)
+	if from == nil || to == nil {
+		unknown := fromName
+		if from != nil {
+			unknown = toName
+		}
+		bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "walletsUnknownMessage"), str.MarkdownEscape(unknown)))
+		return
+	}
+	if from.ID == to.ID {
+		bot.trySendMessage(m.Sender, Translate(ctx, "moveHelpText"))
+		return
+	}
+	t := NewTransaction(bot, user, user, amount, TransactionType("move"), TransactionWallets(from, to))
+	t.Memo = fmt.Sprintf("Move of %d sat from %s to %s.", amount, from.Name, to.Name)
+	success, err := t.Send()
+	if !success {
+		log.Warnf("[/move] Move of %s failed: %s", GetUserStr(user.Telegram), err)
+		bot.trySendMessage(m.Sender, fmt.Sprintf("%s %s", Translate(ctx, "moveErrorMessage"), err))
+		return
+	}
+	runtime.IgnoreError(bot.Cache.Delete(fmt.Sprintf("%s_balance", user.Name)))
+	log.Infof("[/move] %s moved %d sat from %s to %s", GetUserStr(user.Telegram), amount, from.Name, to.Name)
+	bot.trySendMessage(m.Sender, fmt.Sprintf(Translate(ctx, "moveMessage"), amount, str.MarkdownEscape(from.Name), str.MarkdownEscape(to.Name)))
+}
@@ -0,0 +1,27 @@
+package telegram
+
+import (
+	"testing"
+
+	"github.com/LightningTipBot/LightningTipBot/internal/lnbits"
+)
+
+func Test_findWallet(t *testing.T) {
+	wallets := []lnbits.Wallet{{ID: "a", Name: "123 (@alice)"}, {ID: "b", Name: "savings"}, {ID: "c", Name: "3"}}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"1", "a"},
+		{"Savings", "b"},
+		{"3", "c"},
+		{"4", ""},
+		{"spending", ""},
+	}
+	for _, tt := range tests {
+		got := findWallet(wallets, tt.name)
+		if (got == nil && tt.want != "") || (got != nil && got.ID != tt.want) {
+			t.Errorf("findWallet(%q) = %v, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"runtime/debug"
 
+	"github.com/LightningTipBot/LightningTipBot/internal/api"
 	"github.com/LightningTipBot/LightningTipBot/internal/lnbits/webhook"
 	"github.com/LightningTipBot/LightningTipBot/internal/lnurl"
 	"github.com/LightningTipBot/LightningTipBot/internal/price"
@@ -26,6 +27,7 @@ func main() {
 	bot := telegram.NewBot()
 	webhook.NewServer(&bot)
 	lnurl.NewServer(&bot)
+	api.NewServer(&bot)
 	price.NewPriceWatcher().Start()
 	bot.Start()
 }